@@ -0,0 +1,147 @@
+package omnicast
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"time"
+)
+
+// Upgrade returns a MediaPlayerV2 backed by the legacy MediaPlayer p.
+// As p has no way to report failures, only Load may return an error. If
+// ctx is done before a method is called, ctx.Err() is returned instead.
+func Upgrade(p MediaPlayer) MediaPlayerV2 {
+	return &upgradedPlayer{p}
+}
+
+type upgradedPlayer struct {
+	MediaPlayer
+}
+
+func (p *upgradedPlayer) Load(ctx context.Context, media *url.URL, metadata MediaMetadata) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return p.MediaPlayer.Load(media, metadata)
+}
+
+func (p *upgradedPlayer) Play(ctx context.Context) error {
+	return p.do(ctx, p.MediaPlayer.Play)
+}
+
+func (p *upgradedPlayer) Pause(ctx context.Context) error {
+	return p.do(ctx, p.MediaPlayer.Pause)
+}
+
+func (p *upgradedPlayer) Stop(ctx context.Context) error {
+	return p.do(ctx, p.MediaPlayer.Stop)
+}
+
+func (p *upgradedPlayer) SeekTo(ctx context.Context, pos time.Duration) error {
+	return p.do(ctx, func() { p.MediaPlayer.SeekTo(pos) })
+}
+
+func (p *upgradedPlayer) SetVolumeLevel(ctx context.Context, level float64) error {
+	return p.do(ctx, func() { p.MediaPlayer.SetVolumeLevel(level) })
+}
+
+func (p *upgradedPlayer) Mute(ctx context.Context) error {
+	return p.do(ctx, p.MediaPlayer.Mute)
+}
+
+func (p *upgradedPlayer) Unmute(ctx context.Context) error {
+	return p.do(ctx, p.MediaPlayer.Unmute)
+}
+
+func (p *upgradedPlayer) do(ctx context.Context, fn func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	fn()
+	return nil
+}
+
+// Subscribe implements the EventSource interface if p does.
+func (p *upgradedPlayer) Subscribe(ctx context.Context) (<-chan *Event, error) {
+	src, ok := p.MediaPlayer.(EventSource)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	return src.Subscribe(ctx)
+}
+
+// Capabilities implements the CapabilityReporter interface.
+func (p *upgradedPlayer) Capabilities() Capability {
+	return CapabilitiesOf(p.MediaPlayer)
+}
+
+// Downgrade returns a legacy MediaPlayer backed by the MediaPlayerV2 p.
+// Control methods use a background context, and errors other than those
+// returned by Load are logged and then discarded.
+func Downgrade(p MediaPlayerV2) MediaPlayer {
+	return &downgradedPlayer{p}
+}
+
+type downgradedPlayer struct {
+	MediaPlayerV2
+}
+
+func (p *downgradedPlayer) Load(media *url.URL, metadata MediaMetadata) error {
+	return p.MediaPlayerV2.Load(context.Background(), media, metadata)
+}
+
+func (p *downgradedPlayer) Play() {
+	p.do("play", p.MediaPlayerV2.Play)
+}
+
+func (p *downgradedPlayer) Pause() {
+	p.do("pause", p.MediaPlayerV2.Pause)
+}
+
+func (p *downgradedPlayer) Stop() {
+	p.do("stop", p.MediaPlayerV2.Stop)
+}
+
+func (p *downgradedPlayer) SeekTo(pos time.Duration) {
+	p.do("seek", func(ctx context.Context) error {
+		return p.MediaPlayerV2.SeekTo(ctx, pos)
+	})
+}
+
+func (p *downgradedPlayer) SetVolumeLevel(level float64) {
+	p.do("set volume", func(ctx context.Context) error {
+		return p.MediaPlayerV2.SetVolumeLevel(ctx, level)
+	})
+}
+
+func (p *downgradedPlayer) Mute() {
+	p.do("mute", p.MediaPlayerV2.Mute)
+}
+
+func (p *downgradedPlayer) Unmute() {
+	p.do("unmute", p.MediaPlayerV2.Unmute)
+}
+
+func (p *downgradedPlayer) do(action string, fn func(context.Context) error) {
+	if err := fn(context.Background()); err != nil {
+		log.Printf("%s: %s failed: %s\n", p.Name(), action, err)
+	}
+}
+
+// Subscribe implements the EventSource interface if p does.
+func (p *downgradedPlayer) Subscribe(ctx context.Context) (<-chan *Event, error) {
+	src, ok := p.MediaPlayerV2.(EventSource)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	return src.Subscribe(ctx)
+}
+
+// Capabilities implements the CapabilityReporter interface.
+func (p *downgradedPlayer) Capabilities() Capability {
+	return CapabilitiesOf(p.MediaPlayerV2)
+}
@@ -0,0 +1,84 @@
+package omnicast
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Capability represents a set of features supported by a media player.
+type Capability uint
+
+// Defined media player capabilities.
+const (
+	// CanPause indicates that the playback can be paused.
+	CanPause Capability = 1 << iota
+	// CanSeek indicates that the playback position can be changed.
+	CanSeek
+	// CanSetRate indicates that the playback rate can be changed.
+	CanSetRate
+	// CanQueue indicates that media can be queued for playback.
+	CanQueue
+	// CanGoNext indicates that the player can skip to the next media.
+	CanGoNext
+	// CanGoPrevious indicates that the player can skip to the previous
+	// media.
+	CanGoPrevious
+	// CanSetVolume indicates that the volume level can be changed.
+	CanSetVolume
+	// CanMute indicates that the player can be muted without losing its
+	// volume level.
+	CanMute
+
+	// AllCapabilities is the set of all defined capabilities.
+	AllCapabilities = CanPause | CanSeek | CanSetRate | CanQueue | CanGoNext | CanGoPrevious | CanSetVolume | CanMute
+)
+
+// String returns the string representation of the capability set, as a
+// list of capability names separated by "|".
+func (c Capability) String() string {
+	if c == 0 {
+		return "none"
+	}
+
+	names := []string{"pause", "seek", "set_rate", "queue", "go_next", "go_previous", "set_volume", "mute"}
+
+	var s []string
+	for i, name := range names {
+		if c&(1<<uint(i)) != 0 {
+			s = append(s, name)
+			c &^= 1 << uint(i)
+		}
+	}
+
+	if c != 0 {
+		s = append(s, strconv.Itoa(int(c)))
+	}
+
+	return strings.Join(s, "|")
+}
+
+// Has returns true if the set includes all given capabilities.
+func (c Capability) Has(capabilities ...Capability) bool {
+	var mask Capability
+	for _, cap := range capabilities {
+		mask |= cap
+	}
+
+	return c&mask == mask
+}
+
+// CapabilityReporter provides the features currently supported by the
+// media player, which may change depending on the loaded media.
+type CapabilityReporter interface {
+	Capabilities() Capability
+}
+
+// CapabilitiesOf returns the capabilities of the player. Players which do
+// not implement CapabilityReporter are assumed to support everything.
+func CapabilitiesOf(player interface{}) Capability {
+	if r, ok := player.(CapabilityReporter); ok {
+		return r.Capabilities()
+	}
+
+	return AllCapabilities
+}
@@ -1,40 +1,101 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/url"
-	"os"
+	"strings"
 
 	"github.com/ericyan/omnicast"
 	"github.com/ericyan/omnicast/gcast"
+	"github.com/ericyan/omnicast/upnp/av"
 )
 
-func main() {
-	if len(os.Args) < 3 {
-		log.Fatalln("missing command/arugments")
-	}
+func load(player omnicast.MediaPlayerV2, mediaURL string) {
+	log.Println(player.Name(), mediaURL)
 
-	if os.Args[1] != "load" {
-		log.Fatalf("Unsupported command: %s\n", os.Args[1])
+	uri, err := url.ParseRequestURI(mediaURL)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	mediaURL := os.Args[2]
-
-	var player omnicast.MediaPlayer
-	player, err := gcast.Find()
+	err = player.Load(context.Background(), uri, nil)
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatal(err)
 	}
+}
 
-	log.Println(player.Name(), mediaURL)
+func watch(player omnicast.MediaPlayerV2) {
+	src, ok := player.(omnicast.EventSource)
+	if !ok {
+		log.Fatalf("%s does not support events\n", player.Name())
+	}
 
-	uri, err := url.ParseRequestURI(mediaURL)
+	events, err := src.Subscribe(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = player.Load(uri, nil)
+	for e := range events {
+		switch e.Type {
+		case omnicast.StateChanged, omnicast.PositionJumped:
+			log.Printf("%s: %s at %s\n", e.Type, e.State, e.Position)
+		case omnicast.MediaChanged:
+			log.Printf("%s: %s\n", e.Type, e.MediaURL)
+		case omnicast.VolumeChanged:
+			log.Printf("%s: %.2f (muted: %t)\n", e.Type, e.VolumeLevel, e.Muted)
+		}
+	}
+}
+
+func findPlayer(dlnaHint string, ifaces []string) (omnicast.MediaPlayerV2, error) {
+	if dlnaHint != "" {
+		var hints []string
+		if dlnaHint != "*" {
+			hints = append(hints, dlnaHint)
+		}
+
+		return av.FindRenderer(context.Background(), hints, ifaces...)
+	}
+
+	return gcast.Find()
+}
+
+func main() {
+	dlnaHint := flag.String("dlna", "", "DLNA renderer name or UDN, or * for the first one found")
+	iface := flag.String("iface", "", "comma-separated network interfaces for discovery, or empty for all")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 1 {
+		log.Fatalln("missing command/arugments")
+	}
+
+	switch args[0] {
+	case "load":
+		if len(args) < 2 {
+			log.Fatalln("missing command/arugments")
+		}
+	case "watch":
+	default:
+		log.Fatalf("Unsupported command: %s\n", args[0])
+	}
+
+	var ifaces []string
+	if *iface != "" {
+		ifaces = strings.Split(*iface, ",")
+	}
+
+	player, err := findPlayer(*dlnaHint, ifaces)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalln(err)
+	}
+
+	switch args[0] {
+	case "load":
+		load(player, args[1])
+	case "watch":
+		watch(player)
 	}
 }
@@ -0,0 +1,159 @@
+package omnicast
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PlaybackState represents the state of media playback.
+type PlaybackState uint
+
+// Defined playback states.
+const (
+	StateIdle PlaybackState = iota
+	StatePlaying
+	StatePaused
+	StateBuffering
+)
+
+// String returns the string representation of the playback state.
+func (s PlaybackState) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StatePlaying:
+		return "playing"
+	case StatePaused:
+		return "paused"
+	case StateBuffering:
+		return "buffering"
+	default:
+		return strconv.Itoa(int(s))
+	}
+}
+
+// StateOf returns the playback state reported by r.
+func StateOf(r PlaybackStateReporter) PlaybackState {
+	switch {
+	case r.IsPlaying():
+		return StatePlaying
+	case r.IsPaused():
+		return StatePaused
+	case r.IsBuffering():
+		return StateBuffering
+	default:
+		return StateIdle
+	}
+}
+
+// EventType represents the kind of state change an Event describes.
+type EventType uint
+
+// Defined event types.
+const (
+	// StateChanged is sent when the playback state changes.
+	StateChanged EventType = iota + 1
+	// PositionJumped is sent when the playback position changes other
+	// than by the normal progress of playback, e.g. after seeking.
+	PositionJumped
+	// MediaChanged is sent when a different media is loaded.
+	MediaChanged
+	// VolumeChanged is sent when the volume level or mute state changes.
+	VolumeChanged
+)
+
+// String returns the string representation of the event type.
+func (t EventType) String() string {
+	switch t {
+	case StateChanged:
+		return "state_changed"
+	case PositionJumped:
+		return "position_jumped"
+	case MediaChanged:
+		return "media_changed"
+	case VolumeChanged:
+		return "volume_changed"
+	default:
+		return strconv.Itoa(int(t))
+	}
+}
+
+// An Event describes a state change of a media player. Only the fields
+// relevant to its Type are guaranteed to be set.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// StateChanged, PositionJumped
+	State    PlaybackState
+	Position time.Duration
+
+	// MediaChanged
+	MediaURL      *url.URL
+	MediaMetadata MediaMetadata
+	MediaDuration time.Duration
+
+	// VolumeChanged
+	VolumeLevel float64
+	Muted       bool
+}
+
+// EventSource is implemented by media players which are able to push
+// state changes instead of being polled.
+type EventSource interface {
+	// Subscribe returns a channel on which events will be delivered. The
+	// channel will be closed once ctx is done.
+	Subscribe(ctx context.Context) (<-chan *Event, error)
+}
+
+// EventBroadcaster delivers published events to all its subscribers. It
+// never blocks the publisher: events are dropped for subscribers which
+// are not keeping up. The zero value is ready to use.
+type EventBroadcaster struct {
+	mu   sync.Mutex
+	subs map[chan *Event]struct{}
+}
+
+// Subscribe implements the EventSource interface.
+func (b *EventBroadcaster) Subscribe(ctx context.Context) (<-chan *Event, error) {
+	ch := make(chan *Event, 16)
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[chan *Event]struct{})
+	}
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		delete(b.subs, ch)
+		close(ch)
+		b.mu.Unlock()
+	}()
+
+	return ch, nil
+}
+
+// Publish sends the event to all subscribers. If the event time is not
+// set, it will be set to the current time.
+func (b *EventBroadcaster) Publish(e *Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package omnicast
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEventBroadcaster(t *testing.T) {
+	var b EventBroadcaster
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch1, _ := b.Subscribe(ctx)
+	ch2, _ := b.Subscribe(context.Background())
+
+	b.Publish(&Event{Type: StateChanged, State: StatePlaying})
+
+	for _, ch := range []<-chan *Event{ch1, ch2} {
+		e := <-ch
+		if e.Type != StateChanged || e.State != StatePlaying {
+			t.Errorf("unexpected event: %+v", e)
+		}
+		if e.Time.IsZero() {
+			t.Error("event time not set")
+		}
+	}
+
+	cancel()
+	if _, ok := <-ch1; ok {
+		t.Error("channel not closed after cancellation")
+	}
+
+	b.Publish(&Event{Type: VolumeChanged})
+	if e := <-ch2; e.Type != VolumeChanged {
+		t.Errorf("unexpected event: %+v", e)
+	}
+}
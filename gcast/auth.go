@@ -0,0 +1,32 @@
+package gcast
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+// ErrNotAuthenticated is returned when connecting to a device which fails
+// device authentication.
+var ErrNotAuthenticated = errors.New("device not authenticated")
+
+// TrustRoots are the root certificates which devices have to chain up to
+// in device authentication. If nil, devices will not be authenticated,
+// which is the default as the Cast root certificates are not distributed
+// with omnicast.
+var TrustRoots *x509.CertPool
+
+// LoadTrustRoots reads the PEM encoded root certificates from the file.
+func LoadTrustRoots(filename string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificate found in " + filename)
+	}
+
+	return roots, nil
+}
@@ -0,0 +1,137 @@
+package gcast_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ericyan/omnicast/gcast"
+	"github.com/ericyan/omnicast/omnicasttest"
+)
+
+// testCert is a certificate issued by a locally generated CA.
+type testCert struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert, isCA bool) *testCert {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{cert, key}
+}
+
+// testAuthenticator signs with the key and presents the chain. A genuine
+// device signs with the key of the leaf certificate.
+type testAuthenticator struct {
+	key   *rsa.PrivateKey
+	chain []*testCert
+}
+
+func (a *testAuthenticator) Authenticate(data []byte, hash crypto.Hash) ([]byte, [][]byte, error) {
+	h := hash.New()
+	h.Write(data)
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, hash, h.Sum(nil))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var chain [][]byte
+	for _, ca := range a.chain {
+		chain = append(chain, ca.cert.Raw)
+	}
+
+	return sig, chain, nil
+}
+
+func TestDeviceAuthentication(t *testing.T) {
+	root := newTestCert(t, "Root", nil, true)
+	intermediate := newTestCert(t, "Intermediate", root, true)
+	device := newTestCert(t, "Device", intermediate, false)
+	impostor := newTestCert(t, "Impostor", nil, false)
+
+	player := omnicasttest.NewPlayer("Test Player")
+	srv, err := gcast.NewServer("Test Player", player, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	dev := &gcast.DeviceInfo{Name: srv.Name, IPv4: addr.IP, Port: addr.Port}
+
+	defer func(roots *x509.CertPool) { gcast.TrustRoots = roots }(gcast.TrustRoots)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(newTestCert(t, "Other Root", nil, true).cert)
+
+	tests := []struct {
+		name          string
+		roots         *x509.CertPool
+		authenticator gcast.DeviceAuthenticator
+		err           error
+	}{
+		{"permissive", nil, nil, nil},
+		{"genuine", roots, &testAuthenticator{device.key, []*testCert{device, intermediate}}, nil},
+		{"unauthenticated", roots, nil, gcast.ErrNotAuthenticated},
+		{"untrusted", otherRoots, &testAuthenticator{device.key, []*testCert{device, intermediate}}, gcast.ErrNotAuthenticated},
+		{"self-signed", roots, &testAuthenticator{impostor.key, []*testCert{impostor}}, gcast.ErrNotAuthenticated},
+		{"stolen chain", roots, &testAuthenticator{impostor.key, []*testCert{device, intermediate}}, gcast.ErrNotAuthenticated},
+		{"incomplete chain", roots, &testAuthenticator{device.key, []*testCert{device}}, gcast.ErrNotAuthenticated},
+	}
+
+	for _, tc := range tests {
+		gcast.TrustRoots = tc.roots
+		srv.Authenticator = tc.authenticator
+
+		s, err := gcast.NewSender("sender-test", dev)
+		if err != tc.err {
+			t.Errorf("%s: got %v; want %v", tc.name, err, tc.err)
+		}
+		if s != nil {
+			s.Close()
+		}
+	}
+}
@@ -2,13 +2,9 @@ package gcast
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"io/ioutil"
 	"log"
 	"net"
-	"net/http"
-	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -67,11 +63,29 @@ type DeviceInfo struct {
 	capabilities DeviceCapability
 }
 
-// TCPAddr returns IPv4 and Port as net.TCPAddr.
+// TCPAddr returns IPv4, or IPv6 if absent, and Port as net.TCPAddr.
 func (d *DeviceInfo) TCPAddr() *net.TCPAddr {
+	if d.IPv4 == nil && d.IPv6 != nil {
+		return &net.TCPAddr{IP: d.IPv6, Port: d.Port}
+	}
+
 	return &net.TCPAddr{IP: d.IPv4, Port: d.Port}
 }
 
+// TCPAddrs returns the addresses of the device to try in order, IPv4
+// first and then IPv6.
+func (d *DeviceInfo) TCPAddrs() []*net.TCPAddr {
+	var addrs []*net.TCPAddr
+	if d.IPv4 != nil {
+		addrs = append(addrs, &net.TCPAddr{IP: d.IPv4, Port: d.Port})
+	}
+	if d.IPv6 != nil {
+		addrs = append(addrs, &net.TCPAddr{IP: d.IPv6, Port: d.Port})
+	}
+
+	return addrs
+}
+
 // Capabilities returns a list of device capabilities.
 func (d *DeviceInfo) Capabilities() []DeviceCapability {
 	result := make([]DeviceCapability, 0)
@@ -113,47 +127,62 @@ func (d *DeviceInfo) CapableOf(capabilities ...DeviceCapability) bool {
 	return d.capabilities&mask == mask
 }
 
-func GetDeviceInfo(ip net.IP) (*DeviceInfo, error) {
-	host := &net.TCPAddr{IP: ip, Port: 8008}
-	endpoint := &url.URL{
-		Scheme: "http",
-		Host:   host.String(),
-		Path:   "/setup/eureka_info",
+// SetCapabilities sets the device capabilities, replacing the ones
+// advertised by the device.
+func (d *DeviceInfo) SetCapabilities(capabilities ...DeviceCapability) {
+	d.capabilities = None
+	for _, c := range capabilities {
+		d.capabilities |= c
 	}
+}
 
-	resp, err := http.Get(endpoint.String())
-	if err != nil {
-		return nil, err
-	}
-	data, err := ioutil.ReadAll(resp.Body)
+// GetDeviceInfo returns the information of the device at the IP address,
+// as reported by its setup API.
+func GetDeviceInfo(ip net.IP) (*DeviceInfo, error) {
+	info, err := NewSetupClient(ip).EurekaInfo(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
-	var info DeviceInfo
-	if err := json.Unmarshal(data, &info); err != nil {
-		return nil, err
+	if info.IPAddress == nil {
+		info.IPAddress = ip
 	}
 
-	return &info, nil
+	return info.DeviceInfo(), nil
 }
 
-// Discover returns a channel with DeviceInfo found via mDNS.
+// Discover returns a channel with DeviceInfo found via mDNS, preceded by
+// the StaticDevices. If mDNS is unavailable, only the StaticDevices will
+// be returned, if any.
 func Discover(ctx context.Context) (<-chan *DeviceInfo, error) {
+	mdnsCh := make(chan *zeroconf.ServiceEntry)
+
 	resolv, err := zeroconf.NewResolver()
 	if err != nil {
-		return nil, err
+		if len(StaticDevices) == 0 {
+			return nil, err
+		}
+
+		log.Println("gcast: mDNS unavailable, using static devices only.", err)
+	} else {
+		go func() {
+			if err := resolv.Browse(ctx, "_googlecast._tcp", "local", mdnsCh); err != nil {
+				return
+			}
+		}()
 	}
 
-	mdnsCh := make(chan *zeroconf.ServiceEntry)
+	devCh := make(chan *DeviceInfo)
 	go func() {
-		if err := resolv.Browse(ctx, "_googlecast._tcp", "local", mdnsCh); err != nil {
-			return
+		for _, dev := range StaticDevices {
+			select {
+			case <-ctx.Done():
+				close(devCh)
+				return
+			case devCh <- dev:
+			}
 		}
-	}()
 
-	devCh := make(chan *DeviceInfo)
-	go func() {
 		for {
 			select {
 			case <-ctx.Done():
@@ -206,15 +235,33 @@ func Discover(ctx context.Context) (<-chan *DeviceInfo, error) {
 }
 
 // Find returns a Sender for the first device found with matching hints.
+// Audio-only devices and multizone groups are included, as all devices
+// capable of audio output can play media.
+//
+// Hints which are IP addresses or host:port pairs are connected to
+// directly, without discovery.
 func Find(hints ...string) (*Sender, error) {
+	for _, hint := range hints {
+		if isAddress(hint) {
+			dev, err := Lookup(hint)
+			if err != nil {
+				return nil, err
+			}
+
+			return NewSender("sender-omnicast", dev)
+		}
+	}
+
 	ctx, stopDiscovery := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+	defer stopDiscovery()
+
 	ch, err := Discover(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	for dev := range ch {
-		if dev.CapableOf(VideoOut, AudioOut) {
+		if dev.CapableOf(AudioOut) {
 			log.Printf("Found Google Cast device: %s (%s)\n", dev.Name, dev.UUID)
 
 			// If no hints given, just return the first one found.
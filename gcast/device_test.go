@@ -0,0 +1,136 @@
+package gcast_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericyan/omnicast/gcast"
+	"github.com/ericyan/omnicast/gcast/gcasttest"
+)
+
+func TestEurekaInfo(t *testing.T) {
+	srv := gcasttest.NewServer("Living Room")
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := &gcast.SetupClient{BaseURL: srv.EurekaURL()}
+	info, err := c.EurekaInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "Living Room" || info.UUID != srv.UUID {
+		t.Errorf("Unexpected device: %s (%s)", info.Name, info.UUID)
+	}
+	if info.Model != "gcasttest" || info.BuildVersion != "gcasttest" || info.CastBuildRevision != "1.0.0" {
+		t.Errorf("Unexpected build: %s %s %s", info.Model, info.BuildVersion, info.CastBuildRevision)
+	}
+	if info.TimeZone != "UTC" || info.Locale != "en-US" {
+		t.Errorf("Unexpected settings: %s %s", info.TimeZone, info.Locale)
+	}
+
+	dev := info.DeviceInfo()
+	if !dev.IPv4.Equal(net.IPv4(127, 0, 0, 1)) || !dev.CapableOf(gcast.VideoOut, gcast.AudioOut) {
+		t.Errorf("Unexpected device info: %+v", dev)
+	}
+
+	if err := c.Rename(ctx, "Kitchen"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := c.EurekaInfo(ctx); err != nil || info.Name != "Kitchen" {
+		t.Errorf("Unexpected name after rename: %v %v", info, err)
+	}
+
+	if err := c.Reboot(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Reboots(); n != 1 {
+		t.Errorf("Unexpected reboots: %d", n)
+	}
+}
+
+// legacyEurekaInfo is the flat format of older firmware.
+const legacyEurekaInfo = `{
+	"bssid": "00:11:22:33:44:55",
+	"build_version": "32904",
+	"cast_build_revision": "1.13.32904",
+	"connected": true,
+	"ip_address": "192.168.1.10",
+	"locale": "en-GB",
+	"mac_address": "A4:77:33:00:00:01",
+	"name": "Bedroom TV",
+	"public_key": "MIIBCgKCAQEA",
+	"release_track": "stable-channel",
+	"ssdp_udn": "8c2ea7c1-6c4a-4b0a-9b43-6f3c7c1d0a11",
+	"ssid": "Home",
+	"timezone": "Europe/London",
+	"uptime": 3600.5,
+	"version": 8
+}`
+
+func TestEurekaInfoLegacy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/setup/eureka_info" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(legacyEurekaInfo))
+	}))
+	defer srv.Close()
+
+	c := &gcast.SetupClient{BaseURL: srv.URL}
+	info, err := c.EurekaInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name != "Bedroom TV" || info.UUID.String() != "8c2ea7c1-6c4a-4b0a-9b43-6f3c7c1d0a11" {
+		t.Errorf("Unexpected device: %s (%s)", info.Name, info.UUID)
+	}
+	if info.MACAddress != "A4:77:33:00:00:01" || info.SSID != "Home" || !info.IPAddress.Equal(net.ParseIP("192.168.1.10")) {
+		t.Errorf("Unexpected network: %s %s %s", info.MACAddress, info.SSID, info.IPAddress)
+	}
+	if info.BuildVersion != "32904" || info.CastBuildRevision != "1.13.32904" || info.ReleaseTrack != "stable-channel" || info.Version != 8 {
+		t.Errorf("Unexpected build: %+v", info)
+	}
+	if info.Uptime != 3600500*time.Millisecond || info.TimeZone != "Europe/London" || info.Locale != "en-GB" {
+		t.Errorf("Unexpected status: %s %s %s", info.Uptime, info.TimeZone, info.Locale)
+	}
+
+	if err := c.Reboot(context.Background()); err == nil {
+		t.Error("Expect error for unsupported request")
+	} else if serr, ok := err.(*gcast.SetupError); !ok || serr.StatusCode != http.StatusNotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSetupClientHTTPS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("cast-local-authorization-token") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		w.Write([]byte(`{"name": "Speaker", "device_info": {"capabilities": {"display_supported": false}}}`))
+	}))
+	defer srv.Close()
+
+	// The self-signed certificate of the device is accepted.
+	c := &gcast.SetupClient{BaseURL: srv.URL}
+	if _, err := c.EurekaInfo(context.Background()); err == nil {
+		t.Error("Expect error without token")
+	}
+
+	c.Token = "secret"
+	info, err := c.EurekaInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev := info.DeviceInfo(); dev.Name != "Speaker" || dev.CapableOf(gcast.VideoOut) || !dev.CapableOf(gcast.AudioOut) {
+		t.Errorf("Unexpected device info: %+v", dev)
+	}
+}
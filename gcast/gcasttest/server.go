@@ -0,0 +1,797 @@
+// Package gcasttest provides a fake Google Cast receiver for testing.
+package gcasttest
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ericyan/omnicast/gcast"
+	"github.com/ericyan/omnicast/gcast/internal/castv2"
+)
+
+// DefaultMediaCommands are the media commands supported by new media
+// sessions, unless changed with SetSupportedMediaCommands.
+const DefaultMediaCommands = gcast.CommandPause | gcast.CommandSeek | gcast.CommandStreamVolume | gcast.CommandStreamMute
+
+// A Server is a fake Cast V2 receiver listening on the loopback
+// interface. It keeps the state of a single receiver application and
+// media session, which can be inspected and changed by tests.
+//
+// Replies are sent to the sender of the request only, while the status
+// changes are broadcasted to all other connected senders. Changes made
+// by tests are broadcasted to all senders.
+type Server struct {
+	Name string
+	UUID uuid.UUID
+
+	ln      net.Listener
+	cs      *castv2.Server
+	eureka  *httptest.Server
+	started time.Time
+
+	mu            sync.Mutex
+	app           *gcast.ReceiverApplication
+	vol           gcast.ReceiverVolume
+	session       *gcast.MediaSession
+	updatedAt     time.Time
+	lastSessionID int
+	commands      gcast.MediaCommand
+	failures      map[string]*gcast.RequestError
+	handlers      map[string]func(*gcast.Message) *gcast.Message
+	members       []*gcast.GroupMember
+	reboots       int
+
+	unavailableApps map[string]bool
+	launchDelay     time.Duration
+}
+
+// NewServer starts and returns a new Server with the given friendly
+// name. The caller should call Close when finished, to shut it down.
+func NewServer(name string) *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("gcasttest: failed to listen: " + err.Error())
+	}
+
+	s := &Server{
+		Name:     name,
+		UUID:     uuid.New(),
+		ln:       ln,
+		started:  time.Now(),
+		vol:      gcast.ReceiverVolume{ControlType: gcast.VolumeControlAttenuation, Level: 1, StepInterval: 0.05},
+		commands: DefaultMediaCommands,
+		failures: make(map[string]*gcast.RequestError),
+		handlers: make(map[string]func(*gcast.Message) *gcast.Message),
+
+		unavailableApps: make(map[string]bool),
+	}
+	s.cs = &castv2.Server{Handler: castv2.HandlerFunc(s.serveCast)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/setup/eureka_info", s.serveEurekaInfo)
+	mux.HandleFunc("/setup/set_eureka_info", s.serveSetEurekaInfo)
+	mux.HandleFunc("/setup/reboot", s.serveReboot)
+	s.eureka = httptest.NewServer(mux)
+
+	go s.cs.Serve(ln)
+
+	return s
+}
+
+// DeviceInfo returns the information needed to connect to the server.
+func (s *Server) DeviceInfo() *gcast.DeviceInfo {
+	addr := s.ln.Addr().(*net.TCPAddr)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dev := &gcast.DeviceInfo{
+		UUID:  s.UUID,
+		Name:  s.Name,
+		Model: "gcasttest",
+		IPv4:  addr.IP,
+		Port:  addr.Port,
+	}
+
+	if len(s.members) > 0 {
+		dev.SetCapabilities(gcast.AudioOut, gcast.MultizoneGroup)
+	} else {
+		dev.SetCapabilities(gcast.VideoOut, gcast.AudioOut)
+	}
+
+	return dev
+}
+
+// EurekaURL returns the base URL of the fake setup API, which serves the
+// device information at /setup/eureka_info.
+func (s *Server) EurekaURL() string {
+	return s.eureka.URL
+}
+
+// serveEurekaInfo serves the device details in the nested format of newer
+// firmware.
+func (s *Server) serveEurekaInfo(w http.ResponseWriter, r *http.Request) {
+	addr := s.ln.Addr().(*net.TCPAddr)
+
+	s.mu.Lock()
+	name := s.Name
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":    name,
+		"version": 12,
+		"build_info": map[string]interface{}{
+			"cast_build_revision": "1.0.0",
+			"system_build_number": "gcasttest",
+			"release_track":       "stable-channel",
+		},
+		"device_info": map[string]interface{}{
+			"ssdp_udn":     s.UUID.String(),
+			"mac_address":  "00:00:00:00:00:00",
+			"model_name":   "gcasttest",
+			"manufacturer": "omnicast",
+			"uptime":       time.Since(s.started).Seconds(),
+			"capabilities": map[string]bool{
+				"display_supported":   true,
+				"multizone_supported": true,
+			},
+		},
+		"net": map[string]interface{}{
+			"ip_address": addr.IP.String(),
+		},
+		"settings": map[string]interface{}{
+			"timezone": "UTC",
+			"locale":   "en-US",
+		},
+	})
+}
+
+func (s *Server) serveSetEurekaInfo(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name *string `json:"name"`
+	}
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name != nil {
+		s.mu.Lock()
+		s.Name = *req.Name
+		s.mu.Unlock()
+	}
+}
+
+func (s *Server) serveReboot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.reboots++
+	s.mu.Unlock()
+}
+
+// Reboots returns the number of reboots requested via the setup API.
+func (s *Server) Reboots() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reboots
+}
+
+// Application returns a copy of the running receiver application, if any.
+func (s *Server) Application() *gcast.ReceiverApplication {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.app == nil {
+		return nil
+	}
+
+	app := *s.app
+	return &app
+}
+
+// Volume returns the receiver volume.
+func (s *Server) Volume() gcast.ReceiverVolume {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.vol
+}
+
+// MediaSession returns a copy of the media session, if any, with the
+// current playback position.
+func (s *Server) MediaSession() *gcast.MediaSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.currentSession()
+}
+
+// SetVolume changes the receiver volume and broadcasts the new status.
+func (s *Server) SetVolume(vol gcast.ReceiverVolume) {
+	s.mu.Lock()
+	s.vol = vol
+	s.mu.Unlock()
+
+	s.broadcastReceiverStatus(nil)
+}
+
+// SetPlayerState changes the state of the media session, as if caused by
+// the user or the media itself, and broadcasts the new status. Changing
+// to IDLE means the media has finished playing.
+func (s *Server) SetPlayerState(state string) {
+	s.mu.Lock()
+	if s.session == nil {
+		s.mu.Unlock()
+		return
+	}
+
+	s.session = s.currentSession()
+	s.session.PlayerState = state
+	if state == "IDLE" {
+		s.session.IdleReason = "FINISHED"
+	}
+	s.mu.Unlock()
+
+	s.broadcastMediaStatus(nil)
+}
+
+// SetCurrentTime changes the playback position, in seconds, of the media
+// session and broadcasts the new status.
+func (s *Server) SetCurrentTime(pos float64) {
+	s.mu.Lock()
+	if s.session == nil {
+		s.mu.Unlock()
+		return
+	}
+
+	s.session.CurrentTime = pos
+	s.updatedAt = time.Now()
+	s.mu.Unlock()
+
+	s.broadcastMediaStatus(nil)
+}
+
+// SetSupportedMediaCommands changes the media commands supported by the
+// current and future media sessions, and broadcasts the new status.
+func (s *Server) SetSupportedMediaCommands(cmds gcast.MediaCommand) {
+	s.mu.Lock()
+	s.commands = cmds
+	session := s.session
+	if session != nil {
+		session.SupportedMediaCommands = cmds
+	}
+	s.mu.Unlock()
+
+	if session != nil {
+		s.broadcastMediaStatus(nil)
+	}
+}
+
+// SetAppAvailable changes the availability of the receiver application.
+// All applications are available by default.
+func (s *Server) SetAppAvailable(appID string, available bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unavailableApps[appID] = !available
+}
+
+// SetLaunchDelay makes applications launch with a delay. The reply to a
+// LAUNCH request will be sent immediately, with the application being
+// launched later reported by a broadcast.
+func (s *Server) SetLaunchDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.launchDelay = d
+}
+
+// SetGroupMembers turns the server into a multizone group with the given
+// members, whose volumes can be controlled by senders.
+func (s *Server) SetGroupMembers(members ...gcast.GroupMember) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.members = make([]*gcast.GroupMember, len(members))
+	for i := range members {
+		m := members[i]
+		if m.Volume == nil {
+			m.Volume = &gcast.ReceiverVolume{ControlType: gcast.VolumeControlAttenuation, Level: 1}
+		}
+		s.members[i] = &m
+	}
+}
+
+// GroupMember returns a copy of the group member, if any.
+func (s *Server) GroupMember(deviceID string) *gcast.GroupMember {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.groupMember(deviceID)
+	if m == nil {
+		return nil
+	}
+
+	return copyMember(m)
+}
+
+// SetMemberVolume changes the volume of the group member, as if changed
+// on the device itself, and broadcasts the update.
+func (s *Server) SetMemberVolume(deviceID string, vol gcast.ReceiverVolume) {
+	s.mu.Lock()
+	m := s.groupMember(deviceID)
+	if m == nil {
+		s.mu.Unlock()
+		return
+	}
+	m.Volume = &vol
+	update := deviceUpdated(0, m)
+	s.mu.Unlock()
+
+	s.broadcast(nil, castv2.PlatformReceiverID, castv2.NamespaceMultizone, update)
+}
+
+// Fail makes the next request of the given type, such as LOAD, fail with
+// the error.
+func (s *Server) Fail(reqType string, err *gcast.RequestError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[reqType] = err
+}
+
+// Close closes the listener and all connections.
+func (s *Server) Close() {
+	s.cs.Close()
+	s.eureka.Close()
+}
+
+// HandleNamespace registers the handler for messages sent to the running
+// application in a custom namespace. The message returned by the handler,
+// if any, will be sent back to the sender.
+func (s *Server) HandleNamespace(namespace string, h func(msg *gcast.Message) *gcast.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[namespace] = h
+}
+
+func (s *Server) serveCast(c *castv2.Conn, msg *castv2.Msg) {
+	switch msg.Namespace {
+	case castv2.NamespaceReceiver, castv2.NamespaceMedia, castv2.NamespaceMultizone:
+	default:
+		s.handleCustomMsg(c, msg)
+		return
+	}
+
+	var h castv2.Header
+	if err := json.Unmarshal([]byte(msg.Payload), &h); err != nil {
+		return
+	}
+
+	if rerr := s.failure(h.Type); rerr != nil {
+		c.Reply(msg, &struct {
+			castv2.Header
+			Reason string `json:"reason,omitempty"`
+		}{castv2.Header{RequestID: h.RequestID, Type: rerr.Type}, rerr.Reason})
+
+		return
+	}
+
+	switch msg.Namespace {
+	case castv2.NamespaceReceiver:
+		s.handleReceiverMsg(c, msg, h)
+	case castv2.NamespaceMedia:
+		s.handleMediaMsg(c, msg, h)
+	case castv2.NamespaceMultizone:
+		s.handleMultizoneMsg(c, msg, h)
+	}
+}
+
+// failure returns and clears the scripted error for the request type.
+func (s *Server) failure(reqType string) *gcast.RequestError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err, ok := s.failures[reqType]
+	if ok {
+		delete(s.failures, reqType)
+	}
+
+	return err
+}
+
+func (s *Server) handleCustomMsg(c *castv2.Conn, msg *castv2.Msg) {
+	s.mu.Lock()
+	h := s.handlers[msg.Namespace]
+	app := s.app
+	s.mu.Unlock()
+
+	if h == nil || app == nil || msg.DestinationID != app.TransportID {
+		return
+	}
+
+	reply := h(&gcast.Message{
+		SourceID:      msg.SourceID,
+		DestinationID: msg.DestinationID,
+		Namespace:     msg.Namespace,
+		Payload:       msg.Payload,
+		PayloadBinary: msg.PayloadBinary,
+	})
+	if reply == nil {
+		return
+	}
+
+	c.Send(&castv2.Msg{
+		SourceID:      msg.DestinationID,
+		DestinationID: msg.SourceID,
+		Namespace:     msg.Namespace,
+		Payload:       reply.Payload,
+		PayloadBinary: reply.PayloadBinary,
+	})
+}
+
+// launch starts the receiver application.
+func (s *Server) launch(appID string) {
+	name := appID
+	if appID == gcast.DefaultReceiverAppID {
+		name = "Default Media Receiver"
+	}
+
+	sessionID := uuid.New().String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.app = &gcast.ReceiverApplication{
+		AppID:               appID,
+		Name:                name,
+		StatusText:          "Ready To Cast",
+		SupportedNamespaces: []map[string]string{{"name": castv2.NamespaceMedia}},
+		SessionID:           sessionID,
+		TransportID:         sessionID,
+	}
+	s.session = nil
+}
+
+func (s *Server) isAppAvailable(appID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return appID != "" && !s.unavailableApps[appID]
+}
+
+func (s *Server) handleReceiverMsg(c *castv2.Conn, msg *castv2.Msg, h castv2.Header) {
+	switch h.Type {
+	case castv2.TypeGetStatus:
+	case castv2.TypeGetAppAvailability:
+		var req struct {
+			AppIDs []string `json:"appId"`
+		}
+		json.Unmarshal([]byte(msg.Payload), &req)
+
+		availability := make(map[string]string)
+		for _, id := range req.AppIDs {
+			if s.isAppAvailable(id) {
+				availability[id] = gcast.AppAvailable
+			} else {
+				availability[id] = gcast.AppUnavailable
+			}
+		}
+
+		c.Reply(msg, &struct {
+			RequestID    uint64            `json:"requestId"`
+			ResponseType string            `json:"responseType"`
+			Availability map[string]string `json:"availability"`
+		}{h.RequestID, castv2.TypeGetAppAvailability, availability})
+
+		return
+	case castv2.TypeLaunch:
+		var req struct {
+			AppID string `json:"appId"`
+		}
+		json.Unmarshal([]byte(msg.Payload), &req)
+
+		if !s.isAppAvailable(req.AppID) {
+			c.Reply(msg, &struct {
+				castv2.Header
+				Reason string `json:"reason"`
+			}{castv2.Header{RequestID: h.RequestID, Type: gcast.TypeLaunchError}, "NOT_FOUND"})
+
+			return
+		}
+
+		s.mu.Lock()
+		delay := s.launchDelay
+		s.mu.Unlock()
+
+		if delay > 0 {
+			// Reply with the current status, and broadcast the new status
+			// once the application is launched.
+			c.Reply(msg, s.receiverStatus(h.RequestID))
+			time.AfterFunc(delay, func() {
+				s.launch(req.AppID)
+				s.broadcastReceiverStatus(nil)
+			})
+
+			return
+		}
+
+		s.launch(req.AppID)
+	case castv2.TypeStop:
+		s.mu.Lock()
+		s.app = nil
+		s.session = nil
+		s.mu.Unlock()
+	case castv2.TypeSetVolume:
+		var req struct {
+			Volume struct {
+				Level *float64 `json:"level"`
+				Muted *bool    `json:"muted"`
+			} `json:"volume"`
+		}
+		json.Unmarshal([]byte(msg.Payload), &req)
+
+		s.mu.Lock()
+		if req.Volume.Level != nil {
+			s.vol.Level = *req.Volume.Level
+		}
+		if req.Volume.Muted != nil {
+			s.vol.Muted = *req.Volume.Muted
+		}
+		s.mu.Unlock()
+	default:
+		c.Reply(msg, &castv2.Header{RequestID: h.RequestID, Type: gcast.TypeInvalidRequest})
+		return
+	}
+
+	c.Reply(msg, s.receiverStatus(h.RequestID))
+	if h.Type != castv2.TypeGetStatus {
+		s.broadcastReceiverStatus(c)
+	}
+}
+
+func (s *Server) handleMediaMsg(c *castv2.Conn, msg *castv2.Msg, h castv2.Header) {
+	var req struct {
+		Media          *gcast.MediaInformation `json:"media"`
+		Autoplay       *bool                   `json:"autoplay"`
+		MediaSessionID int                     `json:"mediaSessionId"`
+		CurrentTime    float64                 `json:"currentTime"`
+		ResumeState    string                  `json:"resumeState"`
+	}
+	if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+		c.Reply(msg, &castv2.Header{RequestID: h.RequestID, Type: gcast.TypeInvalidRequest})
+		return
+	}
+
+	s.mu.Lock()
+	if s.app == nil || msg.DestinationID != s.app.TransportID {
+		s.mu.Unlock()
+		return
+	}
+
+	switch h.Type {
+	case castv2.TypeGetStatus:
+		s.mu.Unlock()
+		c.Reply(msg, s.mediaStatus(h.RequestID))
+		return
+	case castv2.TypeLoad:
+		if req.Media == nil {
+			s.mu.Unlock()
+			c.Reply(msg, &castv2.Header{RequestID: h.RequestID, Type: gcast.TypeLoadFailed})
+			return
+		}
+
+		state := "PLAYING"
+		if req.Autoplay != nil && !*req.Autoplay {
+			state = "PAUSED"
+		}
+
+		s.lastSessionID++
+		s.session = &gcast.MediaSession{
+			MediaSessionID:         s.lastSessionID,
+			Media:                  req.Media,
+			PlaybackRate:           1,
+			PlayerState:            state,
+			CurrentTime:            req.CurrentTime,
+			SupportedMediaCommands: s.commands,
+		}
+	default:
+		if s.session == nil || s.session.MediaSessionID != req.MediaSessionID {
+			s.mu.Unlock()
+			c.Reply(msg, &struct {
+				castv2.Header
+				Reason string `json:"reason"`
+			}{castv2.Header{RequestID: h.RequestID, Type: gcast.TypeInvalidRequest}, "INVALID_MEDIA_SESSION_ID"})
+			return
+		}
+
+		s.session = s.currentSession()
+		switch h.Type {
+		case castv2.TypePlay:
+			s.session.PlayerState = "PLAYING"
+		case castv2.TypePause:
+			s.session.PlayerState = "PAUSED"
+		case castv2.TypeStop:
+			s.session.PlayerState = "IDLE"
+			s.session.IdleReason = "CANCELLED"
+		case castv2.TypeSeek:
+			s.session.CurrentTime = req.CurrentTime
+			switch req.ResumeState {
+			case "PLAYBACK_START":
+				s.session.PlayerState = "PLAYING"
+			case "PLAYBACK_PAUSE":
+				s.session.PlayerState = "PAUSED"
+			}
+		default:
+			s.mu.Unlock()
+			c.Reply(msg, &castv2.Header{RequestID: h.RequestID, Type: gcast.TypeInvalidRequest})
+			return
+		}
+	}
+	s.updatedAt = time.Now()
+	s.mu.Unlock()
+
+	c.Reply(msg, s.mediaStatus(h.RequestID))
+	s.broadcastMediaStatus(c)
+}
+
+// groupMember returns the group member. The caller must hold s.mu.
+func (s *Server) groupMember(deviceID string) *gcast.GroupMember {
+	for _, m := range s.members {
+		if m.DeviceID == deviceID {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func copyMember(m *gcast.GroupMember) *gcast.GroupMember {
+	member := *m
+	if m.Volume != nil {
+		vol := *m.Volume
+		member.Volume = &vol
+	}
+
+	return &member
+}
+
+func deviceUpdated(reqID uint64, m *gcast.GroupMember) interface{} {
+	return &struct {
+		castv2.Header
+		Device *gcast.GroupMember `json:"device"`
+	}{castv2.Header{RequestID: reqID, Type: castv2.TypeDeviceUpdated}, copyMember(m)}
+}
+
+func (s *Server) handleMultizoneMsg(c *castv2.Conn, msg *castv2.Msg, h castv2.Header) {
+	switch h.Type {
+	case castv2.TypeGetStatus:
+		s.mu.Lock()
+		status := &gcast.MultizoneStatus{Header: castv2.Header{RequestID: h.RequestID, Type: castv2.TypeMultizoneStatus}}
+		status.Status.Devices = make([]*gcast.GroupMember, len(s.members))
+		for i, m := range s.members {
+			status.Status.Devices[i] = copyMember(m)
+		}
+		s.mu.Unlock()
+
+		c.Reply(msg, status)
+	case castv2.TypeSetDeviceVolume:
+		var req struct {
+			DeviceID string `json:"deviceId"`
+			Volume   struct {
+				Level *float64 `json:"level"`
+				Muted *bool    `json:"muted"`
+			} `json:"volume"`
+		}
+		json.Unmarshal([]byte(msg.Payload), &req)
+
+		s.mu.Lock()
+		m := s.groupMember(req.DeviceID)
+		if m == nil {
+			s.mu.Unlock()
+			c.Reply(msg, &castv2.Header{RequestID: h.RequestID, Type: gcast.TypeInvalidRequest})
+			return
+		}
+		if req.Volume.Level != nil {
+			m.Volume.Level = *req.Volume.Level
+		}
+		if req.Volume.Muted != nil {
+			m.Volume.Muted = *req.Volume.Muted
+		}
+		reply, update := deviceUpdated(h.RequestID, m), deviceUpdated(0, m)
+		s.mu.Unlock()
+
+		c.Reply(msg, reply)
+		s.broadcast(c, castv2.PlatformReceiverID, castv2.NamespaceMultizone, update)
+	default:
+		c.Reply(msg, &castv2.Header{RequestID: h.RequestID, Type: gcast.TypeInvalidRequest})
+	}
+}
+
+// currentSession returns a copy of the media session with the playback
+// position brought up to date. The caller must hold s.mu.
+func (s *Server) currentSession() *gcast.MediaSession {
+	if s.session == nil {
+		return nil
+	}
+
+	session := *s.session
+	if session.PlayerState == "PLAYING" {
+		session.CurrentTime += time.Since(s.updatedAt).Seconds() * float64(session.PlaybackRate)
+	}
+
+	return &session
+}
+
+func (s *Server) receiverStatus(reqID uint64) *gcast.ReceiverStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rs := &gcast.ReceiverStatus{Header: castv2.Header{RequestID: reqID, Type: castv2.TypeReceiverStatus}}
+	if s.app != nil {
+		app := *s.app
+		rs.Status.Applications = []*gcast.ReceiverApplication{&app}
+	}
+	vol := s.vol
+	rs.Status.Volume = &vol
+
+	return rs
+}
+
+func (s *Server) mediaStatus(reqID uint64) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := &struct {
+		castv2.Header
+		gcast.MediaStatus
+	}{Header: castv2.Header{RequestID: reqID, Type: castv2.TypeMediaStatus}}
+
+	ms.Status = []*gcast.MediaSession{}
+	if session := s.currentSession(); session != nil {
+		ms.Status = append(ms.Status, session)
+	}
+
+	return ms
+}
+
+// broadcast sends the payload to all connections except the given one.
+func (s *Server) broadcast(except *castv2.Conn, srcID, namespace string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	s.cs.Broadcast(&castv2.Msg{
+		SourceID:      srcID,
+		DestinationID: "*",
+		Namespace:     namespace,
+		Payload:       string(data),
+	}, except)
+}
+
+func (s *Server) broadcastReceiverStatus(except *castv2.Conn) {
+	s.broadcast(except, castv2.PlatformReceiverID, castv2.NamespaceReceiver, s.receiverStatus(0))
+}
+
+func (s *Server) broadcastMediaStatus(except *castv2.Conn) {
+	app := s.Application()
+	if app == nil {
+		return
+	}
+
+	s.broadcast(except, app.TransportID, castv2.NamespaceMedia, s.mediaStatus(0))
+}
@@ -0,0 +1,170 @@
+package castv2
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha1"   // for crypto.SHA1
+	_ "crypto/sha256" // for crypto.SHA256
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	"github.com/ericyan/omnicast/gcast/internal/castv2/cast_channel"
+)
+
+// authTimeout is the maximum time to wait for the reply to the device
+// authentication challenge.
+const authTimeout = 5 * time.Second
+
+// An AuthError is returned when the device fails to prove that it is a
+// genuine Cast device.
+type AuthError struct {
+	Reason string
+}
+
+// Error implements the error interface.
+func (err *AuthError) Error() string {
+	return "castv2: device authentication failed: " + err.Reason
+}
+
+// authenticate sends a device authentication challenge over the TLS
+// connection, and verifies the response against the trusted roots. It
+// must be called before any other message is exchanged.
+func authenticate(conn *tls.Conn, roots *x509.CertPool) error {
+	peerCerts := conn.ConnectionState().PeerCertificates
+	if len(peerCerts) == 0 {
+		return &AuthError{"no peer certificate"}
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	challenge := &cast_channel.DeviceAuthMessage{
+		Challenge: &cast_channel.AuthChallenge{
+			SignatureAlgorithm: cast_channel.SignatureAlgorithm_RSASSA_PKCS1v15.Enum(),
+			SenderNonce:        nonce,
+			HashAlgorithm:      cast_channel.HashAlgorithm_SHA256.Enum(),
+		},
+	}
+	data, err := proto.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+
+	err = WriteMsg(conn, &Msg{
+		SourceID:      PlatformSenderID,
+		DestinationID: PlatformReceiverID,
+		Namespace:     NamespaceDeviceAuth,
+		PayloadBinary: data,
+	})
+	if err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(authTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	for {
+		msg, err := ReadMsg(conn)
+		if err != nil {
+			return err
+		}
+		if msg.Namespace != NamespaceDeviceAuth {
+			continue
+		}
+
+		resp := new(cast_channel.DeviceAuthMessage)
+		if err := proto.Unmarshal(msg.PayloadBinary, resp); err != nil {
+			return &AuthError{"malformed response"}
+		}
+		if resp.Error != nil {
+			switch resp.Error.GetErrorType() {
+			case cast_channel.AuthError_NO_TLS:
+				return &AuthError{"no TLS"}
+			case cast_channel.AuthError_SIGNATURE_ALGORITHM_UNAVAILABLE:
+				return &AuthError{"signature algorithm unavailable"}
+			default:
+				return &AuthError{"internal error"}
+			}
+		}
+		if resp.Response == nil {
+			return &AuthError{"empty response"}
+		}
+
+		return verifyAuthResponse(resp.Response, nonce, peerCerts[0].Raw, roots, time.Now())
+	}
+}
+
+// verifyAuthResponse checks that the device certificate chains up to one
+// of the roots, and that the device signed its TLS certificate with it.
+//
+// Devices with older firmware sign the TLS certificate only, without the
+// sender nonce. Their responses are accepted, as the signature is still
+// bound to the TLS certificate, whose private key an impostor lacks.
+func verifyAuthResponse(resp *cast_channel.AuthResponse, nonce, peerCert []byte, roots *x509.CertPool, now time.Time) error {
+	cert, err := x509.ParseCertificate(resp.GetClientAuthCertificate())
+	if err != nil {
+		return &AuthError{"invalid device certificate"}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, der := range resp.GetIntermediateCertificate() {
+		ic, err := x509.ParseCertificate(der)
+		if err != nil {
+			return &AuthError{"invalid intermediate certificate"}
+		}
+		intermediates.AddCert(ic)
+	}
+
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return &AuthError{err.Error()}
+	}
+
+	var data []byte
+	if n := resp.GetSenderNonce(); len(n) > 0 {
+		if !bytes.Equal(n, nonce) {
+			return &AuthError{"sender nonce mismatch"}
+		}
+		data = append(data, n...)
+	}
+	data = append(data, peerCert...)
+
+	hash := crypto.SHA1
+	if resp.GetHashAlgorithm() == cast_channel.HashAlgorithm_SHA256 {
+		hash = crypto.SHA256
+	}
+	h := hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return &AuthError{"unsupported public key"}
+	}
+
+	switch resp.GetSignatureAlgorithm() {
+	case cast_channel.SignatureAlgorithm_RSASSA_PKCS1v15:
+		err = rsa.VerifyPKCS1v15(pub, hash, digest, resp.GetSignature())
+	case cast_channel.SignatureAlgorithm_RSASSA_PSS:
+		err = rsa.VerifyPSS(pub, hash, digest, resp.GetSignature(), nil)
+	default:
+		return &AuthError{"unsupported signature algorithm"}
+	}
+	if err != nil {
+		return &AuthError{"invalid signature"}
+	}
+
+	return nil
+}
@@ -3,8 +3,10 @@
 package castv2
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 
 	"github.com/gogo/protobuf/proto"
 
@@ -23,32 +25,42 @@ const (
 	NamespaceHeartbeat  = "urn:x-cast:com.google.cast.tp.heartbeat"
 	NamespaceReceiver   = "urn:x-cast:com.google.cast.receiver"
 	NamespaceMedia      = "urn:x-cast:com.google.cast.media"
+	NamespaceDeviceAuth = "urn:x-cast:com.google.cast.tp.deviceauth"
+	NamespaceMultizone  = "urn:x-cast:com.google.cast.multizone"
 )
 
 // Cast application protocol message types.
 const (
-	TypeConnect        = "CONNECT"
-	TypeClose          = "CLOSE"
-	TypePing           = "PING"
-	TypePong           = "PONG"
-	TypeGetStatus      = "GET_STATUS"
-	TypeReceiverStatus = "RECEIVER_STATUS"
-	TypeMediaStatus    = "MEDIA_STATUS"
-	TypeLaunch         = "LAUNCH"
-	TypeLoad           = "LOAD"
-	TypePlay           = "PLAY"
-	TypePause          = "PAUSE"
-	TypeStop           = "STOP"
-	TypeSeek           = "SEEK"
-	TypeSetVolume      = "SET_VOLUME"
+	TypeConnect            = "CONNECT"
+	TypeClose              = "CLOSE"
+	TypePing               = "PING"
+	TypePong               = "PONG"
+	TypeGetStatus          = "GET_STATUS"
+	TypeReceiverStatus     = "RECEIVER_STATUS"
+	TypeMediaStatus        = "MEDIA_STATUS"
+	TypeLaunch             = "LAUNCH"
+	TypeLoad               = "LOAD"
+	TypePlay               = "PLAY"
+	TypePause              = "PAUSE"
+	TypeStop               = "STOP"
+	TypeSeek               = "SEEK"
+	TypeSetVolume          = "SET_VOLUME"
+	TypeGetAppAvailability = "GET_APP_AVAILABILITY"
+	TypeMultizoneStatus    = "MULTIZONE_STATUS"
+	TypeDeviceAdded        = "DEVICE_ADDED"
+	TypeDeviceUpdated      = "DEVICE_UPDATED"
+	TypeDeviceRemoved      = "DEVICE_REMOVED"
+	TypeSetDeviceVolume    = "SET_DEVICE_VOLUME"
 )
 
-// Msg is a Cast V2 protocol data unit with textual payload.
+// Msg is a Cast V2 protocol data unit. The payload is textual, unless
+// PayloadBinary is set.
 type Msg struct {
 	SourceID      string
 	DestinationID string
 	Namespace     string
 	Payload       string
+	PayloadBinary []byte
 }
 
 // UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
@@ -61,9 +73,16 @@ func (m *Msg) UnmarshalBinary(data []byte) error {
 	m.SourceID = cm.GetSourceId()
 	m.DestinationID = cm.GetDestinationId()
 	m.Namespace = cm.GetNamespace()
-	m.Payload = cm.GetPayloadUtf8()
 
-	if cm.GetPayloadType() != cast_channel.CastMessage_STRING {
+	switch cm.GetPayloadType() {
+	case cast_channel.CastMessage_STRING:
+		m.Payload = cm.GetPayloadUtf8()
+	case cast_channel.CastMessage_BINARY:
+		m.PayloadBinary = cm.GetPayloadBinary()
+		if m.PayloadBinary == nil {
+			m.PayloadBinary = []byte{}
+		}
+	default:
 		return errors.New("unspported payload type")
 	}
 
@@ -77,8 +96,14 @@ func (m *Msg) MarshalBinary() ([]byte, error) {
 		SourceId:        &m.SourceID,
 		DestinationId:   &m.DestinationID,
 		Namespace:       &m.Namespace,
-		PayloadType:     cast_channel.CastMessage_STRING.Enum(),
-		PayloadUtf8:     &m.Payload,
+	}
+
+	if m.PayloadBinary != nil {
+		cm.PayloadType = cast_channel.CastMessage_BINARY.Enum()
+		cm.PayloadBinary = m.PayloadBinary
+	} else {
+		cm.PayloadType = cast_channel.CastMessage_STRING.Enum()
+		cm.PayloadUtf8 = &m.Payload
 	}
 
 	return proto.Marshal(cm)
@@ -86,9 +111,58 @@ func (m *Msg) MarshalBinary() ([]byte, error) {
 
 // String implements the fmt.Stringer interface.
 func (m *Msg) String() string {
+	if m.PayloadBinary != nil {
+		return fmt.Sprintf("%s -> %s [%s] (%d bytes)", m.SourceID, m.DestinationID, m.Namespace, len(m.PayloadBinary))
+	}
+
 	return fmt.Sprintf("%s -> %s [%s] %s", m.SourceID, m.DestinationID, m.Namespace, m.Payload)
 }
 
+// MaxMsgSize is the maximum size of a message, which is 64 KiB according
+// to the protocol.
+const MaxMsgSize = 64 << 10
+
+// ErrMsgTooLarge is returned when reading a message larger than MaxMsgSize.
+var ErrMsgTooLarge = errors.New("castv2: message too large")
+
+// ReadMsg reads a length-prefixed message from r.
+func ReadMsg(r io.Reader) (*Msg, error) {
+	// Each message is prefixed withs its length as a big-endian uint32.
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	if n > MaxMsgSize {
+		return nil, ErrMsgTooLarge
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	msg := new(Msg)
+	err := msg.UnmarshalBinary(buf)
+
+	return msg, err
+}
+
+// WriteMsg writes the message to w, prefixed with its length.
+func WriteMsg(w io.Writer, msg *Msg) error {
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	// Write the prefix and the message at once, so that messages written
+	// concurrently will not interleave.
+	buf := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	_, err = w.Write(append(buf, data...))
+
+	return err
+}
+
 // Header contains the required fields in most payload types.
 type Header struct {
 	RequestID uint64 `json:"requestId,omitempty"`
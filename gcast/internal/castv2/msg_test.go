@@ -0,0 +1,31 @@
+package castv2_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ericyan/omnicast/gcast/internal/castv2"
+)
+
+func TestReadMsg(t *testing.T) {
+	buf := new(bytes.Buffer)
+	msg := &castv2.Msg{SourceID: "sender-0", DestinationID: "receiver-0", Namespace: castv2.NamespaceHeartbeat, Payload: `{"type":"PING"}`}
+	if err := castv2.WriteMsg(buf, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := castv2.ReadMsg(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SourceID != msg.SourceID || got.Namespace != msg.Namespace || got.Payload != msg.Payload {
+		t.Errorf("Unexpected message: %s", got)
+	}
+
+	buf.Reset()
+	binary.Write(buf, binary.BigEndian, uint32(castv2.MaxMsgSize+1))
+	if _, err := castv2.ReadMsg(buf); err != castv2.ErrMsgTooLarge {
+		t.Errorf("Unexpected error for oversized message: %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package castv2
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+// heartbeatTimeout is the maximum time a sender can stay silent before
+// its connection is closed. Senders ping every 5 seconds.
+const heartbeatTimeout = 10 * time.Second
+
+// ErrServerClosed is returned by the Server's Serve and ListenAndServe
+// methods after a call to Close.
+var ErrServerClosed = errors.New("castv2: server closed")
+
+// A Handler responds to messages received by a Server.
+type Handler interface {
+	ServeCast(c *Conn, msg *Msg)
+}
+
+// The HandlerFunc type is an adapter to allow the use of ordinary
+// functions as handlers.
+type HandlerFunc func(c *Conn, msg *Msg)
+
+// ServeCast calls f(c, msg).
+func (f HandlerFunc) ServeCast(c *Conn, msg *Msg) {
+	f(c, msg)
+}
+
+// A Conn is a connection from a sender to the Server.
+type Conn struct {
+	conn net.Conn
+	cert []byte
+
+	mu     sync.Mutex
+	vconns map[vconn]struct{}
+}
+
+// Send sends the message to the sender.
+func (c *Conn) Send(msg *Msg) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return WriteMsg(c.conn, msg)
+}
+
+// Reply sends the payload back to the sender of the request, in the same
+// namespace.
+func (c *Conn) Reply(req *Msg, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return c.Send(&Msg{
+		SourceID:      req.DestinationID,
+		DestinationID: req.SourceID,
+		Namespace:     req.Namespace,
+		Payload:       string(data),
+	})
+}
+
+// Certificate returns the TLS certificate presented to the sender, in DER
+// format, which is signed over in device authentication.
+func (c *Conn) Certificate() []byte {
+	return c.cert
+}
+
+// isConnected returns true if the virtual connection has been established.
+func (c *Conn) isConnected(vc vconn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.vconns[vc]
+	return ok
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// A Server accepts Cast V2 connections from senders. Messages in the
+// connection and heartbeat namespaces are handled by the Server itself,
+// and the others are passed to the Handler. Like real devices, messages
+// on virtual connections not established by senders are ignored, except
+// for device authentication which happens before any connection.
+type Server struct {
+	Addr      string
+	Handler   Handler
+	TLSConfig *tls.Config
+
+	mu     sync.Mutex
+	ln     net.Listener
+	conns  map[*Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// ListenAndServe listens on the TCP network address s.Addr and then calls
+// Serve to handle incoming connections.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ln)
+}
+
+// Serve accepts incoming connections on the listener, which will be
+// wrapped with TLS. If TLSConfig is nil, a self-signed certificate will
+// be used, as senders do not verify it.
+func (s *Server) Serve(ln net.Listener) error {
+	config := s.TLSConfig
+	if config == nil {
+		cert, err := SelfSignedCertificate()
+		if err != nil {
+			return err
+		}
+
+		config = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	ln = tls.NewListener(ln, config)
+
+	var cert []byte
+	if len(config.Certificates) > 0 && len(config.Certificates[0].Certificate) > 0 {
+		cert = config.Certificates[0].Certificate[0]
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.ln = ln
+	if s.conns == nil {
+		s.conns = make(map[*Conn]struct{})
+	}
+	s.mu.Unlock()
+
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+
+			if closed {
+				return ErrServerClosed
+			}
+
+			if nerr, ok := err.(net.Error); ok && nerr.Temporary() {
+				continue
+			}
+
+			return err
+		}
+
+		c := &Conn{conn: nc, cert: cert, vconns: make(map[vconn]struct{})}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return ErrServerClosed
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(c)
+	}
+}
+
+func (s *Server) serveConn(c *Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+
+		c.Close()
+	}()
+
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(heartbeatTimeout))
+
+		msg, err := ReadMsg(c.conn)
+		if err != nil {
+			return
+		}
+
+		vc := vconn{msg.DestinationID, msg.SourceID}
+		if msg.PayloadBinary != nil {
+			if msg.Namespace == NamespaceDeviceAuth || c.isConnected(vc) {
+				s.Handler.ServeCast(c, msg)
+			}
+
+			continue
+		}
+
+		var h Header
+		if err := json.Unmarshal([]byte(msg.Payload), &h); err != nil {
+			log.Printf("castv2: unexpected payload: %s\n", msg.Payload)
+			continue
+		}
+
+		switch msg.Namespace {
+		case NamespaceConnection:
+			c.mu.Lock()
+			switch h.Type {
+			case TypeConnect:
+				c.vconns[vc] = struct{}{}
+			case TypeClose:
+				delete(c.vconns, vc)
+			}
+			c.mu.Unlock()
+		case NamespaceHeartbeat:
+			if h.Type == TypePing {
+				c.Send(vc.NewPongMsg())
+			}
+		default:
+			if c.isConnected(vc) {
+				s.Handler.ServeCast(c, msg)
+			}
+		}
+	}
+}
+
+// Broadcast sends the message to all connections, except the given one
+// if not nil. The destination ID of the message should be "*".
+func (s *Server) Broadcast(msg *Msg, except *Conn) {
+	s.mu.Lock()
+	conns := make([]*Conn, 0, len(s.conns))
+	for c := range s.conns {
+		if c != except {
+			conns = append(conns, c)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.Send(msg)
+	}
+}
+
+// Close closes the listener and all connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return err
+}
+
+// SelfSignedCertificate generates a throwaway certificate for receivers.
+func SelfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "omnicast"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(48 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -2,14 +2,32 @@ package castv2
 
 import (
 	"crypto/tls"
-	"encoding/binary"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
-	"io"
 	"log"
 	"net"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/ericyan/omnicast/metrics"
+)
+
+var (
+	messages = metrics.NewCounter(
+		"omnicast_cast_messages_total",
+		"Cast messages sent and received by channels, by namespace and type.",
+		"direction", "namespace", "type",
+	)
+	heartbeatTimeouts = metrics.NewCounter(
+		"omnicast_cast_heartbeat_timeouts_total",
+		"Channels closed for not hearing from the receiver in time.",
+	)
+	pendingRequests = metrics.NewGauge(
+		"omnicast_cast_pending_requests",
+		"Requests sent by channels and waiting for replies.",
+	)
 )
 
 // A vconn is a virtual connection represented by a pair of source and
@@ -24,7 +42,7 @@ func (vc vconn) buildPayload(msgType string) string {
 }
 
 func (vc vconn) NewMsg(namespace, payload string) *Msg {
-	return &Msg{vc.LocalID, vc.RemoteID, namespace, payload}
+	return &Msg{SourceID: vc.LocalID, DestinationID: vc.RemoteID, Namespace: namespace, Payload: payload}
 }
 
 func (vc vconn) NewConnectMsg() *Msg {
@@ -49,24 +67,40 @@ func (vc vconn) NewPongMsg() *Msg {
 // to a new source and destination ID pair, a virtual connection will be
 // automatically established and keeped alive.
 type Channel struct {
-	conn          *tls.Conn
-	done          chan struct{}
+	conn      *tls.Conn
+	done      chan struct{}
+	heartbeat *time.Ticker
+	lastReqID uint64
+
+	// mu guards the fields below, which are shared by the callers and
+	// the listening and keepalive goroutines.
+	mu            sync.Mutex
+	closed        bool
 	vconns        map[vconn]struct{}
-	heartbeat     *time.Ticker
 	lastMsgAt     time.Time
-	lastReqID     uint64
 	pendingReqs   map[uint64]chan *Msg
 	subscriptions map[uint64]chan *Msg
 }
 
 // Dial connects to the remote receiver and returns a new Channel.
-func Dial(addr *net.TCPAddr) (*Channel, error) {
+//
+// Cast devices use self-signed TLS certificates, so the TLS certificate
+// is not verified. Instead, if roots is not nil, the device has to pass
+// device authentication with a certificate chaining up to the roots.
+func Dial(addr *net.TCPAddr, roots *x509.CertPool) (*Channel, error) {
 	dialer := &net.Dialer{Timeout: time.Duration(2 * time.Second)}
 	conn, err := tls.DialWithDialer(dialer, addr.Network(), addr.String(), &tls.Config{InsecureSkipVerify: true})
 	if err != nil {
 		return nil, err
 	}
 
+	if roots != nil {
+		if err := authenticate(conn, roots); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
 	c := &Channel{
 		conn:          conn,
 		done:          make(chan struct{}),
@@ -86,39 +120,34 @@ func Dial(addr *net.TCPAddr) (*Channel, error) {
 
 // readMsg reads a message from the channel and blocks until it returns.
 func (c *Channel) readMsg() (*Msg, error) {
-	// Each message is prefixed withs its length as a big-endian uint32.
-	var n uint32
-	if err := binary.Read(c.conn, binary.BigEndian, &n); err != nil {
-		return nil, err
-	}
-
-	buf := make([]byte, n)
-	if _, err := io.ReadFull(c.conn, buf); err != nil {
+	msg, err := ReadMsg(c.conn)
+	if err != nil {
 		return nil, err
 	}
+	countMsg("in", msg)
 
-	msg := new(Msg)
-	err := msg.UnmarshalBinary(buf)
-
-	return msg, err
+	return msg, nil
 }
 
 // writeMsg sends the message over the wire.
 func (c *Channel) writeMsg(msg *Msg) error {
-	data, err := msg.MarshalBinary()
-	if err != nil {
+	if err := WriteMsg(c.conn, msg); err != nil {
 		return err
 	}
+	countMsg("out", msg)
 
-	if err := binary.Write(c.conn, binary.BigEndian, uint32(len(data))); err != nil {
-		return err
-	}
+	return nil
+}
 
-	if _, err := c.conn.Write(data); err != nil {
-		return err
+// countMsg records the message in the metrics. The type is empty if the
+// payload is binary or not JSON.
+func countMsg(direction string, msg *Msg) {
+	var p Header
+	if msg.PayloadBinary == nil {
+		json.Unmarshal([]byte(msg.Payload), &p)
 	}
 
-	return nil
+	messages.Inc(direction, msg.Namespace, p.Type)
 }
 
 func (c *Channel) listen() {
@@ -138,11 +167,22 @@ func (c *Channel) listen() {
 				return
 			}
 
+			c.mu.Lock()
 			c.lastMsgAt = time.Now()
+			c.mu.Unlock()
+
+			// Binary payloads are only used by applications, which define
+			// their own protocol on top.
+			if msg.PayloadBinary != nil {
+				log.Println("[DEBUG] castv2:", msg)
+				c.publish(msg)
+				continue
+			}
 
 			var p Header
 			if err := json.Unmarshal([]byte(msg.Payload), &p); err != nil {
-				log.Printf("unexpected payload: %s\n", msg.Payload)
+				log.Println("[DEBUG] castv2:", msg)
+				c.publish(msg)
 				continue
 			}
 
@@ -156,10 +196,12 @@ func (c *Channel) listen() {
 				continue
 			case NamespaceConnection:
 				if p.Type == TypeClose {
+					c.mu.Lock()
 					if _, ok := c.vconns[vc]; ok {
 						log.Println("Closing virtual connection:", msg)
 						delete(c.vconns, vc)
 					}
+					c.mu.Unlock()
 				}
 
 				continue
@@ -167,45 +209,75 @@ func (c *Channel) listen() {
 
 			log.Println("[DEBUG] castv2:", msg)
 
-			if msg.DestinationID == "*" {
-				for _, sub := range c.subscriptions {
-					if sub != nil {
-						sub <- msg
-					}
+			if msg.DestinationID != "*" && p.RequestID != 0 {
+				c.mu.Lock()
+				ch, ok := c.pendingReqs[p.RequestID]
+				if ok {
+					delete(c.pendingReqs, p.RequestID)
+					pendingRequests.Dec()
 				}
+				c.mu.Unlock()
 
-				continue
+				if ok {
+					ch <- msg
+					continue
+				}
 			}
 
-			if ch, ok := c.pendingReqs[p.RequestID]; ok {
-				ch <- msg
-				delete(c.pendingReqs, p.RequestID)
-				continue
-			}
+			// Broadcasts, and messages which are not replies to pending
+			// requests, such as those sent by applications on their own.
+			c.publish(msg)
+		}
+	}
+}
+
+// publish delivers the message to all subscriptions. The lock is not
+// held while delivering, as subscribers may send requests in turn.
+func (c *Channel) publish(msg *Msg) {
+	c.mu.Lock()
+	subs := make([]chan *Msg, 0, len(c.subscriptions))
+	for _, sub := range c.subscriptions {
+		if sub != nil {
+			subs = append(subs, sub)
 		}
 	}
+	c.mu.Unlock()
+
+	for _, sub := range subs {
+		sub <- msg
+	}
 }
 
 func (c *Channel) keepalive() {
 	for range c.heartbeat.C {
-		if time.Since(c.lastMsgAt).Seconds() > 10 {
+		c.mu.Lock()
+		timeout := time.Since(c.lastMsgAt).Seconds() > 10
+		c.mu.Unlock()
+
+		if timeout {
 			log.Println("gcast: timeout, closing channel...")
+			heartbeatTimeouts.Inc()
 			c.Close()
 			return
 		}
 
+		c.mu.Lock()
 		for vc := range c.vconns {
 			c.writeMsg(vc.NewPingMsg())
 		}
+		c.mu.Unlock()
 	}
 }
 
 // Close terminates all established virtual connections and then closes
 // the underying TLS connection.
 func (c *Channel) Close() error {
-	if c.IsClosed() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
 		return nil
 	}
+	c.closed = true
 
 	// Stop heartbeats
 	c.heartbeat.Stop()
@@ -215,44 +287,79 @@ func (c *Channel) Close() error {
 		delete(c.vconns, vc)
 		c.writeMsg(vc.NewCloseMsg())
 	}
+	c.mu.Unlock()
 
-	// Stop listening
+	// Stop listening, without holding the lock which listen may need
 	c.conn.SetReadDeadline(time.Now().Add(1 * time.Second))
 	c.done <- struct{}{}
 	<-c.done
 
 	// Purge pending requests
+	c.mu.Lock()
 	for reqID, ch := range c.pendingReqs {
 		close(ch)
 		delete(c.pendingReqs, reqID)
+		pendingRequests.Dec()
 	}
+	c.mu.Unlock()
 
 	// Close connection
-	err := c.conn.Close()
-	c.conn = nil
-
-	return err
+	return c.conn.Close()
 }
 
 // IsClosed returns true if the underlying connection has been closed.
 func (c *Channel) IsClosed() bool {
-	return c.conn == nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closed
 }
 
-// Request sends a request
-func (c *Channel) Request(srcID, descID, namespace string, req Request, respCh chan *Msg) error {
-	if c.IsClosed() {
+// connect establishes the virtual connection, if not yet established.
+// The caller must hold the lock.
+func (c *Channel) connect(vc vconn) error {
+	if _, ok := c.vconns[vc]; ok {
+		return nil
+	}
+
+	if err := c.writeMsg(vc.NewConnectMsg()); err != nil {
+		return err
+	}
+	c.vconns[vc] = struct{}{}
+
+	return nil
+}
+
+// Send sends the message as is, over the virtual connection between its
+// source and destination ID.
+func (c *Channel) Send(msg *Msg) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
 		return errors.New("gcast channel closed")
 	}
 
-	vc := vconn{srcID, descID}
-	if _, ok := c.vconns[vc]; !ok {
-		err := c.writeMsg(vc.NewConnectMsg())
-		if err != nil {
-			return err
-		}
+	if err := c.connect(vconn{msg.SourceID, msg.DestinationID}); err != nil {
+		return err
+	}
+
+	return c.writeMsg(msg)
+}
+
+// Request sends a request, and returns its ID. The reply, if respCh is
+// not nil, will be delivered to respCh unless the request is cancelled.
+func (c *Channel) Request(srcID, descID, namespace string, req Request, respCh chan *Msg) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		c.vconns[vc] = struct{}{}
+	if c.closed {
+		return 0, errors.New("gcast channel closed")
+	}
+
+	vc := vconn{srcID, descID}
+	if err := c.connect(vc); err != nil {
+		return 0, err
 	}
 
 	reqID := atomic.AddUint64(&c.lastReqID, 1)
@@ -260,19 +367,46 @@ func (c *Channel) Request(srcID, descID, namespace string, req Request, respCh c
 
 	payload, err := json.Marshal(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if respCh != nil {
 		c.pendingReqs[reqID] = respCh
+		pendingRequests.Inc()
+	}
+
+	if err := c.writeMsg(vc.NewMsg(namespace, string(payload))); err != nil {
+		c.cancel(reqID)
+		return 0, err
 	}
 
-	return c.writeMsg(vc.NewMsg(namespace, string(payload)))
+	return reqID, nil
 }
 
-// Subscribe registers a subscription to broadcast messages. It returns
+// Cancel stops waiting for the reply to the pending request. A late
+// reply will be treated as if it was not a reply.
+func (c *Channel) Cancel(reqID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cancel(reqID)
+}
+
+// cancel removes the pending request. The caller must hold the lock.
+func (c *Channel) cancel(reqID uint64) {
+	if _, ok := c.pendingReqs[reqID]; ok {
+		delete(c.pendingReqs, reqID)
+		pendingRequests.Dec()
+	}
+}
+
+// Subscribe registers a subscription to broadcast messages and all other
+// messages which are not replies to pending requests. It returns
 // an identifier for identifying the subscription when unsubscribing.
 func (c *Channel) Subscribe(ch chan *Msg) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	id := uint64(len(c.subscriptions) + 1)
 	c.subscriptions[id] = ch
 
@@ -282,6 +416,9 @@ func (c *Channel) Subscribe(ch chan *Msg) (uint64, error) {
 // Unsubscribe unregisters the subscription and closes the subscription
 // channel.
 func (c *Channel) Unsubscribe(subID uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	ch, ok := c.subscriptions[subID]
 	if !ok {
 		return errors.New("subscription not found")
@@ -0,0 +1,191 @@
+package gcast
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/ericyan/omnicast/gcast/internal/castv2"
+)
+
+// ErrInvalidNamespace is returned when sending messages in a namespace
+// not following the urn:x-cast: scheme.
+var ErrInvalidNamespace = errors.New("invalid namespace")
+
+// A Message is exchanged with a receiver application, in a namespace
+// defined by the application. The payload is textual, usually JSON,
+// unless PayloadBinary is set.
+type Message struct {
+	SourceID      string
+	DestinationID string
+	Namespace     string
+	Payload       string
+	PayloadBinary []byte
+}
+
+// IsBinary returns true if the message has a binary payload.
+func (m *Message) IsBinary() bool {
+	return m.PayloadBinary != nil
+}
+
+// Unmarshal parses the JSON payload and stores the result in the value
+// pointed to by v.
+func (m *Message) Unmarshal(v interface{}) error {
+	return json.Unmarshal([]byte(m.Payload), v)
+}
+
+// A MessageHandler handles messages received in a namespace. Handlers
+// are called sequentially, on a goroutine other than the one receiving
+// messages, so they may send requests and wait for the replies, e.g. by
+// calling Sender.Play. Messages are queued until the handler returns.
+type MessageHandler func(msg *Message)
+
+// HandleNamespace registers the handler for messages received in the
+// namespace, replacing the existing one, if any. If h is nil, the handler
+// will be removed. Handlers for the platform and media namespaces are
+// called after the messages are processed by the Receiver.
+func (r *Receiver) HandleNamespace(namespace string, h MessageHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if h == nil {
+		delete(r.handlers, namespace)
+		return
+	}
+
+	if r.handlers == nil {
+		r.handlers = make(map[string]MessageHandler)
+	}
+	r.handlers[namespace] = h
+}
+
+// dispatch queues the message for the handler of its namespace, if any.
+// The queue is drained by a goroutine started on demand, so that status
+// updates and replies are never held up by handlers.
+func (r *Receiver) dispatch(msg *castv2.Msg) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.handlers[msg.Namespace]; !ok {
+		return
+	}
+
+	r.queue = append(r.queue, msg)
+	if !r.dispatching {
+		r.dispatching = true
+		go r.drain()
+	}
+}
+
+// drain passes the queued messages to their handlers in order, until the
+// queue is empty.
+func (r *Receiver) drain() {
+	for {
+		r.mu.Lock()
+		if len(r.queue) == 0 {
+			r.dispatching = false
+			r.mu.Unlock()
+			return
+		}
+		msg := r.queue[0]
+		r.queue[0] = nil
+		r.queue = r.queue[1:]
+		r.mu.Unlock()
+
+		r.handle(msg)
+	}
+}
+
+// handle passes the message to the handler of its namespace.
+func (r *Receiver) handle(msg *castv2.Msg) {
+	r.mu.Lock()
+	h := r.handlers[msg.Namespace]
+	r.mu.Unlock()
+
+	if h != nil {
+		h(&Message{
+			SourceID:      msg.SourceID,
+			DestinationID: msg.DestinationID,
+			Namespace:     msg.Namespace,
+			Payload:       msg.Payload,
+			PayloadBinary: msg.PayloadBinary,
+		})
+	}
+}
+
+// Send sends the message as is. A virtual connection between its source
+// and destination will be established first, if needed.
+func (r *Receiver) Send(msg *Message) error {
+	if !strings.HasPrefix(msg.Namespace, "urn:x-cast:") {
+		return ErrInvalidNamespace
+	}
+
+	if !r.IsConnected() {
+		return ErrReceiverNotReady
+	}
+
+	return r.ch.Send(&castv2.Msg{
+		SourceID:      msg.SourceID,
+		DestinationID: msg.DestinationID,
+		Namespace:     msg.Namespace,
+		Payload:       msg.Payload,
+		PayloadBinary: msg.PayloadBinary,
+	})
+}
+
+// SendJSON sends v encoded in JSON to the receiver application with the
+// given transport ID.
+func (r *Receiver) SendJSON(senderID, transportID, namespace string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return r.Send(&Message{
+		SourceID:      senderID,
+		DestinationID: transportID,
+		Namespace:     namespace,
+		Payload:       string(data),
+	})
+}
+
+// SendBinary sends the binary data to the receiver application with the
+// given transport ID.
+func (r *Receiver) SendBinary(senderID, transportID, namespace string, data []byte) error {
+	if data == nil {
+		data = []byte{}
+	}
+
+	return r.Send(&Message{
+		SourceID:      senderID,
+		DestinationID: transportID,
+		Namespace:     namespace,
+		PayloadBinary: data,
+	})
+}
+
+// HandleNamespace registers the handler for messages received in the
+// namespace. See Receiver.HandleNamespace for details.
+func (s *Sender) HandleNamespace(namespace string, h MessageHandler) {
+	s.r.HandleNamespace(namespace, h)
+}
+
+// SendJSON sends v encoded in JSON to the running receiver application.
+func (s *Sender) SendJSON(namespace string, v interface{}) error {
+	app := s.r.Application()
+	if app == nil {
+		return ErrReceiverNotReady
+	}
+
+	return s.r.SendJSON(s.ID, app.TransportID, namespace, v)
+}
+
+// SendBinary sends the binary data to the running receiver application.
+func (s *Sender) SendBinary(namespace string, data []byte) error {
+	app := s.r.Application()
+	if app == nil {
+		return ErrReceiverNotReady
+	}
+
+	return s.r.SendBinary(s.ID, app.TransportID, namespace, data)
+}
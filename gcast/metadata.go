@@ -1,51 +1,273 @@
 package gcast
 
-import "net/url"
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
 
-// MediaMetadata represents a generic media artifact.
+	"github.com/ericyan/omnicast"
+)
+
+// Cast metadata field names, by media type.
+//
+// Ref: https://developers.google.com/cast/docs/reference/messages#MediaData
+var metadataFields = map[omnicast.MediaType][]string{
+	omnicast.GenericMedia: {"title", "subtitle", "images", "releaseDate"},
+	omnicast.Movie:        {"title", "subtitle", "studio", "images", "releaseDate"},
+	omnicast.TVShow:       {"title", "seriesTitle", "subtitle", "season", "episode", "images", "originalAirdate"},
+	omnicast.MusicTrack:   {"albumName", "title", "albumArtist", "artist", "composer", "trackNumber", "discNumber", "images", "releaseDate"},
+	omnicast.Photo:        {"title", "artist", "location", "latitude", "longitude", "width", "height", "creationDateTime"},
+}
+
+// Image represents an image associated with a media artifact.
+//
+// Ref: https://developers.google.com/cast/docs/reference/messages#Image
+type Image struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// MediaMetadata represents the metadata of a media artifact, which can
+// be any of the Cast metadata types. The zero value describes a generic
+// media artifact without any details.
+//
+// Decoding is tolerant: fields with unexpected types are converted when
+// possible, and ignored otherwise.
 //
 // Ref: https://developers.google.com/cast/docs/reference/messages#GenericMediaMetadata
-//      https://developers.google.com/cast/docs/reference/messages#Image
-type MediaMetadata map[string]interface{}
+type MediaMetadata struct {
+	details omnicast.MediaDetails
+}
+
+// NewMediaMetadata returns the Cast metadata for the given details.
+func NewMediaMetadata(d *omnicast.MediaDetails) *MediaMetadata {
+	m := new(MediaMetadata)
+	if d != nil {
+		m.details = *d
+	}
+
+	return m
+}
 
 // Title returns the descriptive title of the content.
-func (m MediaMetadata) Title() string {
-	if _, ok := m["title"]; !ok {
+func (m *MediaMetadata) Title() string {
+	if m == nil {
 		return ""
 	}
 
-	return m["title"].(string)
+	return m.details.Title
 }
 
 // Subtitle returns the descriptive subtitle of the content.
-func (m MediaMetadata) Subtitle() string {
-	if _, ok := m["subtitle"]; !ok {
+func (m *MediaMetadata) Subtitle() string {
+	if m == nil {
 		return ""
 	}
 
-	return m["subtitle"].(string)
+	return m.details.Subtitle
 }
 
 // ImageURL returns the URL of the image.
-func (m MediaMetadata) ImageURL() *url.URL {
-	if _, ok := m["images"]; !ok {
+func (m *MediaMetadata) ImageURL() *url.URL {
+	if m == nil || len(m.details.Images) == 0 {
 		return nil
 	}
 
-	images := m["images"].([]interface{})
-	if len(images) == 0 {
-		return nil
+	return m.details.Images[0]
+}
+
+// MediaDetails implements the omnicast.MediaDetailer interface.
+func (m *MediaMetadata) MediaDetails() *omnicast.MediaDetails {
+	d := new(omnicast.MediaDetails)
+	if m != nil {
+		*d = m.details
+	}
+
+	return d
+}
+
+// MarshalJSON implements the json.Marshaler interface. Only fields
+// defined for the media type are included.
+func (m *MediaMetadata) MarshalJSON() ([]byte, error) {
+	d := m.MediaDetails()
+
+	values := map[string]interface{}{
+		"title":            d.Title,
+		"subtitle":         d.Subtitle,
+		"releaseDate":      d.ReleaseDate,
+		"studio":           d.Studio,
+		"seriesTitle":      d.SeriesTitle,
+		"season":           d.Season,
+		"episode":          d.Episode,
+		"originalAirdate":  d.OriginalAirdate,
+		"artist":           d.Artist,
+		"albumName":        d.AlbumName,
+		"albumArtist":      d.AlbumArtist,
+		"composer":         d.Composer,
+		"trackNumber":      d.TrackNumber,
+		"discNumber":       d.DiscNumber,
+		"location":         d.Location,
+		"latitude":         d.Latitude,
+		"longitude":        d.Longitude,
+		"width":            d.Width,
+		"height":           d.Height,
+		"creationDateTime": d.CreationDateTime,
+	}
+
+	if len(d.Images) > 0 {
+		images := make([]Image, 0, len(d.Images))
+		for _, u := range d.Images {
+			images = append(images, Image{URL: u.String()})
+		}
+		values["images"] = images
+	}
+
+	fields, ok := metadataFields[d.Type]
+	if !ok {
+		d.Type = omnicast.GenericMedia
+		fields = metadataFields[omnicast.GenericMedia]
 	}
 
-	img := images[0].(map[string]interface{})
-	if _, ok := img["url"]; !ok {
+	out := map[string]interface{}{"metadataType": d.Type}
+	for _, k := range fields {
+		switch v := values[k].(type) {
+		case string:
+			if v != "" {
+				out[k] = v
+			}
+		case int:
+			if v != 0 {
+				out[k] = v
+			}
+		case float64:
+			if v != 0 {
+				out[k] = v
+			}
+		case []Image:
+			out[k] = v
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (m *MediaMetadata) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		// Malformed metadata should not fail the whole message.
+		*m = MediaMetadata{}
 		return nil
 	}
 
-	u, err := url.Parse(img["url"].(string))
-	if err != nil {
+	f := metadataDecoder(raw)
+
+	// The metadataType field was named type in earlier versions.
+	t := f.int("metadataType")
+	if _, ok := raw["metadataType"]; !ok {
+		t = f.int("type")
+	}
+
+	m.details = omnicast.MediaDetails{
+		Type:             omnicast.MediaType(t),
+		Title:            f.string("title"),
+		Subtitle:         f.string("subtitle"),
+		Images:           f.images("images"),
+		ReleaseDate:      f.string("releaseDate"),
+		Studio:           f.string("studio"),
+		SeriesTitle:      f.string("seriesTitle"),
+		Season:           f.int("season"),
+		Episode:          f.int("episode"),
+		OriginalAirdate:  f.string("originalAirdate"),
+		Artist:           f.string("artist"),
+		AlbumName:        f.string("albumName"),
+		AlbumArtist:      f.string("albumArtist"),
+		Composer:         f.string("composer"),
+		TrackNumber:      f.int("trackNumber"),
+		DiscNumber:       f.int("discNumber"),
+		Location:         f.string("location"),
+		Latitude:         f.float("latitude"),
+		Longitude:        f.float("longitude"),
+		Width:            f.int("width"),
+		Height:           f.int("height"),
+		CreationDateTime: f.string("creationDateTime"),
+	}
+	if _, ok := metadataFields[m.details.Type]; !ok {
+		m.details.Type = omnicast.GenericMedia
+	}
+
+	return nil
+}
+
+// metadataDecoder decodes metadata fields, converting values of
+// unexpected types when possible.
+type metadataDecoder map[string]json.RawMessage
+
+func (f metadataDecoder) string(key string) string {
+	var v interface{}
+	if err := json.Unmarshal(f[key], &v); err != nil {
+		return ""
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+func (f metadataDecoder) float(key string) float64 {
+	var v interface{}
+	if err := json.Unmarshal(f[key], &v); err != nil {
+		return 0
+	}
+
+	switch v := v.(type) {
+	case float64:
+		return v
+	case string:
+		x, _ := strconv.ParseFloat(v, 64)
+		return x
+	default:
+		return 0
+	}
+}
+
+func (f metadataDecoder) int(key string) int {
+	return int(f.float(key))
+}
+
+// images decodes a list of images. Plain URL strings are also accepted.
+func (f metadataDecoder) images(key string) []*url.URL {
+	var list []json.RawMessage
+	if err := json.Unmarshal(f[key], &list); err != nil {
 		return nil
 	}
 
-	return u
+	var images []*url.URL
+	for _, raw := range list {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			var img Image
+			if err := json.Unmarshal(raw, &img); err != nil {
+				continue
+			}
+
+			s = img.URL
+		}
+
+		if s == "" {
+			continue
+		}
+
+		if u, err := url.Parse(s); err == nil {
+			images = append(images, u)
+		}
+	}
+
+	return images
 }
@@ -0,0 +1,89 @@
+package gcast
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/ericyan/omnicast"
+)
+
+func TestMediaMetadataUnmarshalJSON(t *testing.T) {
+	cases := []struct {
+		json     string
+		typ      omnicast.MediaType
+		title    string
+		imageURL string
+	}{
+		{`{}`, omnicast.GenericMedia, "", ""},
+		{`null`, omnicast.GenericMedia, "", ""},
+		{`"garbage"`, omnicast.GenericMedia, "", ""},
+		{`{"metadataType": 1, "title": "WALL-E"}`, omnicast.Movie, "WALL-E", ""},
+		{`{"type": 3, "title": "Define Dancing"}`, omnicast.MusicTrack, "Define Dancing", ""},
+		{`{"metadataType": "2", "title": 42}`, omnicast.TVShow, "42", ""},
+		{`{"metadataType": 99}`, omnicast.GenericMedia, "", ""},
+		{`{"title": ["a", "b"]}`, omnicast.GenericMedia, "", ""},
+		{`{"images": [{"url": "http://example.com/a.jpg", "width": 480}]}`, omnicast.GenericMedia, "", "http://example.com/a.jpg"},
+		{`{"images": ["http://example.com/b.jpg"]}`, omnicast.GenericMedia, "", "http://example.com/b.jpg"},
+		{`{"images": [42, {"url": 42}, {"url": "http://example.com/c.jpg"}]}`, omnicast.GenericMedia, "", "http://example.com/c.jpg"},
+		{`{"images": {"url": "http://example.com/d.jpg"}}`, omnicast.GenericMedia, "", ""},
+	}
+
+	for _, c := range cases {
+		m := new(MediaMetadata)
+		if err := json.Unmarshal([]byte(c.json), m); err != nil {
+			t.Errorf("Unmarshal(%s): %s", c.json, err)
+			continue
+		}
+
+		if got := m.MediaDetails().Type; got != c.typ {
+			t.Errorf("Unmarshal(%s).Type: got %s; want %s", c.json, got, c.typ)
+		}
+		if got := m.Title(); got != c.title {
+			t.Errorf("Unmarshal(%s).Title(): got '%s'; want '%s'", c.json, got, c.title)
+		}
+
+		var got string
+		if u := m.ImageURL(); u != nil {
+			got = u.String()
+		}
+		if got != c.imageURL {
+			t.Errorf("Unmarshal(%s).ImageURL(): got '%s'; want '%s'", c.json, got, c.imageURL)
+		}
+	}
+}
+
+func TestMediaMetadataMarshalJSON(t *testing.T) {
+	img, _ := url.Parse("http://example.com/wall-e.jpg")
+	d := &omnicast.MediaDetails{
+		Type:        omnicast.Movie,
+		Title:       "WALL-E",
+		Images:      []*url.URL{img},
+		TrackNumber: 7, // Not defined for movies
+	}
+
+	data, err := json.Marshal(NewMediaMetadata(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"images":[{"url":"http://example.com/wall-e.jpg"}],"metadataType":1,"title":"WALL-E"}`
+	if string(data) != want {
+		t.Errorf("got %s; want %s", data, want)
+	}
+
+	m := new(MediaMetadata)
+	if err := json.Unmarshal(data, m); err != nil {
+		t.Fatal(err)
+	}
+	if m.ImageURL() == nil || m.ImageURL().String() != img.String() {
+		t.Errorf("Unexpected image URL: %s", m.ImageURL())
+	}
+}
+
+func TestNilMediaMetadata(t *testing.T) {
+	var m *MediaMetadata
+	if m.Title() != "" || m.Subtitle() != "" || m.ImageURL() != nil {
+		t.Error("nil metadata should be empty")
+	}
+}
@@ -0,0 +1,227 @@
+package gcast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/ericyan/omnicast/gcast/internal/castv2"
+)
+
+// ErrNotGroup is returned when a device is not a multizone group.
+var ErrNotGroup = errors.New("not a multizone group")
+
+// GroupMember represents a device in a multizone group.
+type GroupMember struct {
+	DeviceID     string           `json:"deviceId"`
+	Name         string           `json:"name"`
+	Capabilities DeviceCapability `json:"capabilities"`
+	Volume       *ReceiverVolume  `json:"volume,omitempty"`
+}
+
+// MultizoneStatus represents the status of a multizone group.
+type MultizoneStatus struct {
+	castv2.Header
+	Status struct {
+		Devices        []*GroupMember `json:"devices"`
+		IsMultichannel bool           `json:"isMultichannel"`
+	} `json:"status"`
+}
+
+// updateMultizoneStatus applies the multizone status or device updates
+// in the message to the known group members.
+func (r *Receiver) updateMultizoneStatus(msg *castv2.Msg) error {
+	var m struct {
+		castv2.Header
+		Status *struct {
+			Devices []*GroupMember `json:"devices"`
+		} `json:"status"`
+		Device   *GroupMember `json:"device"`
+		DeviceID string       `json:"deviceId"`
+	}
+	if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch m.Type {
+	case castv2.TypeMultizoneStatus:
+		if m.Status != nil {
+			r.members = m.Status.Devices
+		}
+	case castv2.TypeDeviceAdded, castv2.TypeDeviceUpdated:
+		if m.Device == nil {
+			return nil
+		}
+
+		for i, member := range r.members {
+			if member.DeviceID == m.Device.DeviceID {
+				r.members[i] = m.Device
+				return nil
+			}
+		}
+		r.members = append(r.members, m.Device)
+	case castv2.TypeDeviceRemoved:
+		for i, member := range r.members {
+			if member.DeviceID == m.DeviceID {
+				r.members = append(r.members[:i], r.members[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// Members returns the last known members of the multizone group.
+func (r *Receiver) Members() []*GroupMember {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members := make([]*GroupMember, len(r.members))
+	copy(members, r.members)
+
+	return members
+}
+
+// GroupMembers requests the multizone status of the group, and returns
+// its members.
+func (r *Receiver) GroupMembers(ctx context.Context) ([]*GroupMember, error) {
+	err := r.request(
+		ctx,
+		castv2.PlatformSenderID,
+		castv2.PlatformReceiverID,
+		castv2.NamespaceMultizone,
+		castv2.NewRequest(castv2.TypeGetStatus),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Members(), nil
+}
+
+// SetMemberVolumeLevel sets the volume level of the group member, leaving
+// the mute state unchanged.
+func (r *Receiver) SetMemberVolumeLevel(ctx context.Context, deviceID string, level float64) error {
+	req := &struct {
+		castv2.Header
+		DeviceID string `json:"deviceId"`
+		Volume   struct {
+			Level float64 `json:"level"`
+		} `json:"volume"`
+	}{}
+
+	req.Type = castv2.TypeSetDeviceVolume
+	req.DeviceID = deviceID
+	req.Volume.Level = level
+
+	return r.request(
+		ctx,
+		castv2.PlatformSenderID,
+		castv2.PlatformReceiverID,
+		castv2.NamespaceMultizone,
+		req,
+	)
+}
+
+// SetMemberMuted sets the mute state of the group member, leaving the
+// volume level unchanged.
+func (r *Receiver) SetMemberMuted(ctx context.Context, deviceID string, muted bool) error {
+	req := &struct {
+		castv2.Header
+		DeviceID string `json:"deviceId"`
+		Volume   struct {
+			Muted bool `json:"muted"`
+		} `json:"volume"`
+	}{}
+
+	req.Type = castv2.TypeSetDeviceVolume
+	req.DeviceID = deviceID
+	req.Volume.Muted = muted
+
+	return r.request(
+		ctx,
+		castv2.PlatformSenderID,
+		castv2.PlatformReceiverID,
+		castv2.NamespaceMultizone,
+		req,
+	)
+}
+
+// A Group is a Sender for a multizone group. The volume of the group is
+// controlled as a whole with the Sender methods, and the volume of each
+// member with the Group methods.
+type Group struct {
+	*Sender
+}
+
+// NewGroup returns a new Group and connects to the group device.
+func NewGroup(id string, dev *DeviceInfo) (*Group, error) {
+	if !dev.CapableOf(MultizoneGroup) {
+		return nil, ErrNotGroup
+	}
+
+	s, err := NewSender(id, dev)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Group{s}, nil
+}
+
+// Members returns the devices in the group, with their volumes.
+func (g *Group) Members(ctx context.Context) ([]*GroupMember, error) {
+	return g.r.GroupMembers(ctx)
+}
+
+// MemberVolume returns the last known volume of the group member, which
+// is kept up to date by the updates broadcasted by the group.
+func (g *Group) MemberVolume(deviceID string) *ReceiverVolume {
+	for _, m := range g.r.Members() {
+		if m.DeviceID == deviceID {
+			return m.Volume
+		}
+	}
+
+	return nil
+}
+
+// SetMemberVolumeLevel sets the volume level of the group member.
+func (g *Group) SetMemberVolumeLevel(ctx context.Context, deviceID string, level float64) error {
+	return g.r.SetMemberVolumeLevel(ctx, deviceID, level)
+}
+
+// MuteMember mutes the group member.
+func (g *Group) MuteMember(ctx context.Context, deviceID string) error {
+	return g.r.SetMemberMuted(ctx, deviceID, true)
+}
+
+// UnmuteMember unmutes the group member.
+func (g *Group) UnmuteMember(ctx context.Context, deviceID string) error {
+	return g.r.SetMemberMuted(ctx, deviceID, false)
+}
+
+// FindGroups returns the multizone groups discovered via mDNS until the
+// context is done.
+func FindGroups(ctx context.Context) ([]*DeviceInfo, error) {
+	ch, err := Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []*DeviceInfo
+	seen := make(map[string]bool)
+	for dev := range ch {
+		if !dev.CapableOf(MultizoneGroup) || seen[dev.UUID.String()] {
+			continue
+		}
+		seen[dev.UUID.String()] = true
+
+		groups = append(groups, dev)
+	}
+
+	return groups, nil
+}
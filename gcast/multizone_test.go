@@ -0,0 +1,78 @@
+package gcast_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ericyan/omnicast/gcast"
+	"github.com/ericyan/omnicast/gcast/gcasttest"
+)
+
+func TestGroup(t *testing.T) {
+	srv := gcasttest.NewServer("Whole Home")
+	defer srv.Close()
+
+	if _, err := gcast.NewGroup("sender-test", srv.DeviceInfo()); err != gcast.ErrNotGroup {
+		t.Errorf("NewGroup with a single device: got %v; want %v", err, gcast.ErrNotGroup)
+	}
+
+	srv.SetGroupMembers(
+		gcast.GroupMember{DeviceID: "kitchen", Name: "Kitchen", Capabilities: gcast.AudioOut},
+		gcast.GroupMember{DeviceID: "bedroom", Name: "Bedroom", Capabilities: gcast.AudioOut},
+	)
+
+	g, err := gcast.NewGroup("sender-test", srv.DeviceInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	ctx := context.Background()
+	members, err := g.Members(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || members[0].Name != "Kitchen" || members[1].Name != "Bedroom" {
+		t.Fatalf("Unexpected members: %+v", members)
+	}
+
+	if err := g.SetMemberVolumeLevel(ctx, "kitchen", 0.3); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.MuteMember(ctx, "bedroom"); err != nil {
+		t.Fatal(err)
+	}
+	if m := srv.GroupMember("kitchen"); m.Volume.Level != 0.3 || m.Volume.Muted {
+		t.Errorf("Unexpected volume of kitchen: %+v", m.Volume)
+	}
+	if m := srv.GroupMember("bedroom"); m.Volume.Level != 1 || !m.Volume.Muted {
+		t.Errorf("Unexpected volume of bedroom: %+v", m.Volume)
+	}
+	if err := g.SetMemberVolumeLevel(ctx, "garage", 0.5); err == nil {
+		t.Error("Expect error for unknown member")
+	}
+
+	// Group volume is independent of member volumes.
+	if err := g.SetVolumeLevel(ctx, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if vol := srv.Volume(); vol.Level != 0.5 {
+		t.Errorf("Unexpected group volume: %+v", vol)
+	}
+
+	// Volume changes on the devices are broadcasted.
+	srv.SetMemberVolume("bedroom", gcast.ReceiverVolume{Level: 0.8})
+	deadline := time.Now().Add(time.Second)
+	for {
+		vol := g.MemberVolume("bedroom")
+		if vol != nil && vol.Level == 0.8 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Unexpected volume of bedroom after update: %+v", vol)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,11 +1,23 @@
 package gcast
 
 import (
+	"context"
 	"encoding/json"
 	"log"
+	"math"
+	"net/url"
+	"sync"
 	"time"
 
+	"github.com/ericyan/omnicast"
 	"github.com/ericyan/omnicast/gcast/internal/castv2"
+	"github.com/ericyan/omnicast/metrics"
+)
+
+var reconnects = metrics.NewCounter(
+	"omnicast_cast_reconnects_total",
+	"Reconnections to Cast receivers after losing the connection, by result.",
+	"result",
 )
 
 // Common receiver app IDs.
@@ -26,6 +38,13 @@ type ReceiverApplication struct {
 	TransportID         string              `json:"transportId"`
 }
 
+// Volume control types of the receiver device.
+const (
+	VolumeControlAttenuation = "attenuation"
+	VolumeControlFixed       = "fixed"
+	VolumeControlMaster      = "master"
+)
+
 // ReceiverVolume represents the volume of the receiver device.
 type ReceiverVolume struct {
 	ControlType  string  `json:"controlType,omitempty"`
@@ -47,13 +66,37 @@ type ReceiverStatus struct {
 //
 // Ref: https://developers.google.com/cast/docs/reference/messages#MediaInformation
 type MediaInformation struct {
-	ContentID   string        `json:"contentId"`
-	ContentType string        `json:"contentType"`
-	StreamType  string        `json:"streamType"`
-	Metadata    MediaMetadata `json:"metadata,omitempty"`
-	Duration    float64       `json:"duration,omitempty"`
+	ContentID   string         `json:"contentId"`
+	ContentType string         `json:"contentType"`
+	StreamType  string         `json:"streamType"`
+	Metadata    *MediaMetadata `json:"metadata,omitempty"`
+	Duration    float64        `json:"duration,omitempty"`
 }
 
+// MediaCommand represents a set of media commands supported by the
+// receiver application for a media session.
+type MediaCommand int
+
+// Defined media commands.
+//
+// Ref: https://developers.google.com/cast/docs/reference/messages#MediaStatus
+const (
+	CommandPause          MediaCommand = 1 << 0
+	CommandSeek           MediaCommand = 1 << 1
+	CommandStreamVolume   MediaCommand = 1 << 2
+	CommandStreamMute     MediaCommand = 1 << 3
+	CommandSkipForward    MediaCommand = 1 << 4
+	CommandSkipBackward   MediaCommand = 1 << 5
+	CommandQueueNext      MediaCommand = 1 << 6
+	CommandQueuePrev      MediaCommand = 1 << 7
+	CommandQueueShuffle   MediaCommand = 1 << 8
+	CommandSkipAd         MediaCommand = 1 << 9
+	CommandQueueRepeatAll MediaCommand = 1 << 10
+	CommandQueueRepeatOne MediaCommand = 1 << 11
+	CommandEditTracks     MediaCommand = 1 << 12
+	CommandPlaybackRate   MediaCommand = 1 << 13
+)
+
 // MediaSession represents the current status of a single session.
 type MediaSession struct {
 	MediaSessionID         int               `json:"mediaSessionId"`
@@ -62,7 +105,7 @@ type MediaSession struct {
 	PlayerState            string            `json:"playerState"`
 	IdleReason             string            `json:"idleReason,omitempty"`
 	CurrentTime            float64           `json:"currentTime"`
-	SupportedMediaCommands int               `json:"supportedMediaCommands"`
+	SupportedMediaCommands MediaCommand      `json:"supportedMediaCommands"`
 }
 
 // MediaStatus represents the current status of the media artifact with
@@ -84,6 +127,66 @@ type Receiver struct {
 	vol        *ReceiverVolume
 	session    *MediaSession
 	lastUpdate time.Time
+
+	broadcaster omnicast.EventBroadcaster
+
+	mu             sync.Mutex
+	handlers       map[string]MessageHandler
+	queue          []*castv2.Msg
+	dispatching    bool
+	statusUpdateCh chan struct{}
+	members        []*GroupMember
+}
+
+// playbackState converts the player state of a media session.
+func playbackState(s *MediaSession) omnicast.PlaybackState {
+	if s == nil {
+		return omnicast.StateIdle
+	}
+
+	switch s.PlayerState {
+	case "PLAYING":
+		return omnicast.StatePlaying
+	case "PAUSED":
+		return omnicast.StatePaused
+	case "BUFFERING":
+		return omnicast.StateBuffering
+	default:
+		return omnicast.StateIdle
+	}
+}
+
+// position returns the playback position of the session at time t, had
+// the playback progressed normally since ts.
+func (s *MediaSession) position(ts, t time.Time) time.Duration {
+	pos := s.CurrentTime
+	if s.PlayerState == "PLAYING" {
+		pos += t.Sub(ts).Seconds() * float64(s.PlaybackRate)
+	}
+
+	return time.Duration(pos * float64(time.Second))
+}
+
+// mediaChanged returns the MediaChanged event of the media session.
+func mediaChanged(s *MediaSession) *omnicast.Event {
+	e := &omnicast.Event{Type: omnicast.MediaChanged}
+	if s != nil && s.Media != nil {
+		e.MediaURL, _ = url.Parse(s.Media.ContentID)
+		if s.Media.Metadata != nil {
+			e.MediaMetadata = s.Media.Metadata
+		}
+		e.MediaDuration = time.Duration(s.Media.Duration * float64(time.Second))
+	}
+
+	return e
+}
+
+// publish publishes the events in order. It must be called without
+// holding the lock, as subscribers may query the receiver in turn.
+func (r *Receiver) publish(events []*omnicast.Event) {
+	for _, e := range events {
+		r.broadcaster.Publish(e)
+	}
 }
 
 func (r *Receiver) updateReceiverStatus(msg *castv2.Msg) error {
@@ -99,35 +202,130 @@ func (r *Receiver) updateReceiverStatus(msg *castv2.Msg) error {
 		app = nil
 	}
 
-	if r.app != app {
-		r.app = app
-		r.session = nil
-	}
+	var events []*omnicast.Event
 
+	r.mu.Lock()
+	if r.app == nil || app == nil || r.app.SessionID != app.SessionID {
+		if r.session != nil {
+			r.session = nil
+			events = append(events, &omnicast.Event{
+				Type:  omnicast.StateChanged,
+				State: omnicast.StateIdle,
+			}, mediaChanged(nil))
+		}
+	}
+	r.app = app
+
+	if vol := rs.Status.Volume; vol != nil {
+		if r.vol == nil || r.vol.Level != vol.Level || r.vol.Muted != vol.Muted {
+			events = append(events, &omnicast.Event{
+				Type:        omnicast.VolumeChanged,
+				VolumeLevel: vol.Level,
+				Muted:       vol.Muted,
+			})
+		}
+	}
 	r.vol = rs.Status.Volume
 
+	if r.statusUpdateCh != nil {
+		close(r.statusUpdateCh)
+		r.statusUpdateCh = nil
+	}
+	r.mu.Unlock()
+
+	r.publish(events)
+
 	return nil
 }
 
+// statusUpdated returns a channel which will be closed on the next update
+// of the receiver status.
+func (r *Receiver) statusUpdated() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.statusUpdateCh == nil {
+		r.statusUpdateCh = make(chan struct{})
+	}
+
+	return r.statusUpdateCh
+}
+
 func (r *Receiver) updateMediaStatus(msg *castv2.Msg) error {
 	ms := new(MediaStatus)
 	if err := json.Unmarshal([]byte(msg.Payload), &ms); err != nil {
 		return err
 	}
 
-	r.lastUpdate = time.Now()
+	var events []*omnicast.Event
+
+	r.mu.Lock()
+	now := time.Now()
 	for _, s := range ms.Status {
 		// The media element will only be returned if it has changed.
 		if s.Media == nil && r.session != nil {
 			s.Media = r.session.Media
 		}
 
+		events = append(events, mediaStatusChanges(r.session, s, r.lastUpdate, now)...)
 		r.session = s
 	}
+	r.lastUpdate = now
+	r.mu.Unlock()
+
+	r.publish(events)
 
 	return nil
 }
 
+// mediaStatusChanges compares the media sessions before and after a
+// status update, and returns the corresponding events. The previous
+// session was last updated at ts.
+func mediaStatusChanges(prev, next *MediaSession, ts, now time.Time) []*omnicast.Event {
+	var events []*omnicast.Event
+
+	var prevContentID, nextContentID string
+	if prev != nil && prev.Media != nil {
+		prevContentID = prev.Media.ContentID
+	}
+	if next.Media != nil {
+		nextContentID = next.Media.ContentID
+	}
+	if prevContentID != nextContentID {
+		events = append(events, mediaChanged(next))
+	}
+
+	pos := next.position(now, now)
+	if state := playbackState(next); state != playbackState(prev) {
+		events = append(events, &omnicast.Event{
+			Type:     omnicast.StateChanged,
+			State:    state,
+			Position: pos,
+		})
+	}
+
+	// Playback position drifts a bit between status updates. Anything
+	// beyond the tolerance is considered a jump.
+	if prev != nil && prevContentID == nextContentID {
+		expected := prev.position(ts, now)
+		if math.Abs((pos - expected).Seconds()) > 2 {
+			events = append(events, &omnicast.Event{
+				Type:     omnicast.PositionJumped,
+				State:    playbackState(next),
+				Position: pos,
+			})
+		}
+	}
+
+	return events
+}
+
+// Subscribe implements the omnicast.EventSource interface. Events are
+// derived from the status messages broadcasted by the receiver.
+func (r *Receiver) Subscribe(ctx context.Context) (<-chan *omnicast.Event, error) {
+	return r.broadcaster.Subscribe(ctx)
+}
+
 // Connect makes a connection to the receiver.
 func (r *Receiver) Connect() error {
 	if r.IsConnected() {
@@ -138,22 +336,29 @@ func (r *Receiver) Connect() error {
 		r.events = make(chan *castv2.Msg)
 		go func() {
 			for msg := range r.events {
-				var h castv2.Header
-				if err := json.Unmarshal([]byte(msg.Payload), &h); err != nil {
-					continue
+				switch msg.Namespace {
+				case castv2.NamespaceReceiver, castv2.NamespaceMedia:
+					var h castv2.Header
+					if err := json.Unmarshal([]byte(msg.Payload), &h); err != nil {
+						break
+					}
+
+					switch h.Type {
+					case castv2.TypeReceiverStatus:
+						r.updateReceiverStatus(msg)
+					case castv2.TypeMediaStatus:
+						r.updateMediaStatus(msg)
+					}
+				case castv2.NamespaceMultizone:
+					r.updateMultizoneStatus(msg)
 				}
 
-				switch h.Type {
-				case castv2.TypeReceiverStatus:
-					r.updateReceiverStatus(msg)
-				case castv2.TypeMediaStatus:
-					r.updateMediaStatus(msg)
-				}
+				r.dispatch(msg)
 			}
 		}()
 	}
 
-	ch, err := castv2.Dial(r.TCPAddr())
+	ch, err := r.dial()
 	if err != nil {
 		return err
 	}
@@ -162,19 +367,41 @@ func (r *Receiver) Connect() error {
 	r.ch.Subscribe(r.events)
 
 	// Request receiver status to update state
-	respCh := make(chan *castv2.Msg)
-	err = r.ch.Request(
+	return r.request(
+		context.Background(),
 		castv2.PlatformSenderID,
 		castv2.PlatformReceiverID,
 		castv2.NamespaceReceiver,
 		castv2.NewRequest(castv2.TypeGetStatus),
-		respCh,
 	)
-	if err != nil {
-		return err
+}
+
+// dial connects to the addresses of the device in turn, so that devices
+// are reachable over IPv6 if IPv4 is absent or fails. Devices failing
+// device authentication are not retried.
+func (r *Receiver) dial() (*castv2.Channel, error) {
+	addrs := r.TCPAddrs()
+	if len(addrs) == 0 {
+		return nil, ErrReceiverNotReady
 	}
 
-	return r.updateReceiverStatus(<-respCh)
+	var err error
+	for _, addr := range addrs {
+		var ch *castv2.Channel
+		ch, err = castv2.Dial(addr, TrustRoots)
+		if err == nil {
+			return ch, nil
+		}
+
+		if aerr, ok := err.(*castv2.AuthError); ok {
+			log.Printf("gcast: %s (%s): %s\n", r.Name, r.UUID, aerr.Reason)
+			return nil, ErrNotAuthenticated
+		}
+
+		log.Printf("gcast: failed to connect to %s: %s\n", addr, err)
+	}
+
+	return nil, err
 }
 
 // IsConnected returns true if there is an active connection to the
@@ -193,6 +420,9 @@ func (r *Receiver) Application() *ReceiverApplication {
 		return nil
 	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	return r.app
 }
 
@@ -202,6 +432,9 @@ func (r *Receiver) Volume() *ReceiverVolume {
 		return nil
 	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	return r.vol
 }
 
@@ -211,36 +444,178 @@ func (r *Receiver) Session(senderID string) (*MediaSession, time.Time) {
 		log.Println("gcast: connection lost, reconnecting...")
 		if err := r.Connect(); err != nil {
 			log.Println("gcast: failed to reconnect.", err)
-			return nil, r.lastUpdate
+			reconnects.Inc("failed")
+			_, _, lastUpdate := r.state()
+			return nil, lastUpdate
 		}
+		reconnects.Inc("ok")
 	}
 
-	if r.app == nil || r.app.IsIdleScreen {
-		return nil, r.lastUpdate
+	app, session, lastUpdate := r.state()
+	if app == nil || app.IsIdleScreen {
+		return nil, lastUpdate
 	}
 
-	if r.session == nil || time.Since(r.lastUpdate).Seconds() > 30 {
-		respCh := make(chan *castv2.Msg)
-		err := r.ch.Request(
-			senderID,
-			r.app.SessionID,
-			castv2.NamespaceMedia,
-			castv2.NewRequest(castv2.TypeGetStatus),
-			respCh,
-		)
+	if session == nil || time.Since(lastUpdate).Seconds() > 30 {
+		err := r.mediaRequest(context.Background(), senderID, castv2.NewRequest(castv2.TypeGetStatus))
 		if err != nil {
 			log.Println("gcast: failed to update media status.", err)
-			return nil, r.lastUpdate
+			return nil, lastUpdate
+		}
+		_, session, lastUpdate = r.state()
+	}
+
+	return session, lastUpdate
+}
+
+// state returns the last known application and media session, and the
+// time of the last media status update.
+func (r *Receiver) state() (*ReceiverApplication, *MediaSession, time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.app, r.session, r.lastUpdate
+}
+
+// Error types sent by the receiver in reply to a failed request.
+const (
+	TypeInvalidPlayerState = "INVALID_PLAYER_STATE"
+	TypeLoadFailed         = "LOAD_FAILED"
+	TypeLoadCancelled      = "LOAD_CANCELLED"
+	TypeInvalidRequest     = "INVALID_REQUEST"
+	TypeLaunchError        = "LAUNCH_ERROR"
+)
+
+// A RequestError is returned when the receiver rejects a request.
+type RequestError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Error implements the error interface.
+func (err *RequestError) Error() string {
+	if err.Reason == "" {
+		return "gcast: " + err.Type
+	}
+
+	return "gcast: " + err.Type + ": " + err.Reason
+}
+
+// requestTimeout is the maximum time to wait for the reply to a request.
+const requestTimeout = 5 * time.Second
+
+// roundTrip sends the request and waits for the reply.
+func (r *Receiver) roundTrip(ctx context.Context, srcID, destID, namespace string, req castv2.Request) (*castv2.Msg, error) {
+	if !r.IsConnected() {
+		return nil, ErrReceiverNotReady
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	// The channel is buffered so that a late reply never blocks.
+	respCh := make(chan *castv2.Msg, 1)
+	reqID, err := r.ch.Request(srcID, destID, namespace, req, respCh)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		r.ch.Cancel(reqID)
+		return nil, ctx.Err()
+	case msg, ok := <-respCh:
+		if !ok {
+			return nil, ErrReceiverNotReady
+		}
+
+		return msg, nil
+	}
+}
+
+// request sends the request and waits for the reply. Status updates in
+// the reply will be applied before returning.
+func (r *Receiver) request(ctx context.Context, srcID, destID, namespace string, req castv2.Request) error {
+	msg, err := r.roundTrip(ctx, srcID, destID, namespace, req)
+	if err != nil {
+		return err
+	}
+
+	var h castv2.Header
+	if err := json.Unmarshal([]byte(msg.Payload), &h); err != nil {
+		return err
+	}
+
+	switch h.Type {
+	case castv2.TypeReceiverStatus:
+		return r.updateReceiverStatus(msg)
+	case castv2.TypeMediaStatus:
+		return r.updateMediaStatus(msg)
+	case castv2.TypeMultizoneStatus, castv2.TypeDeviceUpdated:
+		return r.updateMultizoneStatus(msg)
+	case TypeInvalidPlayerState, TypeLoadFailed, TypeLoadCancelled, TypeInvalidRequest, TypeLaunchError:
+		rerr := new(RequestError)
+		if err := json.Unmarshal([]byte(msg.Payload), rerr); err != nil {
+			return err
 		}
 
-		r.updateMediaStatus(<-respCh)
+		return rerr
+	default:
+		return nil
+	}
+}
+
+// mediaRequest sends a request in the media namespace of the current
+// running receiver application.
+func (r *Receiver) mediaRequest(ctx context.Context, senderID string, req castv2.Request) error {
+	app := r.Application()
+	if app == nil {
+		return ErrReceiverNotReady
 	}
 
-	return r.session, r.lastUpdate
+	return r.request(ctx, senderID, app.SessionID, castv2.NamespaceMedia, req)
+}
+
+// Availability of receiver applications.
+const (
+	AppAvailable   = "APP_AVAILABLE"
+	AppUnavailable = "APP_UNAVAILABLE"
+)
+
+// AppAvailability checks if the receiver applications are available on
+// the device. It returns the availability of each application.
+func (r *Receiver) AppAvailability(ctx context.Context, appIDs ...string) (map[string]string, error) {
+	req := &struct {
+		castv2.Header
+		AppIDs []string `json:"appId"`
+	}{}
+
+	req.Type = castv2.TypeGetAppAvailability
+	req.AppIDs = appIDs
+
+	msg, err := r.roundTrip(
+		ctx,
+		castv2.PlatformSenderID,
+		castv2.PlatformReceiverID,
+		castv2.NamespaceReceiver,
+		req,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(struct {
+		Availability map[string]string `json:"availability"`
+	})
+	if err := json.Unmarshal([]byte(msg.Payload), resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Availability, nil
 }
 
 // Launch starts an new receiver application.
-func (r *Receiver) Launch(appID string) error {
+func (r *Receiver) Launch(ctx context.Context, appID string) error {
 	req := &struct {
 		castv2.Header
 		AppID string `json:"appId"`
@@ -249,17 +624,35 @@ func (r *Receiver) Launch(appID string) error {
 	req.Type = castv2.TypeLaunch
 	req.AppID = appID
 
-	return r.ch.Request(
+	return r.request(
+		ctx,
 		castv2.PlatformSenderID,
 		castv2.PlatformReceiverID,
 		castv2.NamespaceReceiver,
 		req,
-		nil,
 	)
 }
 
+// WaitForApp waits until the receiver application is running, as reported
+// by receiver status updates.
+func (r *Receiver) WaitForApp(ctx context.Context, appID string) error {
+	for {
+		// Get the channel before checking, so that no update is missed.
+		updated := r.statusUpdated()
+		if app := r.Application(); app != nil && app.AppID == appID {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-updated:
+		}
+	}
+}
+
 // SetVolume sets the receiver volume.
-func (r *Receiver) SetVolume(vol *ReceiverVolume) error {
+func (r *Receiver) SetVolume(ctx context.Context, vol *ReceiverVolume) error {
 	req := &struct {
 		castv2.Header
 		Volume *ReceiverVolume `json:"volume"`
@@ -268,19 +661,63 @@ func (r *Receiver) SetVolume(vol *ReceiverVolume) error {
 	req.Type = castv2.TypeSetVolume
 	req.Volume = vol
 
-	return r.ch.Request(
+	return r.request(
+		ctx,
+		castv2.PlatformSenderID,
+		castv2.PlatformReceiverID,
+		castv2.NamespaceReceiver,
+		req,
+	)
+}
+
+// SetVolumeLevel sets the receiver volume level, leaving the mute state
+// unchanged.
+func (r *Receiver) SetVolumeLevel(ctx context.Context, level float64) error {
+	req := &struct {
+		castv2.Header
+		Volume struct {
+			Level float64 `json:"level"`
+		} `json:"volume"`
+	}{}
+
+	req.Type = castv2.TypeSetVolume
+	req.Volume.Level = level
+
+	return r.request(
+		ctx,
+		castv2.PlatformSenderID,
+		castv2.PlatformReceiverID,
+		castv2.NamespaceReceiver,
+		req,
+	)
+}
+
+// SetMuted sets the receiver mute state, leaving the volume level
+// unchanged.
+func (r *Receiver) SetMuted(ctx context.Context, muted bool) error {
+	req := &struct {
+		castv2.Header
+		Volume struct {
+			Muted bool `json:"muted"`
+		} `json:"volume"`
+	}{}
+
+	req.Type = castv2.TypeSetVolume
+	req.Volume.Muted = muted
+
+	return r.request(
+		ctx,
 		castv2.PlatformSenderID,
 		castv2.PlatformReceiverID,
 		castv2.NamespaceReceiver,
 		req,
-		nil,
 	)
 }
 
 // Load loads new content into the media player.
 //
 // Ref: https://developers.google.com/cast/docs/reference/messages#Load
-func (r *Receiver) Load(senderID string, media *MediaInformation) error {
+func (r *Receiver) Load(ctx context.Context, senderID string, media *MediaInformation) error {
 	req := &struct {
 		castv2.Header
 		Media *MediaInformation `json:"media"`
@@ -289,20 +726,14 @@ func (r *Receiver) Load(senderID string, media *MediaInformation) error {
 	req.Type = castv2.TypeLoad
 	req.Media = media
 
-	return r.ch.Request(
-		senderID,
-		r.app.SessionID,
-		castv2.NamespaceMedia,
-		req,
-		nil,
-	)
+	return r.mediaRequest(ctx, senderID, req)
 }
 
 // Play begins playback of the loaded media content from the current
 // playback position.
 //
 // https://developers.google.com/cast/docs/reference/messages#Play
-func (r *Receiver) Play(senderID string, mediaSessionID int) error {
+func (r *Receiver) Play(ctx context.Context, senderID string, mediaSessionID int) error {
 	req := &struct {
 		castv2.Header
 		MediaSessionID int `json:"mediaSessionId"`
@@ -311,19 +742,13 @@ func (r *Receiver) Play(senderID string, mediaSessionID int) error {
 	req.Type = castv2.TypePlay
 	req.MediaSessionID = mediaSessionID
 
-	return r.ch.Request(
-		senderID,
-		r.app.SessionID,
-		castv2.NamespaceMedia,
-		req,
-		nil,
-	)
+	return r.mediaRequest(ctx, senderID, req)
 }
 
 // Pause pauses playback of the current content.
 //
 // https://developers.google.com/cast/docs/reference/messages#Pause
-func (r *Receiver) Pause(senderID string, mediaSessionID int) error {
+func (r *Receiver) Pause(ctx context.Context, senderID string, mediaSessionID int) error {
 	req := &struct {
 		castv2.Header
 		MediaSessionID int `json:"mediaSessionId"`
@@ -332,19 +757,13 @@ func (r *Receiver) Pause(senderID string, mediaSessionID int) error {
 	req.Type = castv2.TypePause
 	req.MediaSessionID = mediaSessionID
 
-	return r.ch.Request(
-		senderID,
-		r.app.SessionID,
-		castv2.NamespaceMedia,
-		req,
-		nil,
-	)
+	return r.mediaRequest(ctx, senderID, req)
 }
 
 // Stop stops the playback and unload the current content
 //
 // https://developers.google.com/cast/docs/reference/messages#Stop
-func (r *Receiver) Stop(senderID string, mediaSessionID int) error {
+func (r *Receiver) Stop(ctx context.Context, senderID string, mediaSessionID int) error {
 	req := &struct {
 		castv2.Header
 		MediaSessionID int `json:"mediaSessionId"`
@@ -353,18 +772,12 @@ func (r *Receiver) Stop(senderID string, mediaSessionID int) error {
 	req.Type = castv2.TypeStop
 	req.MediaSessionID = mediaSessionID
 
-	return r.ch.Request(
-		senderID,
-		r.app.SessionID,
-		castv2.NamespaceMedia,
-		req,
-		nil,
-	)
+	return r.mediaRequest(ctx, senderID, req)
 }
 
 // Seek sets the current playback position to pos, which is the number
 // of seconds since beginning of content
-func (r *Receiver) Seek(senderID string, mediaSessionID int, pos float64) error {
+func (r *Receiver) Seek(ctx context.Context, senderID string, mediaSessionID int, pos float64) error {
 	req := &struct {
 		castv2.Header
 		MediaSessionID int     `json:"mediaSessionId"`
@@ -375,13 +788,7 @@ func (r *Receiver) Seek(senderID string, mediaSessionID int, pos float64) error
 	req.MediaSessionID = mediaSessionID
 	req.CurrentTime = pos
 
-	return r.ch.Request(
-		senderID,
-		r.app.SessionID,
-		castv2.NamespaceMedia,
-		req,
-		nil,
-	)
+	return r.mediaRequest(ctx, senderID, req)
 }
 
 // Close closes the connection to the receiver.
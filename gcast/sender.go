@@ -1,6 +1,7 @@
 package gcast
 
 import (
+	"context"
 	"errors"
 	"mime"
 	"net/url"
@@ -13,14 +14,24 @@ import (
 // Errors used by the Sender.
 var (
 	ErrReceiverNotReady = errors.New("receiver not ready")
-	ErrInvalidMedia     = errors.New("invalid media")
+	ErrInvalidMedia     = omnicast.ErrInvalidMedia
+	ErrAppNotAvailable  = errors.New("receiver app not available")
 )
 
+// launchTimeout is the maximum time to wait for a receiver application
+// to be launched.
+const launchTimeout = 10 * time.Second
+
 // A Sender is a sender app instance that controls media playback on the
 // receiver. Its ID, which should be unique, is used to identify itself
 // when communicating with the receiver.
+//
+// Media is loaded into the receiver application identified by AppID, or
+// the Default Media Receiver if not set. The application should support
+// the media namespace, e.g. a Styled Media Receiver.
 type Sender struct {
-	ID string
+	ID    string
+	AppID string
 
 	r *Receiver
 }
@@ -41,67 +52,88 @@ func (s *Sender) Name() string {
 	return s.r.Name
 }
 
-func (s *Sender) ensureAppLaunched(appID string) error {
-	if s.r.Application() == nil || s.r.Application().AppID != DefaultReceiverAppID {
-		err := s.r.Launch(DefaultReceiverAppID)
-		if err != nil {
-			return err
-		}
-	}
+// Device returns the information of the receiver device.
+func (s *Sender) Device() *DeviceInfo {
+	return s.r.DeviceInfo
+}
 
-	for {
-		select {
-		case <-time.After(2 * time.Second):
-			return ErrReceiverNotReady
-		default:
-			if s.r.Application() != nil && s.r.Application().AppID == DefaultReceiverAppID {
-				return nil
-			}
-		}
+func (s *Sender) appID() string {
+	if s.AppID == "" {
+		return DefaultReceiverAppID
 	}
+
+	return s.AppID
 }
 
-// Load casts media to the receiver and starts playback.
-func (s *Sender) Load(mediaURL *url.URL, mediaMetadata omnicast.MediaMetadata) error {
-	if !mediaURL.IsAbs() {
-		return ErrInvalidMedia
+// ensureAppLaunched launches the receiver application if it is not
+// running, and waits for it to be ready.
+func (s *Sender) ensureAppLaunched(ctx context.Context, appID string) error {
+	if app := s.r.Application(); app != nil && app.AppID == appID {
+		return nil
 	}
 
-	ext := filepath.Ext(mediaURL.EscapedPath())
-	contentType := mime.TypeByExtension(ext)
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	availability, err := s.r.AppAvailability(ctx, appID)
+	if err != nil {
+		return err
+	}
+	if availability[appID] != AppAvailable {
+		return ErrAppNotAvailable
 	}
 
-	if err := s.ensureAppLaunched(DefaultReceiverAppID); err != nil {
+	if err := s.r.Launch(ctx, appID); err != nil {
 		return err
 	}
 
-	metadata := MediaMetadata{"type": 0}
-	if mediaMetadata != nil {
-		if mediaMetadata.Title() != "" {
-			metadata["title"] = mediaMetadata.Title()
-		}
+	ctx, cancel := context.WithTimeout(ctx, launchTimeout)
+	defer cancel()
 
-		if mediaMetadata.Subtitle() != "" {
-			metadata["subtitle"] = mediaMetadata.Subtitle()
+	if err := s.r.WaitForApp(ctx, appID); err != nil {
+		if err == context.DeadlineExceeded {
+			return ErrReceiverNotReady
 		}
 
-		if mediaMetadata.ImageURL() != nil {
-			metadata["images"] = []map[string]string{
-				map[string]string{"url": mediaMetadata.ImageURL().String()},
-			}
-		}
+		return err
 	}
 
+	return nil
+}
+
+// contentType guesses the MIME type of the media from its URL.
+func contentType(mediaURL *url.URL) string {
+	ext := filepath.Ext(mediaURL.EscapedPath())
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+
+	return "application/octet-stream"
+}
+
+// Load casts media to the receiver and starts playback.
+func (s *Sender) Load(ctx context.Context, mediaURL *url.URL, mediaMetadata omnicast.MediaMetadata) error {
+	return s.LoadInApp(ctx, s.appID(), mediaURL, mediaMetadata)
+}
+
+// LoadInApp is like Load, but loads media into the given receiver
+// application instead of the one of the Sender.
+func (s *Sender) LoadInApp(ctx context.Context, appID string, mediaURL *url.URL, mediaMetadata omnicast.MediaMetadata) error {
+	if !mediaURL.IsAbs() {
+		return ErrInvalidMedia
+	}
+
+	if err := s.ensureAppLaunched(ctx, appID); err != nil {
+		return err
+	}
+
+	metadata := NewMediaMetadata(omnicast.DetailsOf(mediaMetadata))
+
 	mediaInfo := &MediaInformation{
 		ContentID:   mediaURL.String(),
-		ContentType: contentType,
+		ContentType: contentType(mediaURL),
 		Metadata:    metadata,
 		StreamType:  "BUFFERED",
 	}
 
-	return s.r.Load(s.ID, mediaInfo)
+	return s.r.Load(ctx, s.ID, mediaInfo)
 }
 
 // MediaURL returns the URL of current loaded media.
@@ -111,7 +143,7 @@ func (s *Sender) MediaURL() *url.URL {
 	}
 
 	ms, _ := s.r.Session(s.ID)
-	if ms == nil {
+	if ms == nil || ms.Media == nil {
 		return nil
 	}
 
@@ -134,7 +166,7 @@ func (s *Sender) MediaURL() *url.URL {
 // MediaMetadata returns the metadata of current loaded media.
 func (s *Sender) MediaMetadata() omnicast.MediaMetadata {
 	ms, _ := s.r.Session(s.ID)
-	if ms == nil {
+	if ms == nil || ms.Media == nil || ms.Media.Metadata == nil {
 		return nil
 	}
 
@@ -144,7 +176,7 @@ func (s *Sender) MediaMetadata() omnicast.MediaMetadata {
 // MediaDuration returns the duration of current loaded media.
 func (s *Sender) MediaDuration() time.Duration {
 	ms, _ := s.r.Session(s.ID)
-	if ms == nil {
+	if ms == nil || ms.Media == nil {
 		return time.Duration(0)
 	}
 
@@ -211,45 +243,66 @@ func (s *Sender) PlaybackRate() float32 {
 	return ms.PlaybackRate
 }
 
-// Play begins playback of the loaded media content from the current
-// playback position.
-func (s *Sender) Play() {
+// mediaSession returns the current media session. It fails if there
+// is no media loaded.
+func (s *Sender) mediaSession() (*MediaSession, error) {
 	ms, _ := s.r.Session(s.ID)
 	if ms == nil {
-		return
+		if !s.r.IsConnected() {
+			return nil, ErrReceiverNotReady
+		}
+
+		return nil, omnicast.ErrNoMedia
 	}
 
-	s.r.Play(s.ID, ms.MediaSessionID)
+	return ms, nil
+}
+
+// Play begins playback of the loaded media content from the current
+// playback position.
+func (s *Sender) Play(ctx context.Context) error {
+	ms, err := s.mediaSession()
+	if err != nil {
+		return err
+	}
+
+	return s.r.Play(ctx, s.ID, ms.MediaSessionID)
 }
 
 // Pause pauses playback of the current content.
-func (s *Sender) Pause() {
-	ms, _ := s.r.Session(s.ID)
-	if ms == nil {
-		return
+func (s *Sender) Pause(ctx context.Context) error {
+	ms, err := s.mediaSession()
+	if err != nil {
+		return err
+	}
+	if ms.SupportedMediaCommands&CommandPause == 0 {
+		return omnicast.ErrNotSupported
 	}
 
-	s.r.Pause(s.ID, ms.MediaSessionID)
+	return s.r.Pause(ctx, s.ID, ms.MediaSessionID)
 }
 
 // Stop stops the playback and unload the current content
-func (s *Sender) Stop() {
-	ms, _ := s.r.Session(s.ID)
-	if ms == nil {
-		return
+func (s *Sender) Stop(ctx context.Context) error {
+	ms, err := s.mediaSession()
+	if err != nil {
+		return err
 	}
 
-	s.r.Stop(s.ID, ms.MediaSessionID)
+	return s.r.Stop(ctx, s.ID, ms.MediaSessionID)
 }
 
 // SeekTo sets the current playback position to pos,
-func (s *Sender) SeekTo(pos time.Duration) {
-	ms, _ := s.r.Session(s.ID)
-	if ms == nil {
-		return
+func (s *Sender) SeekTo(ctx context.Context, pos time.Duration) error {
+	ms, err := s.mediaSession()
+	if err != nil {
+		return err
+	}
+	if ms.SupportedMediaCommands&CommandSeek == 0 {
+		return omnicast.ErrNotSupported
 	}
 
-	s.r.Seek(s.ID, ms.MediaSessionID, pos.Seconds())
+	return s.r.Seek(ctx, s.ID, ms.MediaSessionID, pos.Seconds())
 }
 
 // VolumeLevel returns receiver volume as a number between 0.0 and 1.0.
@@ -270,19 +323,76 @@ func (s *Sender) IsMuted() bool {
 	return s.r.Volume().Muted
 }
 
+// isVolumeFixed returns true if the receiver volume cannot be changed.
+func (s *Sender) isVolumeFixed() bool {
+	vol := s.r.Volume()
+	return vol != nil && vol.ControlType == VolumeControlFixed
+}
+
 // SetVolumeLevel sets receiver volume level.
-func (s *Sender) SetVolumeLevel(level float64) {
-	s.r.SetVolume(&ReceiverVolume{Level: level})
+func (s *Sender) SetVolumeLevel(ctx context.Context, level float64) error {
+	if s.isVolumeFixed() {
+		return omnicast.ErrNotSupported
+	}
+
+	return s.r.SetVolumeLevel(ctx, level)
 }
 
 // Mute mutes the receiver.
-func (s *Sender) Mute() {
-	s.r.SetVolume(&ReceiverVolume{Muted: true})
+func (s *Sender) Mute(ctx context.Context) error {
+	if s.isVolumeFixed() {
+		return omnicast.ErrNotSupported
+	}
+
+	return s.r.SetMuted(ctx, true)
 }
 
 // Unmute unmutes the receiver.
-func (s *Sender) Unmute() {
-	s.r.SetVolume(&ReceiverVolume{Muted: false})
+func (s *Sender) Unmute(ctx context.Context) error {
+	if s.isVolumeFixed() {
+		return omnicast.ErrNotSupported
+	}
+
+	return s.r.SetMuted(ctx, false)
+}
+
+// Capabilities implements the omnicast.CapabilityReporter interface. The
+// playback capabilities depend on the commands supported by the receiver
+// application for the current media session.
+func (s *Sender) Capabilities() omnicast.Capability {
+	var c omnicast.Capability
+	if s.r.Volume() != nil && !s.isVolumeFixed() {
+		c |= omnicast.CanSetVolume | omnicast.CanMute
+	}
+
+	ms, _ := s.r.Session(s.ID)
+	if ms == nil {
+		return c
+	}
+
+	cmds := ms.SupportedMediaCommands
+	if cmds&CommandPause != 0 {
+		c |= omnicast.CanPause
+	}
+	if cmds&CommandSeek != 0 {
+		c |= omnicast.CanSeek
+	}
+	if cmds&CommandPlaybackRate != 0 {
+		c |= omnicast.CanSetRate
+	}
+	if cmds&CommandQueueNext != 0 {
+		c |= omnicast.CanQueue | omnicast.CanGoNext
+	}
+	if cmds&CommandQueuePrev != 0 {
+		c |= omnicast.CanQueue | omnicast.CanGoPrevious
+	}
+
+	return c
+}
+
+// Subscribe implements the omnicast.EventSource interface.
+func (s *Sender) Subscribe(ctx context.Context) (<-chan *omnicast.Event, error) {
+	return s.r.Subscribe(ctx)
 }
 
 // Close closes the connected receiver, if any.
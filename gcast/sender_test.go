@@ -0,0 +1,310 @@
+package gcast_test
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericyan/omnicast"
+	"github.com/ericyan/omnicast/gcast"
+	"github.com/ericyan/omnicast/gcast/gcasttest"
+	"github.com/ericyan/omnicast/metrics"
+)
+
+func newTestSender(t *testing.T) (*gcast.Sender, *gcasttest.Server) {
+	srv := gcasttest.NewServer("Living Room")
+
+	s, err := gcast.NewSender("sender-test", srv.DeviceInfo())
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+
+	return s, srv
+}
+
+func TestSender(t *testing.T) {
+	s, srv := newTestSender(t)
+	defer srv.Close()
+	defer s.Close()
+
+	ctx := context.Background()
+	if s.Name() != "Living Room" {
+		t.Errorf("Unexpected name: '%s'", s.Name())
+	}
+	if !s.IsIdle() {
+		t.Errorf("Unexpected state: %s", s.PlayerState())
+	}
+	if err := s.Play(ctx); err != omnicast.ErrNoMedia {
+		t.Errorf("Play without media: got %v; want %v", err, omnicast.ErrNoMedia)
+	}
+
+	mediaURL, _ := url.Parse("http://example.com/wall-e.mp4")
+	if err := s.Load(ctx, mediaURL, nil); err != nil {
+		t.Fatal(err)
+	}
+	if app := srv.Application(); app == nil || app.AppID != gcast.DefaultReceiverAppID {
+		t.Errorf("Unexpected application: %+v", app)
+	}
+	if !s.IsPlaying() {
+		t.Errorf("Unexpected state after load: %s", s.PlayerState())
+	}
+	if u := s.MediaURL(); u == nil || u.String() != mediaURL.String() {
+		t.Errorf("Unexpected media URL: %s", u)
+	}
+
+	if err := s.Pause(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsPaused() || srv.MediaSession().PlayerState != "PAUSED" {
+		t.Errorf("Unexpected state after pause: %s", s.PlayerState())
+	}
+
+	if err := s.SeekTo(ctx, 30*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if pos := s.PlaybackPosition(); pos != 30*time.Second {
+		t.Errorf("Unexpected position after seek: %s", pos)
+	}
+
+	if err := s.SetVolumeLevel(ctx, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Mute(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if vol := srv.Volume(); vol.Level != 0.5 || !vol.Muted {
+		t.Errorf("Unexpected receiver volume: %+v", vol)
+	}
+	if s.VolumeLevel() != 0.5 || !s.IsMuted() {
+		t.Errorf("Unexpected volume: %.2f (muted: %t)", s.VolumeLevel(), s.IsMuted())
+	}
+
+	srv.Fail("PLAY", &gcast.RequestError{Type: gcast.TypeInvalidPlayerState})
+	if err, ok := s.Play(ctx).(*gcast.RequestError); !ok || err.Type != gcast.TypeInvalidPlayerState {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsIdle() {
+		t.Errorf("Unexpected state after stop: %s", s.PlayerState())
+	}
+}
+
+func TestSenderCancel(t *testing.T) {
+	s, srv := newTestSender(t)
+	defer srv.Close()
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.SetVolumeLevel(ctx, 0.5); err != context.Canceled {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The request should no longer be pending, even before the reply.
+	buf := new(bytes.Buffer)
+	metrics.WriteTo(buf)
+	if !strings.Contains(buf.String(), "\nomnicast_cast_pending_requests 0\n") {
+		t.Errorf("Cancelled request still pending:\n%s", buf)
+	}
+}
+
+func TestSenderCapabilities(t *testing.T) {
+	s, srv := newTestSender(t)
+	defer srv.Close()
+	defer s.Close()
+
+	ctx := context.Background()
+	mediaURL, _ := url.Parse("http://example.com/live.m3u8")
+	if err := s.Load(ctx, mediaURL, nil); err != nil {
+		t.Fatal(err)
+	}
+	if c := s.Capabilities(); !c.Has(omnicast.CanPause, omnicast.CanSeek, omnicast.CanSetVolume) {
+		t.Errorf("Unexpected capabilities: %s", c)
+	}
+
+	srv.SetSupportedMediaCommands(0)
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(ctx, mediaURL, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Pause(ctx); err != omnicast.ErrNotSupported {
+		t.Errorf("Pause: got %v; want %v", err, omnicast.ErrNotSupported)
+	}
+	if err := s.SeekTo(ctx, time.Second); err != omnicast.ErrNotSupported {
+		t.Errorf("SeekTo: got %v; want %v", err, omnicast.ErrNotSupported)
+	}
+}
+
+func TestSenderEvents(t *testing.T) {
+	s, srv := newTestSender(t)
+	defer srv.Close()
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mediaURL, _ := url.Parse("http://example.com/wall-e.mp4")
+	if err := s.Load(ctx, mediaURL, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := s.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.SetPlayerState("BUFFERING")
+
+	select {
+	case e := <-events:
+		if e.Type != omnicast.StateChanged || e.State != omnicast.StateBuffering {
+			t.Errorf("Unexpected event: %s %s", e.Type, e.State)
+		}
+	case <-time.After(time.Second):
+		t.Error("No event received")
+	}
+}
+
+func TestSenderCustomNamespace(t *testing.T) {
+	s, srv := newTestSender(t)
+	defer srv.Close()
+	defer s.Close()
+
+	const ns = "urn:x-cast:com.example.echo"
+	srv.HandleNamespace(ns, func(msg *gcast.Message) *gcast.Message {
+		return msg
+	})
+
+	received := make(chan *gcast.Message, 2)
+	s.HandleNamespace(ns, func(msg *gcast.Message) {
+		received <- msg
+	})
+
+	if err := s.SendJSON(ns, map[string]string{"text": "hello"}); err != gcast.ErrReceiverNotReady {
+		t.Errorf("SendJSON without application: got %v; want %v", err, gcast.ErrReceiverNotReady)
+	}
+
+	mediaURL, _ := url.Parse("http://example.com/wall-e.mp4")
+	if err := s.Load(context.Background(), mediaURL, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SendJSON(ns, map[string]string{"text": "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SendBinary(ns, []byte{0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-received:
+			if msg.IsBinary() {
+				if string(msg.PayloadBinary) != "\x00\x01\x02" {
+					t.Errorf("Unexpected binary payload: %v", msg.PayloadBinary)
+				}
+
+				continue
+			}
+
+			var v map[string]string
+			if err := msg.Unmarshal(&v); err != nil || v["text"] != "hello" {
+				t.Errorf("Unexpected payload: %s", msg.Payload)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("No message received")
+		}
+	}
+
+	if err := s.SendJSON("com.example.echo", nil); err != gcast.ErrInvalidNamespace {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSenderHandlerRequest(t *testing.T) {
+	s, srv := newTestSender(t)
+	defer srv.Close()
+	defer s.Close()
+
+	const ns = "urn:x-cast:com.example.remote"
+	srv.HandleNamespace(ns, func(msg *gcast.Message) *gcast.Message {
+		return msg
+	})
+
+	// The handler controls the player in turn. Its reply must not be
+	// held up by the next message, which arrives while the handler waits.
+	done := make(chan error, 1)
+	s.HandleNamespace(ns, func(msg *gcast.Message) {
+		var cmd struct{ Command string }
+		if msg.Unmarshal(&cmd); cmd.Command != "quieter" {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		done <- s.SetVolumeLevel(ctx, 0.3)
+	})
+
+	mediaURL, _ := url.Parse("http://example.com/wall-e.mp4")
+	if err := s.Load(context.Background(), mediaURL, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []string{"quieter", "noop"} {
+		if err := s.SendJSON(ns, map[string]string{"command": cmd}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Request from handler failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Handler not called")
+	}
+	if vol := srv.Volume(); vol.Level != 0.3 {
+		t.Errorf("Unexpected receiver volume: %+v", vol)
+	}
+}
+
+func TestSenderAppID(t *testing.T) {
+	s, srv := newTestSender(t)
+	defer srv.Close()
+	defer s.Close()
+
+	ctx := context.Background()
+	mediaURL, _ := url.Parse("http://example.com/wall-e.mp4")
+
+	s.AppID = "ABCD1234"
+	srv.SetAppAvailable(s.AppID, false)
+	if err := s.Load(ctx, mediaURL, nil); err != gcast.ErrAppNotAvailable {
+		t.Errorf("Load with unavailable app: got %v; want %v", err, gcast.ErrAppNotAvailable)
+	}
+
+	srv.SetAppAvailable(s.AppID, true)
+	srv.SetLaunchDelay(100 * time.Millisecond)
+	if err := s.Load(ctx, mediaURL, nil); err != nil {
+		t.Fatal(err)
+	}
+	if app := srv.Application(); app == nil || app.AppID != s.AppID {
+		t.Errorf("Unexpected application: %+v", app)
+	}
+
+	if err := s.LoadInApp(ctx, gcast.DefaultReceiverAppID, mediaURL, nil); err != nil {
+		t.Fatal(err)
+	}
+	if app := srv.Application(); app == nil || app.AppID != gcast.DefaultReceiverAppID {
+		t.Errorf("Unexpected application: %+v", app)
+	}
+}
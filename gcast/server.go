@@ -0,0 +1,609 @@
+package gcast
+
+import (
+	"context"
+	"crypto"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/grandcat/zeroconf"
+
+	"github.com/ericyan/omnicast"
+	"github.com/ericyan/omnicast/gcast/internal/castv2"
+	"github.com/ericyan/omnicast/gcast/internal/castv2/cast_channel"
+)
+
+// A DeviceAuthenticator answers device authentication challenges from
+// senders, which verify that the receiver is a genuine Cast device.
+type DeviceAuthenticator interface {
+	// Authenticate signs the data with RSASSA-PKCS1-v1_5 after hashing it
+	// with the given hash function. It returns the signature and the
+	// certificate chain of the signing key in DER format, leaf first.
+	Authenticate(data []byte, hash crypto.Hash) (signature []byte, chain [][]byte, err error)
+}
+
+// A Server makes a media player available as a Google Cast receiver, so
+// that it can be controlled by Cast senders. It runs an instance of the
+// Default Media Receiver, which loads media into the player.
+type Server struct {
+	Name         string
+	UUID         uuid.UUID
+	Model        string
+	Capabilities DeviceCapability
+
+	// Authenticator answers device authentication challenges. If nil,
+	// challenges are rejected, which is fine for senders not requiring
+	// genuine devices.
+	Authenticator DeviceAuthenticator
+
+	player omnicast.MediaPlayerV2
+	cs     *castv2.Server
+	mdns   *zeroconf.Server
+	cancel context.CancelFunc
+
+	mu             sync.Mutex
+	app            *ReceiverApplication
+	mediaSessionID int
+	idleReason     string
+}
+
+// NewServer returns a Server for the player, which will listen on addr.
+// The UUID is derived from the name, so that it is stable over restarts.
+func NewServer(name string, player omnicast.MediaPlayerV2, addr string) (*Server, error) {
+	s := &Server{
+		Name:         name,
+		UUID:         uuid.UUID(md5.Sum([]byte(name + "Chromecast"))),
+		Model:        "Omnicast",
+		Capabilities: VideoOut | AudioOut,
+		player:       player,
+	}
+	s.cs = &castv2.Server{Addr: addr, Handler: castv2.HandlerFunc(s.serveCast)}
+
+	return s, nil
+}
+
+// txtRecords returns the TXT records for mDNS advertisement.
+func (s *Server) txtRecords() []string {
+	st, rs := "0", ""
+	if app := s.application(); app != nil {
+		st, rs = "1", app.StatusText
+	}
+
+	return []string{
+		"id=" + hex.EncodeToString(s.UUID[:]),
+		"ve=05",
+		"md=" + s.Model,
+		"fn=" + s.Name,
+		"ca=" + strconv.Itoa(int(s.Capabilities)),
+		"st=" + st,
+		"rs=" + rs,
+	}
+}
+
+// ListenAndServe listens on the TCP network address, advertises the
+// receiver via mDNS and then calls Serve to handle incoming connections.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.cs.Addr)
+	if err != nil {
+		return err
+	}
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	instance := "Omnicast-" + hex.EncodeToString(s.UUID[:])
+	mdns, err := zeroconf.Register(instance, "_googlecast._tcp", "local.", port, s.txtRecords(), nil)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	s.mdns = mdns
+	s.mu.Unlock()
+
+	return s.Serve(ln)
+}
+
+// Serve accepts incoming connections on the listener. The receiver will
+// not be advertised.
+func (s *Server) Serve(ln net.Listener) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	if src, ok := s.player.(omnicast.EventSource); ok {
+		if events, err := src.Subscribe(ctx); err == nil {
+			go s.forwardEvents(events)
+		}
+	}
+
+	err := s.cs.Serve(ln)
+	if err == castv2.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+// forwardEvents broadcasts status changes of the player to senders.
+func (s *Server) forwardEvents(events <-chan *omnicast.Event) {
+	for e := range events {
+		switch e.Type {
+		case omnicast.VolumeChanged:
+			s.broadcastReceiverStatus(nil)
+		default:
+			s.broadcastMediaStatus(nil)
+		}
+	}
+}
+
+// Close stops advertising the receiver and closes all connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.mdns != nil {
+		s.mdns.Shutdown()
+		s.mdns = nil
+	}
+	s.mu.Unlock()
+
+	return s.cs.Close()
+}
+
+func (s *Server) application() *ReceiverApplication {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.app
+}
+
+// setApplication changes the running application and updates the TXT
+// records accordingly.
+func (s *Server) setApplication(app *ReceiverApplication) {
+	s.mu.Lock()
+	s.app = app
+	mdns := s.mdns
+	s.mu.Unlock()
+
+	if mdns != nil {
+		mdns.SetText(s.txtRecords())
+	}
+}
+
+// serverRequest is the union of requests handled by the Server.
+type serverRequest struct {
+	castv2.Header
+
+	// Receiver namespace
+	AppID     json.RawMessage `json:"appId"`
+	SessionID string          `json:"sessionId"`
+	Volume    struct {
+		Level *float64 `json:"level"`
+		Muted *bool    `json:"muted"`
+	} `json:"volume"`
+
+	// Media namespace
+	Media          *MediaInformation `json:"media"`
+	Autoplay       *bool             `json:"autoplay"`
+	MediaSessionID int               `json:"mediaSessionId"`
+	CurrentTime    float64           `json:"currentTime"`
+	ResumeState    string            `json:"resumeState"`
+}
+
+func (s *Server) serveCast(c *castv2.Conn, msg *castv2.Msg) {
+	if msg.Namespace == castv2.NamespaceDeviceAuth {
+		s.handleDeviceAuth(c, msg)
+		return
+	}
+
+	req := new(serverRequest)
+	if err := json.Unmarshal([]byte(msg.Payload), req); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	var err error
+	switch msg.Namespace {
+	case castv2.NamespaceReceiver:
+		err = s.handleReceiverRequest(ctx, c, msg, req)
+	case castv2.NamespaceMedia:
+		app := s.application()
+		if app == nil || msg.DestinationID != app.TransportID {
+			return
+		}
+
+		err = s.handleMediaRequest(ctx, c, msg, req)
+	default:
+		return
+	}
+
+	if err != nil {
+		rerr, ok := err.(*RequestError)
+		if !ok {
+			log.Printf("gcast: %s failed: %s\n", req.Type, err)
+
+			rerr = &RequestError{Type: TypeInvalidPlayerState}
+			if err == omnicast.ErrNotSupported {
+				rerr = &RequestError{Type: TypeInvalidRequest, Reason: "NOT_SUPPORTED"}
+			}
+		}
+
+		c.Reply(msg, &struct {
+			RequestID uint64 `json:"requestId"`
+			*RequestError
+		}{req.RequestID, rerr})
+	}
+}
+
+func (s *Server) handleReceiverRequest(ctx context.Context, c *castv2.Conn, msg *castv2.Msg, req *serverRequest) error {
+	switch req.Type {
+	case castv2.TypeGetStatus:
+	case castv2.TypeGetAppAvailability:
+		var appIDs []string
+		json.Unmarshal(req.AppID, &appIDs)
+
+		availability := make(map[string]string)
+		for _, id := range appIDs {
+			if id == DefaultReceiverAppID {
+				availability[id] = "APP_AVAILABLE"
+			} else {
+				availability[id] = "APP_UNAVAILABLE"
+			}
+		}
+
+		return c.Reply(msg, &struct {
+			RequestID    uint64            `json:"requestId"`
+			ResponseType string            `json:"responseType"`
+			Availability map[string]string `json:"availability"`
+		}{req.RequestID, castv2.TypeGetAppAvailability, availability})
+	case castv2.TypeLaunch:
+		var appID string
+		json.Unmarshal(req.AppID, &appID)
+		if appID != DefaultReceiverAppID {
+			return &RequestError{Type: TypeLaunchError, Reason: "NOT_FOUND"}
+		}
+
+		if s.application() == nil {
+			sessionID := uuid.New().String()
+			s.setApplication(&ReceiverApplication{
+				AppID:               DefaultReceiverAppID,
+				Name:                "Default Media Receiver",
+				StatusText:          "Ready To Cast",
+				SupportedNamespaces: []map[string]string{{"name": castv2.NamespaceMedia}},
+				SessionID:           sessionID,
+				TransportID:         sessionID,
+			})
+		}
+	case castv2.TypeStop:
+		app := s.application()
+		if app == nil || (req.SessionID != "" && req.SessionID != app.SessionID) {
+			return &RequestError{Type: TypeInvalidRequest, Reason: "INVALID_SESSION_ID"}
+		}
+
+		if err := s.player.Stop(ctx); err != nil && err != omnicast.ErrNoMedia {
+			return err
+		}
+		s.setApplication(nil)
+	case castv2.TypeSetVolume:
+		if err := s.setVolume(ctx, req.Volume.Level, req.Volume.Muted); err != nil {
+			return err
+		}
+	default:
+		return &RequestError{Type: TypeInvalidRequest, Reason: "INVALID_COMMAND"}
+	}
+
+	c.Reply(msg, s.receiverStatus(req.RequestID))
+	if req.Type != castv2.TypeGetStatus {
+		s.broadcastReceiverStatus(c)
+	}
+
+	return nil
+}
+
+func (s *Server) handleMediaRequest(ctx context.Context, c *castv2.Conn, msg *castv2.Msg, req *serverRequest) error {
+	var err error
+	switch req.Type {
+	case castv2.TypeGetStatus:
+	case castv2.TypeLoad:
+		err = s.load(ctx, req.Media, req.Autoplay, req.CurrentTime)
+	case castv2.TypeSetVolume:
+		err = s.setVolume(ctx, req.Volume.Level, req.Volume.Muted)
+	default:
+		err = s.control(ctx, req.Type, req.MediaSessionID, req.CurrentTime, req.ResumeState)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.Reply(msg, s.mediaStatus(req.RequestID))
+	if req.Type != castv2.TypeGetStatus {
+		s.broadcastMediaStatus(c)
+	}
+
+	return nil
+}
+
+func (s *Server) load(ctx context.Context, media *MediaInformation, autoplay *bool, currentTime float64) error {
+	if media == nil {
+		return &RequestError{Type: TypeLoadFailed}
+	}
+
+	mediaURL, err := url.Parse(media.ContentID)
+	if err != nil || !mediaURL.IsAbs() {
+		return &RequestError{Type: TypeLoadFailed}
+	}
+
+	var metadata omnicast.MediaMetadata
+	if media.Metadata != nil {
+		metadata = media.Metadata
+	}
+
+	if err := s.player.Load(ctx, mediaURL, metadata); err != nil {
+		log.Printf("gcast: LOAD failed: %s\n", err)
+		return &RequestError{Type: TypeLoadFailed}
+	}
+
+	s.mu.Lock()
+	s.mediaSessionID++
+	s.idleReason = ""
+	s.mu.Unlock()
+
+	if currentTime > 0 {
+		if err := s.player.SeekTo(ctx, time.Duration(currentTime*float64(time.Second))); err != nil {
+			log.Printf("gcast: failed to seek after LOAD: %s\n", err)
+		}
+	}
+	if autoplay != nil && !*autoplay {
+		if err := s.player.Pause(ctx); err != nil {
+			log.Printf("gcast: failed to pause after LOAD: %s\n", err)
+		}
+	}
+
+	return nil
+}
+
+// control handles the media commands with a media session.
+func (s *Server) control(ctx context.Context, cmd string, mediaSessionID int, currentTime float64, resumeState string) error {
+	s.mu.Lock()
+	current := s.mediaSessionID
+	s.mu.Unlock()
+
+	if current == 0 || mediaSessionID != current {
+		return &RequestError{Type: TypeInvalidRequest, Reason: "INVALID_MEDIA_SESSION_ID"}
+	}
+
+	switch cmd {
+	case castv2.TypePlay:
+		return s.player.Play(ctx)
+	case castv2.TypePause:
+		return s.player.Pause(ctx)
+	case castv2.TypeStop:
+		if err := s.player.Stop(ctx); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.idleReason = "CANCELLED"
+		s.mu.Unlock()
+
+		return nil
+	case castv2.TypeSeek:
+		if err := s.player.SeekTo(ctx, time.Duration(currentTime*float64(time.Second))); err != nil {
+			return err
+		}
+
+		switch resumeState {
+		case "PLAYBACK_START":
+			return s.player.Play(ctx)
+		case "PLAYBACK_PAUSE":
+			return s.player.Pause(ctx)
+		}
+
+		return nil
+	default:
+		return &RequestError{Type: TypeInvalidRequest, Reason: "INVALID_COMMAND"}
+	}
+}
+
+func (s *Server) setVolume(ctx context.Context, level *float64, muted *bool) error {
+	if level != nil {
+		if err := s.player.SetVolumeLevel(ctx, *level); err != nil {
+			return err
+		}
+	}
+
+	if muted != nil {
+		if *muted {
+			return s.player.Mute(ctx)
+		}
+
+		return s.player.Unmute(ctx)
+	}
+
+	return nil
+}
+
+// handleDeviceAuth answers the device authentication challenge.
+func (s *Server) handleDeviceAuth(c *castv2.Conn, msg *castv2.Msg) {
+	req := new(cast_channel.DeviceAuthMessage)
+	if err := proto.Unmarshal(msg.PayloadBinary, req); err != nil || req.Challenge == nil {
+		return
+	}
+
+	resp := new(cast_channel.DeviceAuthMessage)
+	if s.Authenticator == nil {
+		resp.Error = &cast_channel.AuthError{ErrorType: cast_channel.AuthError_INTERNAL_ERROR.Enum()}
+	} else {
+		hash := crypto.SHA1
+		if req.Challenge.GetHashAlgorithm() == cast_channel.HashAlgorithm_SHA256 {
+			hash = crypto.SHA256
+		}
+
+		// The signature covers the sender nonce and the TLS certificate, so
+		// that it cannot be replayed.
+		nonce := req.Challenge.GetSenderNonce()
+		data := append(append([]byte{}, nonce...), c.Certificate()...)
+
+		sig, chain, err := s.Authenticator.Authenticate(data, hash)
+		if err != nil || len(chain) == 0 {
+			log.Println("gcast: device authentication failed:", err)
+			resp.Error = &cast_channel.AuthError{ErrorType: cast_channel.AuthError_INTERNAL_ERROR.Enum()}
+		} else {
+			resp.Response = &cast_channel.AuthResponse{
+				Signature:               sig,
+				ClientAuthCertificate:   chain[0],
+				IntermediateCertificate: chain[1:],
+				SignatureAlgorithm:      cast_channel.SignatureAlgorithm_RSASSA_PKCS1v15.Enum(),
+				SenderNonce:             nonce,
+				HashAlgorithm:           req.Challenge.GetHashAlgorithm().Enum(),
+			}
+		}
+	}
+
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		return
+	}
+
+	c.Send(&castv2.Msg{
+		SourceID:      msg.DestinationID,
+		DestinationID: msg.SourceID,
+		Namespace:     msg.Namespace,
+		PayloadBinary: data,
+	})
+}
+
+func (s *Server) receiverStatus(reqID uint64) *ReceiverStatus {
+	rs := &ReceiverStatus{Header: castv2.Header{RequestID: reqID, Type: castv2.TypeReceiverStatus}}
+	if app := s.application(); app != nil {
+		rs.Status.Applications = []*ReceiverApplication{app}
+	}
+
+	controlType := VolumeControlAttenuation
+	if !omnicast.CapabilitiesOf(s.player).Has(omnicast.CanSetVolume) {
+		controlType = VolumeControlFixed
+	}
+	rs.Status.Volume = &ReceiverVolume{
+		ControlType:  controlType,
+		Level:        s.player.VolumeLevel(),
+		Muted:        s.player.IsMuted(),
+		StepInterval: 0.05,
+	}
+
+	return rs
+}
+
+// playerState converts the playback state into a Cast player state.
+func playerState(state omnicast.PlaybackState) string {
+	switch state {
+	case omnicast.StatePlaying:
+		return "PLAYING"
+	case omnicast.StatePaused:
+		return "PAUSED"
+	case omnicast.StateBuffering:
+		return "BUFFERING"
+	default:
+		return "IDLE"
+	}
+}
+
+// mediaCommands returns the media commands supported with capabilities.
+func mediaCommands(c omnicast.Capability) MediaCommand {
+	var cmds MediaCommand
+	if c.Has(omnicast.CanPause) {
+		cmds |= CommandPause
+	}
+	if c.Has(omnicast.CanSeek) {
+		cmds |= CommandSeek
+	}
+	if c.Has(omnicast.CanSetVolume) {
+		cmds |= CommandStreamVolume | CommandStreamMute
+	}
+
+	return cmds
+}
+
+func (s *Server) mediaStatus(reqID uint64) interface{} {
+	ms := &struct {
+		castv2.Header
+		MediaStatus
+	}{Header: castv2.Header{RequestID: reqID, Type: castv2.TypeMediaStatus}}
+	ms.Status = []*MediaSession{}
+
+	s.mu.Lock()
+	mediaSessionID, idleReason := s.mediaSessionID, s.idleReason
+	s.mu.Unlock()
+
+	if mediaSessionID == 0 {
+		return ms
+	}
+
+	p := s.player
+	session := &MediaSession{
+		MediaSessionID:         mediaSessionID,
+		PlaybackRate:           p.PlaybackRate(),
+		PlayerState:            playerState(omnicast.StateOf(p)),
+		CurrentTime:            p.PlaybackPosition().Seconds(),
+		SupportedMediaCommands: mediaCommands(omnicast.CapabilitiesOf(p)),
+	}
+	if session.PlayerState == "IDLE" {
+		session.IdleReason = idleReason
+		if idleReason == "" {
+			session.IdleReason = "FINISHED"
+		}
+	}
+
+	if u := p.MediaURL(); u != nil {
+		session.Media = &MediaInformation{
+			ContentID:   u.String(),
+			ContentType: contentType(u),
+			StreamType:  "BUFFERED",
+			Metadata:    NewMediaMetadata(omnicast.DetailsOf(p.MediaMetadata())),
+			Duration:    p.MediaDuration().Seconds(),
+		}
+	}
+	ms.Status = append(ms.Status, session)
+
+	return ms
+}
+
+// broadcast sends the payload to all senders, except the given one.
+func (s *Server) broadcast(except *castv2.Conn, srcID, namespace string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	s.cs.Broadcast(&castv2.Msg{
+		SourceID:      srcID,
+		DestinationID: "*",
+		Namespace:     namespace,
+		Payload:       string(data),
+	}, except)
+}
+
+func (s *Server) broadcastReceiverStatus(except *castv2.Conn) {
+	s.broadcast(except, castv2.PlatformReceiverID, castv2.NamespaceReceiver, s.receiverStatus(0))
+}
+
+func (s *Server) broadcastMediaStatus(except *castv2.Conn) {
+	app := s.application()
+	if app == nil {
+		return
+	}
+
+	s.broadcast(except, app.TransportID, castv2.NamespaceMedia, s.mediaStatus(0))
+}
@@ -0,0 +1,111 @@
+package gcast_test
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ericyan/omnicast"
+	"github.com/ericyan/omnicast/gcast"
+	"github.com/ericyan/omnicast/omnicasttest"
+)
+
+func TestServer(t *testing.T) {
+	player := omnicasttest.NewPlayer("Test Player")
+	srv, err := gcast.NewServer("Test Player", player, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	s, err := gcast.NewSender("sender-test", &gcast.DeviceInfo{Name: srv.Name, IPv4: addr.IP, Port: addr.Port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	mediaURL, _ := url.Parse("http://example.com/wall-e.mp4")
+	md := &omnicast.MediaDetails{Type: omnicast.Movie, Title: "WALL-E"}
+	if err := s.Load(ctx, mediaURL, md.Metadata()); err != nil {
+		t.Fatal(err)
+	}
+	if u := player.MediaURL(); u == nil || u.String() != mediaURL.String() {
+		t.Errorf("Unexpected media URL: %s", u)
+	}
+	if d := omnicast.DetailsOf(player.MediaMetadata()); d == nil || d.Type != omnicast.Movie || d.Title != "WALL-E" {
+		t.Errorf("Unexpected metadata: %+v", d)
+	}
+	if !s.IsPlaying() {
+		t.Errorf("Unexpected state after load: %s", s.PlayerState())
+	}
+
+	if err := s.Pause(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !player.IsPaused() {
+		t.Errorf("Unexpected state after pause: %s", player.State())
+	}
+
+	if err := s.SeekTo(ctx, 30*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if pos := player.PlaybackPosition(); pos != 30*time.Second {
+		t.Errorf("Unexpected position after seek: %s", pos)
+	}
+
+	if err := s.SetVolumeLevel(ctx, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Mute(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if player.VolumeLevel() != 0.5 || !player.IsMuted() {
+		t.Errorf("Unexpected volume: %.2f (muted: %t)", player.VolumeLevel(), player.IsMuted())
+	}
+
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !player.IsIdle() {
+		t.Errorf("Unexpected state after stop: %s", player.State())
+	}
+}
+
+func TestServerIPv6Fallback(t *testing.T) {
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 unavailable:", err)
+	}
+
+	player := omnicasttest.NewPlayer("Test Player")
+	srv, err := gcast.NewServer("Test Player", player, "[::1]:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	// Nothing listens on the IPv4 address, so IPv6 will be used.
+	port := ln.Addr().(*net.TCPAddr).Port
+	dev := &gcast.DeviceInfo{Name: srv.Name, IPv4: net.IPv4(127, 0, 0, 1), IPv6: net.IPv6loopback, Port: port}
+	s, err := gcast.NewSender("sender-test", dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	dev.IPv4 = nil
+	if addr := dev.TCPAddr(); !addr.IP.Equal(net.IPv6loopback) {
+		t.Errorf("Unexpected address: %s", addr)
+	}
+}
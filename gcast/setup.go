@@ -0,0 +1,310 @@
+package gcast
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Ports of the local setup API. Newer firmware only serves it over HTTPS,
+// with a self-signed certificate.
+const (
+	SetupPortHTTP  = 8008
+	SetupPortHTTPS = 8443
+)
+
+// eurekaInfoParams are the sections requested from the setup API. Newer
+// firmware returns them nested, while older firmware ignores the params
+// and returns a flat object.
+const eurekaInfoParams = "version,name,build_info,device_info,net,wifi,settings"
+
+// EurekaInfo represents the device details returned by the setup API.
+type EurekaInfo struct {
+	Name         string
+	UUID         uuid.UUID
+	Model        string
+	Manufacturer string
+
+	IPAddress  net.IP
+	MACAddress string
+	SSID       string
+
+	BuildVersion      string
+	CastBuildRevision string
+	ReleaseTrack      string
+	Version           int
+	Uptime            time.Duration
+
+	TimeZone string
+	Locale   string
+
+	// Capabilities are the features reported by newer firmware, such as
+	// display_supported or multizone_supported.
+	Capabilities map[string]bool
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. Both the flat
+// format of older firmware and the nested format of newer one are
+// accepted.
+func (info *EurekaInfo) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Name              string  `json:"name"`
+		SSDPUDN           string  `json:"ssdp_udn"`
+		IPAddress         string  `json:"ip_address"`
+		MACAddress        string  `json:"mac_address"`
+		SSID              string  `json:"ssid"`
+		BuildVersion      string  `json:"build_version"`
+		CastBuildRevision string  `json:"cast_build_revision"`
+		ReleaseTrack      string  `json:"release_track"`
+		Version           int     `json:"version"`
+		Uptime            float64 `json:"uptime"`
+		TimeZone          string  `json:"timezone"`
+		Locale            string  `json:"locale"`
+
+		BuildInfo struct {
+			CastBuildRevision string `json:"cast_build_revision"`
+			SystemBuildNumber string `json:"system_build_number"`
+			ReleaseTrack      string `json:"release_track"`
+		} `json:"build_info"`
+		DeviceInfo struct {
+			SSDPUDN      string          `json:"ssdp_udn"`
+			MACAddress   string          `json:"mac_address"`
+			ModelName    string          `json:"model_name"`
+			Manufacturer string          `json:"manufacturer"`
+			Uptime       float64         `json:"uptime"`
+			Capabilities map[string]bool `json:"capabilities"`
+		} `json:"device_info"`
+		Net struct {
+			IPAddress string `json:"ip_address"`
+		} `json:"net"`
+		Wifi struct {
+			SSID string `json:"ssid"`
+		} `json:"wifi"`
+		Settings struct {
+			TimeZone string `json:"timezone"`
+			Locale   string `json:"locale"`
+		} `json:"settings"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	// first returns the first non-empty string.
+	first := func(s ...string) string {
+		for _, v := range s {
+			if v != "" {
+				return v
+			}
+		}
+
+		return ""
+	}
+
+	info.Name = v.Name
+	info.UUID, _ = uuid.Parse(first(v.DeviceInfo.SSDPUDN, v.SSDPUDN))
+	info.Model = v.DeviceInfo.ModelName
+	info.Manufacturer = v.DeviceInfo.Manufacturer
+	info.IPAddress = net.ParseIP(first(v.Net.IPAddress, v.IPAddress))
+	info.MACAddress = first(v.DeviceInfo.MACAddress, v.MACAddress)
+	info.SSID = first(v.Wifi.SSID, v.SSID)
+	info.BuildVersion = first(v.BuildInfo.SystemBuildNumber, v.BuildVersion)
+	info.CastBuildRevision = first(v.BuildInfo.CastBuildRevision, v.CastBuildRevision)
+	info.ReleaseTrack = first(v.BuildInfo.ReleaseTrack, v.ReleaseTrack)
+	info.Version = v.Version
+	info.TimeZone = first(v.Settings.TimeZone, v.TimeZone)
+	info.Locale = first(v.Settings.Locale, v.Locale)
+	info.Capabilities = v.DeviceInfo.Capabilities
+
+	uptime := v.DeviceInfo.Uptime
+	if uptime == 0 {
+		uptime = v.Uptime
+	}
+	info.Uptime = time.Duration(uptime * float64(time.Second))
+
+	return nil
+}
+
+// DeviceInfo returns the information needed to connect to the device.
+// Devices not reporting capabilities are assumed to have video output.
+func (info *EurekaInfo) DeviceInfo() *DeviceInfo {
+	dev := &DeviceInfo{
+		UUID:  info.UUID,
+		Name:  info.Name,
+		Model: info.Model,
+		Port:  8009,
+	}
+
+	if ip := info.IPAddress.To4(); ip != nil {
+		dev.IPv4 = ip
+	} else {
+		dev.IPv6 = info.IPAddress
+	}
+
+	if info.Capabilities == nil || info.Capabilities["display_supported"] {
+		dev.SetCapabilities(VideoOut, AudioOut)
+	} else {
+		dev.SetCapabilities(AudioOut)
+	}
+
+	return dev
+}
+
+// A SetupError is returned when the setup API rejects a request.
+type SetupError struct {
+	StatusCode int
+	Status     string
+}
+
+// Error implements the error interface.
+func (err *SetupError) Error() string {
+	return "gcast: setup API: " + err.Status
+}
+
+// setupTimeout is the maximum time to wait for the setup API.
+const setupTimeout = 5 * time.Second
+
+// A SetupClient is a client of the local setup API of a device, which
+// is used by the Google Home app to configure the device.
+type SetupClient struct {
+	// BaseURL is the URL of the setup API, such as https://host:8443.
+	// If empty, HTTPS will be tried first, falling back to HTTP.
+	BaseURL string
+
+	// Token is sent as the local authorization token, which is required
+	// by newer firmware for some requests.
+	Token string
+
+	// HTTPClient is used to make requests. If nil, a client accepting
+	// the self-signed certificates of devices will be used.
+	HTTPClient *http.Client
+
+	host string
+	mu   sync.Mutex
+}
+
+// NewSetupClient returns a SetupClient for the device at the IP address.
+func NewSetupClient(ip net.IP) *SetupClient {
+	return &SetupClient{host: ip.String()}
+}
+
+var defaultSetupHTTPClient = &http.Client{
+	Timeout: setupTimeout,
+	Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+}
+
+func (c *SetupClient) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return defaultSetupHTTPClient
+}
+
+// baseURLs returns the candidate base URLs, in the order to try.
+func (c *SetupClient) baseURLs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.BaseURL != "" {
+		return []string{c.BaseURL}
+	}
+
+	return []string{
+		"https://" + net.JoinHostPort(c.host, strconv.Itoa(SetupPortHTTPS)),
+		"http://" + net.JoinHostPort(c.host, strconv.Itoa(SetupPortHTTP)),
+	}
+}
+
+// do sends the request with the JSON body, if not nil, and decodes the
+// JSON response into v, if not nil. The first base URL reachable will be
+// used for later requests.
+func (c *SetupClient) do(ctx context.Context, method, path string, body, v interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	var resp *http.Response
+	var err error
+	for _, base := range c.baseURLs() {
+		var req *http.Request
+		req, err = http.NewRequest(method, base+path, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.Token != "" {
+			req.Header.Set("cast-local-authorization-token", c.Token)
+		}
+
+		resp, err = c.httpClient().Do(req)
+		if err == nil {
+			c.mu.Lock()
+			c.BaseURL = base
+			c.mu.Unlock()
+
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return &SetupError{resp.StatusCode, resp.Status}
+	}
+
+	if v == nil {
+		_, err := io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// EurekaInfo returns the device details.
+func (c *SetupClient) EurekaInfo(ctx context.Context) (*EurekaInfo, error) {
+	info := new(EurekaInfo)
+	path := "/setup/eureka_info?options=detail&params=" + eurekaInfoParams
+	if err := c.do(ctx, http.MethodGet, path, nil, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// SetEurekaInfo changes the device settings, with v being encoded into
+// JSON in the same structure as returned by the setup API.
+func (c *SetupClient) SetEurekaInfo(ctx context.Context, v interface{}) error {
+	return c.do(ctx, http.MethodPost, "/setup/set_eureka_info", v, nil)
+}
+
+// Rename changes the friendly name of the device.
+func (c *SetupClient) Rename(ctx context.Context, name string) error {
+	return c.SetEurekaInfo(ctx, map[string]string{"name": name})
+}
+
+// Reboot reboots the device.
+func (c *SetupClient) Reboot(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/setup/reboot", map[string]string{"params": "now"}, nil)
+}
@@ -0,0 +1,152 @@
+package gcast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strconv"
+)
+
+// DefaultPort is the port of the Cast V2 protocol.
+const DefaultPort = 8009
+
+// StaticDevices are the devices which are always discovered, in addition
+// to those found via mDNS, for networks where multicast does not work.
+var StaticDevices []*DeviceInfo
+
+// A StaticDevice configures a device addressed directly.
+type StaticDevice struct {
+	// Address is the IP address or host name of the device, with an
+	// optional port, which defaults to DefaultPort.
+	Address string `json:"address"`
+
+	// Name overrides the name reported by the device.
+	Name string `json:"name,omitempty"`
+
+	// SetupURL is the base URL of the setup API, if not at the default
+	// ports of the device address.
+	SetupURL string `json:"setup_url,omitempty"`
+}
+
+// Lookup returns the information of the device. It is populated from the
+// setup API of the device, if available, or the configuration otherwise.
+func (sd *StaticDevice) Lookup(ctx context.Context) (*DeviceInfo, error) {
+	host, port := sd.Address, strconv.Itoa(DefaultPort)
+	if h, p, err := net.SplitHostPort(sd.Address); err == nil {
+		host, port = h, p
+	}
+
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, errors.New("invalid port: " + port)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		ip = ips[0]
+	}
+
+	c := NewSetupClient(ip)
+	c.BaseURL = sd.SetupURL
+
+	var dev *DeviceInfo
+	if info, err := c.EurekaInfo(ctx); err == nil {
+		dev = info.DeviceInfo()
+	} else {
+		log.Printf("gcast: setup API of %s unavailable: %s\n", sd.Address, err)
+		dev = new(DeviceInfo)
+		dev.SetCapabilities(VideoOut, AudioOut)
+	}
+
+	// The device is addressed as configured, which may differ from what
+	// it sees behind NAT.
+	dev.IPv4, dev.IPv6 = nil, nil
+	if ip4 := ip.To4(); ip4 != nil {
+		dev.IPv4 = ip4
+	} else {
+		dev.IPv6 = ip
+	}
+	dev.Port = portNum
+
+	if sd.Name != "" {
+		dev.Name = sd.Name
+	}
+	if dev.Name == "" {
+		dev.Name = sd.Address
+	}
+
+	return dev, nil
+}
+
+// Lookup returns the information of the device at the address, which is
+// an IP address or host name with an optional port.
+func Lookup(addr string) (*DeviceInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+	defer cancel()
+
+	sd := &StaticDevice{Address: addr}
+	return sd.Lookup(ctx)
+}
+
+// isAddress returns true if the device hint is an IP address or a
+// host:port pair, rather than a name or UUID.
+func isAddress(hint string) bool {
+	if net.ParseIP(hint) != nil {
+		return true
+	}
+
+	_, port, err := net.SplitHostPort(hint)
+	if err != nil {
+		return false
+	}
+	_, err = strconv.Atoi(port)
+	return err == nil
+}
+
+// LoadStaticDevices reads the static device configuration from the JSON
+// file, and looks up the devices. A configuration file looks like:
+//
+//	{
+//	  "devices": [
+//	    {"address": "192.168.1.10"},
+//	    {"address": "tv.lan:8009", "name": "Living Room TV"}
+//	  ]
+//	}
+//
+// Devices failing the lookup are skipped, with the error logged.
+func LoadStaticDevices(filename string) ([]*DeviceInfo, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config struct {
+		Devices []*StaticDevice `json:"devices"`
+	}
+	if err := json.NewDecoder(f).Decode(&config); err != nil {
+		return nil, err
+	}
+
+	var devices []*DeviceInfo
+	for _, sd := range config.Devices {
+		ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+		dev, err := sd.Lookup(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("gcast: failed to look up %s: %s\n", sd.Address, err)
+			continue
+		}
+
+		devices = append(devices, dev)
+	}
+
+	return devices, nil
+}
@@ -0,0 +1,82 @@
+package gcast_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ericyan/omnicast/gcast"
+	"github.com/ericyan/omnicast/gcast/gcasttest"
+)
+
+func TestLoadStaticDevices(t *testing.T) {
+	srv := gcasttest.NewServer("Living Room")
+	defer srv.Close()
+
+	addr := "127.0.0.1:" + strconv.Itoa(srv.DeviceInfo().Port)
+	config := map[string]interface{}{
+		"devices": []map[string]string{
+			{"address": addr, "setup_url": srv.EurekaURL()},
+			{"address": addr, "setup_url": srv.EurekaURL(), "name": "TV"},
+			{"address": "127.0.0.1:cast"},
+		},
+	}
+
+	f, err := ioutil.TempFile("", "gcast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	json.NewEncoder(f).Encode(config)
+	f.Close()
+
+	devices, err := gcast.LoadStaticDevices(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("Unexpected devices: %+v", devices)
+	}
+	if dev := devices[0]; dev.Name != "Living Room" || dev.UUID != srv.UUID || dev.TCPAddr().String() != addr {
+		t.Errorf("Unexpected device: %+v", dev)
+	}
+	if dev := devices[1]; dev.Name != "TV" {
+		t.Errorf("Unexpected name: '%s'", dev.Name)
+	}
+
+	defer func(devices []*gcast.DeviceInfo) { gcast.StaticDevices = devices }(gcast.StaticDevices)
+	gcast.StaticDevices = devices[1:]
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	ch, err := gcast.Discover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev := <-ch; dev != devices[1] {
+		t.Errorf("Unexpected device discovered: %+v", dev)
+	}
+}
+
+func TestFindByAddress(t *testing.T) {
+	srv := gcasttest.NewServer("Living Room")
+	defer srv.Close()
+
+	// The setup API is not at the default ports, so the address is used
+	// as the name.
+	addr := "127.0.0.1:" + strconv.Itoa(srv.DeviceInfo().Port)
+	s, err := gcast.Find(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if s.Name() != addr {
+		t.Errorf("Unexpected name: '%s'", s.Name())
+	}
+}
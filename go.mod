@@ -3,11 +3,11 @@ module github.com/ericyan/omnicast
 go 1.13
 
 require (
-	github.com/ericyan/iputil v0.0.0-20181119160942-ff4fa813540d
+	github.com/eclipse/paho.mqtt.golang v1.3.5
 	github.com/godbus/dbus/v5 v5.0.3
 	github.com/gogo/protobuf v1.3.2
 	github.com/google/uuid v1.1.1
 	github.com/grandcat/zeroconf v1.0.0
-	github.com/rakyll/statik v0.1.6
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974
 	golang.org/x/sync v0.0.0-20201020160332-67f06af15bc9
 )
@@ -0,0 +1,135 @@
+package omnicast
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// MediaType represents the type of a media artefact. The values are the
+// same as the metadataType used by Google Cast.
+type MediaType uint
+
+// Defined media types.
+const (
+	GenericMedia MediaType = iota
+	Movie
+	TVShow
+	MusicTrack
+	Photo
+)
+
+// String returns the string representation of the media type.
+func (t MediaType) String() string {
+	switch t {
+	case GenericMedia:
+		return "generic"
+	case Movie:
+		return "movie"
+	case TVShow:
+		return "tv_show"
+	case MusicTrack:
+		return "music_track"
+	case Photo:
+		return "photo"
+	default:
+		return strconv.Itoa(int(t))
+	}
+}
+
+// MediaDetails is a structured description of a media artefact. Fields
+// not applicable to the media type are left empty. Dates are strings in
+// ISO 8601 format, as used by all of Google Cast, DIDL-Lite and xesam.
+//
+// Ref: https://developers.google.com/cast/docs/reference/messages#MediaData
+type MediaDetails struct {
+	Type MediaType
+
+	// Generic
+	Title       string
+	Subtitle    string
+	Images      []*url.URL
+	ReleaseDate string
+
+	// Movie
+	Studio string
+
+	// TV show
+	SeriesTitle     string
+	Season          int
+	Episode         int
+	OriginalAirdate string
+
+	// Music track, artist also applies to photos.
+	Artist      string
+	AlbumName   string
+	AlbumArtist string
+	Composer    string
+	TrackNumber int
+	DiscNumber  int
+
+	// Photo
+	Location         string
+	Latitude         float64
+	Longitude        float64
+	Width            int
+	Height           int
+	CreationDateTime string
+}
+
+// MediaDetailer is implemented by MediaMetadata which are able to provide
+// more than the generic title, subtitle and image.
+type MediaDetailer interface {
+	MediaDetails() *MediaDetails
+}
+
+// DetailsOf returns the details of the media metadata. If m does not
+// implement MediaDetailer, a generic description is returned.
+func DetailsOf(m MediaMetadata) *MediaDetails {
+	if m == nil {
+		return nil
+	}
+
+	if d, ok := m.(MediaDetailer); ok {
+		return d.MediaDetails()
+	}
+
+	d := &MediaDetails{
+		Type:     GenericMedia,
+		Title:    m.Title(),
+		Subtitle: m.Subtitle(),
+	}
+	if u := m.ImageURL(); u != nil {
+		d.Images = []*url.URL{u}
+	}
+
+	return d
+}
+
+// Metadata returns the details as MediaMetadata.
+func (d *MediaDetails) Metadata() MediaMetadata {
+	return detailedMetadata{d}
+}
+
+type detailedMetadata struct {
+	d *MediaDetails
+}
+
+func (m detailedMetadata) Title() string {
+	return m.d.Title
+}
+
+func (m detailedMetadata) Subtitle() string {
+	return m.d.Subtitle
+}
+
+func (m detailedMetadata) ImageURL() *url.URL {
+	if len(m.d.Images) == 0 {
+		return nil
+	}
+
+	return m.d.Images[0]
+}
+
+func (m detailedMetadata) MediaDetails() *MediaDetails {
+	return m.d
+}
@@ -0,0 +1,106 @@
+package omnicast_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ericyan/omnicast"
+	"github.com/ericyan/omnicast/gcast"
+	"github.com/ericyan/omnicast/mpris"
+	"github.com/ericyan/omnicast/omnicasttest"
+	"github.com/ericyan/omnicast/upnp"
+	"github.com/ericyan/omnicast/upnp/av"
+)
+
+// TestMetadataRoundTrip passes metadata from DLNA, through Cast, to MPRIS.
+// The DIDL-Lite metadata is loaded by a DLNA renderer, as it would be by
+// a control point.
+func TestMetadataRoundTrip(t *testing.T) {
+	player := omnicasttest.NewPlayer("Test Player")
+	dev, err := av.NewMediaRenderer("Test Renderer", player)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(dev)
+	defer srv.Close()
+
+	loc, _ := url.Parse(srv.URL + "/")
+	rdev, err := upnp.NewRemoteDevice(context.Background(), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := rdev.Service("AVTransport")
+
+	cases := []struct {
+		didl  string
+		typ   omnicast.MediaType
+		title string
+		image string
+	}{
+		{
+			`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">
+  <item id="1" parentID="-1" restricted="1">
+    <dc:title>WALL-E</dc:title>
+    <upnp:class>object.item.videoItem.movie</upnp:class>
+  </item>
+</DIDL-Lite>`,
+			omnicast.Movie, "WALL-E", "",
+		},
+		{
+			`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">
+  <item id="2" parentID="-1" restricted="1">
+    <dc:title>Define Dancing</dc:title>
+    <upnp:class>object.item.audioItem.musicTrack</upnp:class>
+    <upnp:artist>Thomas Newman</upnp:artist>
+    <upnp:albumArtURI>http://example.com/wall-e.jpg</upnp:albumArtURI>
+  </item>
+</DIDL-Lite>`,
+			omnicast.MusicTrack, "Define Dancing", "http://example.com/wall-e.jpg",
+		},
+		{`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/"><item/></DIDL-Lite>`, omnicast.GenericMedia, "", ""},
+	}
+
+	for i, c := range cases {
+		_, err := transport.Call(context.Background(), "SetAVTransportURI", map[string]interface{}{
+			"InstanceID":         0,
+			"CurrentURI":         "http://example.com/media",
+			"CurrentURIMetaData": c.didl,
+		})
+		if err != nil {
+			t.Errorf("%d: %s", i, err)
+			continue
+		}
+
+		data, err := json.Marshal(gcast.NewMediaMetadata(omnicast.DetailsOf(player.MediaMetadata())))
+		if err != nil {
+			t.Errorf("%d: %s", i, err)
+			continue
+		}
+
+		cm := new(gcast.MediaMetadata)
+		if err := json.Unmarshal(data, cm); err != nil {
+			t.Errorf("%d: %s", i, err)
+			continue
+		}
+		if d := cm.MediaDetails(); d.Type != c.typ || d.Title != c.title {
+			t.Errorf("%d: Cast: got %s '%s'; want %s '%s'", i, d.Type, d.Title, c.typ, c.title)
+		}
+
+		mm := mpris.NewMediaMetadata(cm.MediaDetails())
+		if mm.Title() != c.title {
+			t.Errorf("%d: MPRIS title: got '%s'; want '%s'", i, mm.Title(), c.title)
+		}
+
+		var image string
+		if u := mm.ImageURL(); u != nil {
+			image = u.String()
+		}
+		if image != c.image {
+			t.Errorf("%d: MPRIS image: got '%s'; want '%s'", i, image, c.image)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+// Package metrics provides counters, gauges and histograms, which are
+// exposed in the Prometheus text format by Handler.
+//
+// Metrics are registered when created, usually as package variables, and
+// are partitioned by the values of their labels, given in the order the
+// label names are declared. Methods panic if the number of label values
+// does not match, as it is a programming error.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets in seconds, which are
+// suited for the latencies of network requests.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is a registered metric.
+type collector interface {
+	desc() *desc
+	collect(w io.Writer)
+}
+
+var registry = struct {
+	sync.Mutex
+	collectors map[string]collector
+}{collectors: make(map[string]collector)}
+
+// register registers the metric. It panics if the name is taken.
+func register(c collector) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	name := c.desc().name
+	if _, ok := registry.collectors[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	registry.collectors[name] = c
+}
+
+// Handler returns the handler serving all registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		bw := bufio.NewWriter(w)
+		WriteTo(bw)
+		bw.Flush()
+	})
+}
+
+// WriteTo writes all registered metrics, ordered by names, to w.
+func WriteTo(w io.Writer) {
+	registry.Lock()
+	names := make([]string, 0, len(registry.collectors))
+	for name := range registry.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]collector, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		collectors[i] = registry.collectors[name]
+	}
+	registry.Unlock()
+
+	for _, c := range collectors {
+		d := c.desc()
+		fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+		fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.typ)
+		c.collect(w)
+	}
+}
+
+// desc describes a metric.
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+// key returns the key of the label values, and panics if their number
+// does not match.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+
+	return strings.Join(values, "\xff")
+}
+
+// writeSample writes the sample of the metric with the suffix, with the
+// label values and an extra label if not empty.
+func (d *desc) writeSample(w io.Writer, suffix string, values []string, extra, extraValue string, v float64) {
+	io.WriteString(w, d.name+suffix)
+
+	if len(values) > 0 || extra != "" {
+		escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+		pairs := make([]string, 0, len(values)+1)
+		for i, value := range values {
+			pairs = append(pairs, d.labels[i]+`="`+escape.Replace(value)+`"`)
+		}
+		if extra != "" {
+			pairs = append(pairs, extra+`="`+extraValue+`"`)
+		}
+
+		io.WriteString(w, "{"+strings.Join(pairs, ",")+"}")
+	}
+
+	io.WriteString(w, " "+formatFloat(v)+"\n")
+}
+
+// formatFloat formats the sample value as Prometheus does.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// sample is the value of a metric with the label values.
+type sample struct {
+	values []string
+	value  float64
+}
+
+// samples is a set of samples keyed by their label values.
+type samples struct {
+	d *desc
+
+	mu sync.Mutex
+	m  map[string]*sample
+}
+
+// add adds v to the sample of the label values, or sets it if set is true.
+func (s *samples) add(v float64, set bool, values []string) {
+	key := s.d.key(values)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	smp, ok := s.m[key]
+	if !ok {
+		smp = &sample{values: append([]string(nil), values...)}
+		s.m[key] = smp
+	}
+
+	if set {
+		smp.value = v
+	} else {
+		smp.value += v
+	}
+}
+
+func (s *samples) desc() *desc {
+	return s.d
+}
+
+func (s *samples) collect(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.m))
+	for key := range s.m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s.d.writeSample(w, "", s.m[key].values, "", "", s.m[key].value)
+	}
+}
+
+// Counter is a metric whose values only go up.
+type Counter struct {
+	samples
+}
+
+// NewCounter registers and returns a new counter.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{samples{d: &desc{name, help, "counter", labels}, m: make(map[string]*sample)}}
+	register(c)
+
+	return c
+}
+
+// Inc increments the counter of the label values by 1.
+func (c *Counter) Inc(values ...string) {
+	c.add(1, false, values)
+}
+
+// Add adds v, which must not be negative, to the counter of the label
+// values.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("metrics: counter " + c.d.name + " cannot decrease")
+	}
+
+	c.add(v, false, values)
+}
+
+// Gauge is a metric whose values can go up and down.
+type Gauge struct {
+	samples
+}
+
+// NewGauge registers and returns a new gauge.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{samples{d: &desc{name, help, "gauge", labels}, m: make(map[string]*sample)}}
+	register(g)
+
+	return g
+}
+
+// Set sets the gauge of the label values to v.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.add(v, true, values)
+}
+
+// Add adds v to the gauge of the label values.
+func (g *Gauge) Add(v float64, values ...string) {
+	g.add(v, false, values)
+}
+
+// Inc increments the gauge of the label values by 1.
+func (g *Gauge) Inc(values ...string) {
+	g.add(1, false, values)
+}
+
+// Dec decrements the gauge of the label values by 1.
+func (g *Gauge) Dec(values ...string) {
+	g.add(-1, false, values)
+}
+
+// GaugeFunc is a gauge whose values are reported by a function when the
+// metrics are collected, e.g. the states of things kept elsewhere.
+type GaugeFunc struct {
+	d  *desc
+	fn func(emit func(v float64, values ...string))
+}
+
+// NewGaugeFunc registers and returns a new gauge, whose values are those
+// passed to emit by fn.
+func NewGaugeFunc(name, help string, fn func(emit func(v float64, values ...string)), labels ...string) *GaugeFunc {
+	g := &GaugeFunc{&desc{name, help, "gauge", labels}, fn}
+	register(g)
+
+	return g
+}
+
+func (g *GaugeFunc) desc() *desc {
+	return g.d
+}
+
+func (g *GaugeFunc) collect(w io.Writer) {
+	g.fn(func(v float64, values ...string) {
+		g.d.key(values)
+		g.d.writeSample(w, "", values, "", "", v)
+	})
+}
+
+// Histogram is a metric counting observations in buckets, e.g. of the
+// latencies of requests.
+type Histogram struct {
+	d       *desc
+	buckets []float64
+
+	mu sync.Mutex
+	m  map[string]*histogramSample
+}
+
+// histogramSample is the value of a histogram with the label values.
+type histogramSample struct {
+	values []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers and returns a new histogram with the upper
+// bounds of the buckets in increasing order, e.g. DefBuckets.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: buckets of " + name + " are not sorted")
+	}
+
+	h := &Histogram{
+		d:       &desc{name, help, "histogram", labels},
+		buckets: buckets,
+		m:       make(map[string]*histogramSample),
+	}
+	register(h)
+
+	return h
+}
+
+// Observe adds the observation v to the histogram of the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := h.d.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	smp, ok := h.m[key]
+	if !ok {
+		smp = &histogramSample{
+			values: append([]string(nil), values...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.m[key] = smp
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			smp.counts[i]++
+		}
+	}
+	smp.count++
+	smp.sum += v
+}
+
+func (h *Histogram) desc() *desc {
+	return h.d
+}
+
+func (h *Histogram) collect(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.m))
+	for key := range h.m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		smp := h.m[key]
+		for i, upper := range h.buckets {
+			h.d.writeSample(w, "_bucket", smp.values, "le", formatFloat(upper), float64(smp.counts[i]))
+		}
+		h.d.writeSample(w, "_bucket", smp.values, "le", "+Inf", float64(smp.count))
+		h.d.writeSample(w, "_sum", smp.values, "", "", smp.sum)
+		h.d.writeSample(w, "_count", smp.values, "", "", float64(smp.count))
+	}
+}
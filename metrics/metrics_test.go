@@ -0,0 +1,82 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ericyan/omnicast/metrics"
+)
+
+func TestHandler(t *testing.T) {
+	requests := metrics.NewCounter("test_requests_total", "Requests by method\nand code.", "method", "code")
+	requests.Inc("GET", "200")
+	requests.Inc("GET", "200")
+	requests.Add(0.5, "POST", `5"0\0`)
+
+	queue := metrics.NewGauge("test_queue_length", "Queue length.")
+	queue.Set(3)
+	queue.Dec()
+
+	metrics.NewGaugeFunc("test_temperature", "Temperatures.", func(emit func(float64, ...string)) {
+		emit(21.5, "kitchen")
+	}, "room")
+
+	latency := metrics.NewHistogram("test_latency_seconds", "Latencies.", []float64{0.1, 1}, "op")
+	latency.Observe(0.05, "read")
+	latency.Observe(0.5, "read")
+	latency.Observe(2, "read")
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type: %s", ct)
+	}
+
+	want := `# HELP test_latency_seconds Latencies.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{op="read",le="0.1"} 1
+test_latency_seconds_bucket{op="read",le="1"} 2
+test_latency_seconds_bucket{op="read",le="+Inf"} 3
+test_latency_seconds_sum{op="read"} 2.55
+test_latency_seconds_count{op="read"} 3
+# HELP test_queue_length Queue length.
+# TYPE test_queue_length gauge
+test_queue_length 2
+# HELP test_requests_total Requests by method\nand code.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",code="200"} 2
+test_requests_total{method="POST",code="5\"0\\0"} 0.5
+# HELP test_temperature Temperatures.
+# TYPE test_temperature gauge
+test_temperature{room="kitchen"} 21.5
+`
+	if got := string(body); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLabelMismatch(t *testing.T) {
+	c := metrics.NewCounter("test_mismatch_total", "Mismatches.", "a")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expect panic for missing label values")
+		}
+	}()
+	c.Inc()
+}
+
+func TestDuplicate(t *testing.T) {
+	metrics.NewGauge("test_duplicate", "Duplicate.")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expect panic for duplicate metric")
+		}
+	}()
+	metrics.NewCounter("test_duplicate", "Duplicate.")
+}
@@ -2,9 +2,12 @@ package mpris
 
 import (
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/godbus/dbus/v5"
+
+	"github.com/ericyan/omnicast"
 )
 
 // MediaMetadata is a mapping from metadata attribute names to values.
@@ -12,68 +15,192 @@ import (
 // https://www.freedesktop.org/wiki/Specifications/mpris-spec/metadata/
 type MediaMetadata map[string]dbus.Variant
 
-// TrackID returns the track ID as a D-Bus object path.
+// NoTrack is the track ID indicating that there is no track.
+const NoTrack = dbus.ObjectPath("/org/mpris/MediaPlayer2/TrackList/NoTrack")
+
+// TrackID returns the track ID as a D-Bus object path. NoTrack will be
+// returned if the player does not provide a valid track ID.
 func (m MediaMetadata) TrackID() dbus.ObjectPath {
-	return m["mpris:trackid"].Value().(dbus.ObjectPath)
+	var id dbus.ObjectPath
+	switch v := m.value("mpris:trackid").(type) {
+	case dbus.ObjectPath:
+		id = v
+	case string:
+		// Some players send the track ID as a string.
+		id = dbus.ObjectPath(v)
+	}
+
+	if !id.IsValid() {
+		return NoTrack
+	}
+
+	return id
 }
 
 // Title returns the descriptive title of the content.
 func (m MediaMetadata) Title() string {
-	v, ok := m["xesam:title"]
-	if !ok {
-		return ""
-	}
-
-	return v.Value().(string)
+	return m.string("xesam:title")
 }
 
 // Subtitle returns the descriptive subtitle of the content. Usually,
 // the name of the album.
 func (m MediaMetadata) Subtitle() string {
-	v, ok := m["xesam:album"]
-	if !ok {
-		return ""
-	}
-
-	return v.Value().(string)
+	return m.string("xesam:album")
 }
 
 // MediaDuration returns the duration of the media.
 func (m MediaMetadata) MediaDuration() time.Duration {
-	v, ok := m["mpris:length"]
-	if !ok {
-		return time.Duration(0)
-	}
-
-	return time.Duration(v.Value().(int64)) * time.Microsecond
+	return time.Duration(m.int("mpris:length")) * time.Microsecond
 }
 
 // MediaURL returns the URL of the media content.
 func (m MediaMetadata) MediaURL() *url.URL {
-	v, ok := m["xesam:url"]
-	if !ok {
-		return nil
+	return m.url("xesam:url")
+}
+
+// ImageURL returns the URL of the image.
+func (m MediaMetadata) ImageURL() *url.URL {
+	return m.url("mpris:artUrl")
+}
+
+// NewMediaMetadata returns the MPRIS metadata for the given details.
+func NewMediaMetadata(d *omnicast.MediaDetails) MediaMetadata {
+	m := make(MediaMetadata)
+	if d == nil {
+		return m
 	}
 
-	u, err := url.Parse(v.Value().(string))
-	if err != nil {
-		return nil
+	setString := func(key, s string) {
+		if s != "" {
+			m[key] = dbus.MakeVariant(s)
+		}
+	}
+	setStrings := func(key, s string) {
+		if s != "" {
+			m[key] = dbus.MakeVariant([]string{s})
+		}
+	}
+	setInt := func(key string, i int) {
+		if i != 0 {
+			m[key] = dbus.MakeVariant(int32(i))
+		}
 	}
 
-	return u
+	setString("xesam:title", d.Title)
+	if len(d.Images) > 0 {
+		setString("mpris:artUrl", d.Images[0].String())
+	}
+
+	switch d.Type {
+	case omnicast.MusicTrack:
+		setString("xesam:album", d.AlbumName)
+		setStrings("xesam:albumArtist", d.AlbumArtist)
+		setStrings("xesam:artist", d.Artist)
+		setStrings("xesam:composer", d.Composer)
+		setInt("xesam:trackNumber", d.TrackNumber)
+		setInt("xesam:discNumber", d.DiscNumber)
+		setString("xesam:contentCreated", d.ReleaseDate)
+	case omnicast.TVShow:
+		setString("xesam:album", d.SeriesTitle)
+		setString("xesam:contentCreated", d.OriginalAirdate)
+	case omnicast.Photo:
+		setStrings("xesam:artist", d.Artist)
+		setString("xesam:contentCreated", d.CreationDateTime)
+	default:
+		// Subtitle is mapped to the album for generic media, as the
+		// reverse of what Subtitle does.
+		setString("xesam:album", d.Subtitle)
+		setString("xesam:contentCreated", d.ReleaseDate)
+	}
+
+	return m
 }
 
-// ImageURL returns the URL of the image.
-func (m MediaMetadata) ImageURL() *url.URL {
-	v, ok := m["mpris:artUrl"]
+// MediaDetails implements the omnicast.MediaDetailer interface. As MPRIS
+// does not distinguish media types, metadata with any music-specific
+// attributes will be considered as music track.
+func (m MediaMetadata) MediaDetails() *omnicast.MediaDetails {
+	d := &omnicast.MediaDetails{
+		Type:  omnicast.GenericMedia,
+		Title: m.string("xesam:title"),
+	}
+
+	if u := m.ImageURL(); u != nil {
+		d.Images = []*url.URL{u}
+	}
+
+	artist := m.strings("xesam:artist")
+	album := m.string("xesam:album")
+	if artist != "" || m.strings("xesam:albumArtist") != "" || m.int("xesam:trackNumber") != 0 {
+		d.Type = omnicast.MusicTrack
+		d.Artist = artist
+		d.AlbumName = album
+		d.AlbumArtist = m.strings("xesam:albumArtist")
+		d.Composer = m.strings("xesam:composer")
+		d.TrackNumber = int(m.int("xesam:trackNumber"))
+		d.DiscNumber = int(m.int("xesam:discNumber"))
+	} else {
+		d.Subtitle = album
+	}
+	d.ReleaseDate = m.string("xesam:contentCreated")
+
+	return d
+}
+
+// value returns the value of the attribute, or nil if not found.
+func (m MediaMetadata) value(key string) interface{} {
+	v, ok := m[key]
 	if !ok {
 		return nil
 	}
 
-	u, err := url.Parse(v.Value().(string))
+	return v.Value()
+}
+
+func (m MediaMetadata) string(key string) string {
+	s, _ := m.value(key).(string)
+	return s
+}
+
+// strings returns the list of strings joined with ", ".
+func (m MediaMetadata) strings(key string) string {
+	switch v := m.value(key).(type) {
+	case []string:
+		return strings.Join(v, ", ")
+	case string:
+		return v
+	default:
+		return ""
+	}
+}
+
+func (m MediaMetadata) url(key string) *url.URL {
+	s := m.string(key)
+	if s == "" {
+		return nil
+	}
+
+	u, err := url.Parse(s)
 	if err != nil {
 		return nil
 	}
 
 	return u
 }
+
+func (m MediaMetadata) int(key string) int64 {
+	switch v := m.value(key).(type) {
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float64:
+		return int64(v)
+	default:
+		return 0
+	}
+}
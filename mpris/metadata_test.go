@@ -0,0 +1,66 @@
+package mpris
+
+import (
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestMediaMetadata(t *testing.T) {
+	cases := []struct {
+		m        MediaMetadata
+		trackID  dbus.ObjectPath
+		title    string
+		duration time.Duration
+		imageURL string
+	}{
+		{nil, NoTrack, "", 0, ""},
+		{MediaMetadata{}, NoTrack, "", 0, ""},
+		{
+			MediaMetadata{
+				"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath("/org/mpris/MediaPlayer2/Track/1")),
+				"xesam:title":   dbus.MakeVariant("WALL-E"),
+				"mpris:length":  dbus.MakeVariant(int64(98 * time.Minute / time.Microsecond)),
+				"mpris:artUrl":  dbus.MakeVariant("http://example.com/wall-e.jpg"),
+			},
+			"/org/mpris/MediaPlayer2/Track/1", "WALL-E", 98 * time.Minute, "http://example.com/wall-e.jpg",
+		},
+		{
+			MediaMetadata{
+				"mpris:trackid": dbus.MakeVariant("/org/mpris/MediaPlayer2/Track/2"),
+				"mpris:length":  dbus.MakeVariant(uint64(1000000)),
+			},
+			"/org/mpris/MediaPlayer2/Track/2", "", time.Second, "",
+		},
+		{
+			MediaMetadata{
+				"mpris:trackid": dbus.MakeVariant("not a path"),
+				"xesam:title":   dbus.MakeVariant([]string{"WALL-E"}),
+				"mpris:length":  dbus.MakeVariant("98 minutes"),
+				"mpris:artUrl":  dbus.MakeVariant(42),
+			},
+			NoTrack, "", 0, "",
+		},
+	}
+
+	for i, c := range cases {
+		if got := c.m.TrackID(); got != c.trackID {
+			t.Errorf("%d: TrackID(): got %s; want %s", i, got, c.trackID)
+		}
+		if got := c.m.Title(); got != c.title {
+			t.Errorf("%d: Title(): got '%s'; want '%s'", i, got, c.title)
+		}
+		if got := c.m.MediaDuration(); got != c.duration {
+			t.Errorf("%d: MediaDuration(): got %s; want %s", i, got, c.duration)
+		}
+
+		var got string
+		if u := c.m.ImageURL(); u != nil {
+			got = u.String()
+		}
+		if got != c.imageURL {
+			t.Errorf("%d: ImageURL(): got '%s'; want '%s'", i, got, c.imageURL)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package mpris
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/godbus/dbus/v5"
@@ -47,7 +49,13 @@ func Discover() ([]string, error) {
 
 // Player represents a MPRIS player.
 type Player struct {
-	bo dbus.BusObject
+	conn *dbus.Conn
+	bo   dbus.BusObject
+
+	// MPRIS has no notion of muting. The volume level before muting is
+	// saved here so that it can be restored when unmuting.
+	mu          sync.Mutex
+	unmuteLevel float64
 }
 
 // NewPlayer returns a new player.
@@ -59,7 +67,7 @@ func NewPlayer(dest string) (*Player, error) {
 
 	bo := conn.Object(dest, DBusInterface)
 
-	return &Player{bo}, nil
+	return &Player{conn: conn, bo: bo}, nil
 }
 
 // Name returns the name of the player instace.
@@ -75,14 +83,23 @@ func (p *Player) Name() string {
 }
 
 // call invokes a MPRIS method.
-func (p *Player) call(method string, args ...interface{}) ([]interface{}, error) {
-	call := p.bo.Call(DBusPath+"."+method, 0, args...)
+func (p *Player) call(ctx context.Context, method string, args ...interface{}) ([]interface{}, error) {
+	call := p.bo.CallWithContext(ctx, DBusPath+"."+method, 0, args...)
 	return call.Body, call.Err
 }
 
+// setProperty sets a MPRIS property, e.g. "Player.Volume".
+func (p *Player) setProperty(ctx context.Context, prop string, v interface{}) error {
+	i := strings.LastIndex(prop, ".")
+	iface, name := DBusPath+"."+prop[:i], prop[i+1:]
+
+	call := p.bo.CallWithContext(ctx, "org.freedesktop.DBus.Properties.Set", 0, iface, name, dbus.MakeVariant(v))
+	return call.Err
+}
+
 // Load opens media and starts playback.
-func (p *Player) Load(media *url.URL, metadata omnicast.MediaMetadata) error {
-	_, err := p.call("Player.OpenUri", media.String())
+func (p *Player) Load(ctx context.Context, media *url.URL, metadata omnicast.MediaMetadata) error {
+	_, err := p.call(ctx, "Player.OpenUri", media.String())
 	return err
 }
 
@@ -93,7 +110,7 @@ func (p *Player) metadata() MediaMetadata {
 		return nil
 	}
 
-	m := v.Value().(map[string]dbus.Variant)
+	m, _ := v.Value().(map[string]dbus.Variant)
 	return MediaMetadata(m)
 }
 
@@ -113,25 +130,44 @@ func (p *Player) MediaDuration() time.Duration {
 }
 
 // Play starts or resumes playback.
-func (p *Player) Play() {
-	p.call("Player.Play")
+func (p *Player) Play(ctx context.Context) error {
+	_, err := p.call(ctx, "Player.Play")
+	return err
 }
 
 // Pause pauses playback of the current content.
-func (p *Player) Pause() {
-	p.call("Player.Pause")
+func (p *Player) Pause(ctx context.Context) error {
+	if !p.boolProperty("Player.CanPause") {
+		return omnicast.ErrNotSupported
+	}
+
+	_, err := p.call(ctx, "Player.Pause")
+	return err
 }
 
 // Stop stops the playback and resets the playback position.
-func (p *Player) Stop() {
-	p.call("Player.Stop")
+func (p *Player) Stop(ctx context.Context) error {
+	_, err := p.call(ctx, "Player.Stop")
+	return err
 }
 
 // SeekTo sets the current playback position to pos.
-func (p *Player) SeekTo(pos time.Duration) {
+func (p *Player) SeekTo(ctx context.Context, pos time.Duration) error {
+	if !p.boolProperty("Player.CanSeek") {
+		return omnicast.ErrNotSupported
+	}
+
+	// SetPosition is ignored for tracks without a valid ID, in which case
+	// fall back to seeking relative to the current position.
 	trackID := p.metadata().TrackID()
+	if trackID == NoTrack {
+		offset := pos - p.PlaybackPosition()
+		_, err := p.call(ctx, "Player.Seek", offset.Microseconds())
+		return err
+	}
 
-	p.call("Player.SetPosition", trackID, pos.Microseconds())
+	_, err := p.call(ctx, "Player.SetPosition", trackID, pos.Microseconds())
+	return err
 }
 
 // PlaybackStatus return the current playback status.
@@ -141,7 +177,12 @@ func (p *Player) PlaybackStatus() string {
 		return "UNKNOWN"
 	}
 
-	return v.Value().(string)
+	status, ok := v.Value().(string)
+	if !ok {
+		return "UNKNOWN"
+	}
+
+	return status
 }
 
 // IsIdle returns true if the media playback stopped.
@@ -173,7 +214,7 @@ func (p *Player) PlaybackPosition() time.Duration {
 		return time.Duration(0)
 	}
 
-	pos := v.Value().(int64)
+	pos, _ := v.Value().(int64)
 	return time.Duration(pos) * time.Microsecond
 }
 
@@ -184,7 +225,8 @@ func (p *Player) PlaybackRate() float32 {
 		return 0
 	}
 
-	return float32(v.Value().(float64))
+	rate, _ := v.Value().(float64)
+	return float32(rate)
 }
 
 // VolumeLevel returns receiver volume as a number between 0.0 and 1.0.
@@ -194,7 +236,8 @@ func (p *Player) VolumeLevel() float64 {
 		return 0
 	}
 
-	return v.Value().(float64)
+	level, _ := v.Value().(float64)
+	return level
 }
 
 // IsMuted returns true if the receiver is muted.
@@ -204,17 +247,227 @@ func (p *Player) IsMuted() bool {
 }
 
 // SetVolumeLevel sets receiver volume level.
-func (p *Player) SetVolumeLevel(level float64) {
-	p.bo.SetProperty(DBusPath+".Player.Volume", level)
+func (p *Player) SetVolumeLevel(ctx context.Context, level float64) error {
+	return p.setProperty(ctx, "Player.Volume", level)
+}
+
+// Mute mutes the receiver by setting the volume level to 0.
+func (p *Player) Mute(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if level := p.VolumeLevel(); level > 0 {
+		p.unmuteLevel = level
+	}
+
+	return p.SetVolumeLevel(ctx, 0)
 }
 
-// Mute mutes the receiver.
-func (p *Player) Mute() {
-	p.SetVolumeLevel(0)
+// Unmute unmutes the receiver by restoring the volume level before it
+// was muted.
+func (p *Player) Unmute(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.VolumeLevel() > 0 {
+		return nil
+	}
+
+	// Set volume level to maximum if previous volume level is unknown.
+	level := p.unmuteLevel
+	if level == 0 {
+		level = 1
+	}
+
+	return p.SetVolumeLevel(ctx, level)
 }
 
-// Unmute unmutes the receiver.
-func (p *Player) Unmute() {
-	// Set volume level to maximum as previous volume level is unknown.
-	p.SetVolumeLevel(1)
+// boolProperty returns the value of a boolean MPRIS property, or false
+// if it cannot be retrieved.
+func (p *Player) boolProperty(prop string) bool {
+	v, err := p.bo.GetProperty(DBusPath + "." + prop)
+	if err != nil {
+		return false
+	}
+
+	b, _ := v.Value().(bool)
+	return b
+}
+
+// Capabilities implements the omnicast.CapabilityReporter interface.
+//
+// Muting is emulated by setting the volume level to 0, thus CanMute is
+// never reported.
+func (p *Player) Capabilities() omnicast.Capability {
+	var c omnicast.Capability
+
+	// The player cannot be controlled at all if CanControl is false.
+	if !p.boolProperty("Player.CanControl") {
+		return c
+	}
+
+	if p.boolProperty("Player.CanPause") {
+		c |= omnicast.CanPause
+	}
+	if p.boolProperty("Player.CanSeek") {
+		c |= omnicast.CanSeek
+	}
+	if p.boolProperty("Player.CanGoNext") {
+		c |= omnicast.CanGoNext
+	}
+	if p.boolProperty("Player.CanGoPrevious") {
+		c |= omnicast.CanGoPrevious
+	}
+	if p.boolProperty("HasTrackList") {
+		c |= omnicast.CanQueue
+	}
+
+	min, errMin := p.bo.GetProperty(DBusPath + ".Player.MinimumRate")
+	max, errMax := p.bo.GetProperty(DBusPath + ".Player.MaximumRate")
+	if errMin == nil && errMax == nil && min.Value() != max.Value() {
+		c |= omnicast.CanSetRate
+	}
+
+	// Volume is optional for players to implement.
+	if _, err := p.bo.GetProperty(DBusPath + ".Player.Volume"); err == nil {
+		c |= omnicast.CanSetVolume
+	}
+
+	return c
+}
+
+// Subscribe implements the omnicast.EventSource interface. Events are
+// derived from the PropertiesChanged and Seeked signals emitted by the
+// player.
+func (p *Player) Subscribe(ctx context.Context) (<-chan *omnicast.Event, error) {
+	// Signals carry the unique connection name of the sender instead of
+	// the well-known name we know the player by.
+	var owner string
+	err := p.conn.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, p.bo.Destination()).Store(&owner)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := [][]dbus.MatchOption{
+		{
+			dbus.WithMatchSender(p.bo.Destination()),
+			dbus.WithMatchObjectPath(p.bo.Path()),
+			dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+			dbus.WithMatchMember("PropertiesChanged"),
+		},
+		{
+			dbus.WithMatchSender(p.bo.Destination()),
+			dbus.WithMatchObjectPath(p.bo.Path()),
+			dbus.WithMatchInterface(DBusPath + ".Player"),
+			dbus.WithMatchMember("Seeked"),
+		},
+	}
+	for _, rule := range rules {
+		if err := p.conn.AddMatchSignal(rule...); err != nil {
+			return nil, err
+		}
+	}
+
+	sigCh := make(chan *dbus.Signal, 16)
+	p.conn.Signal(sigCh)
+
+	evCh := make(chan *omnicast.Event, 16)
+	go func() {
+		defer func() {
+			p.conn.RemoveSignal(sigCh)
+			for _, rule := range rules {
+				p.conn.RemoveMatchSignal(rule...)
+			}
+			close(evCh)
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig, ok := <-sigCh:
+				if !ok {
+					return
+				}
+				if sig.Sender != owner || sig.Path != p.bo.Path() {
+					continue
+				}
+
+				for _, e := range p.events(sig) {
+					e.Time = time.Now()
+					select {
+					case evCh <- e:
+					default:
+					}
+				}
+			}
+		}
+	}()
+
+	return evCh, nil
+}
+
+// events converts a D-Bus signal to events.
+func (p *Player) events(sig *dbus.Signal) []*omnicast.Event {
+	switch sig.Name {
+	case DBusPath + ".Player.Seeked":
+		if len(sig.Body) < 1 {
+			return nil
+		}
+
+		pos, ok := sig.Body[0].(int64)
+		if !ok {
+			return nil
+		}
+
+		return []*omnicast.Event{{
+			Type:     omnicast.PositionJumped,
+			State:    omnicast.StateOf(p),
+			Position: time.Duration(pos) * time.Microsecond,
+		}}
+	case "org.freedesktop.DBus.Properties.PropertiesChanged":
+		if len(sig.Body) < 2 || sig.Body[0] != DBusPath+".Player" {
+			return nil
+		}
+
+		changed, ok := sig.Body[1].(map[string]dbus.Variant)
+		if !ok {
+			return nil
+		}
+
+		var events []*omnicast.Event
+		if _, ok := changed["PlaybackStatus"]; ok {
+			events = append(events, &omnicast.Event{
+				Type:     omnicast.StateChanged,
+				State:    omnicast.StateOf(p),
+				Position: p.PlaybackPosition(),
+			})
+		}
+
+		if v, ok := changed["Metadata"]; ok {
+			if m, ok := v.Value().(map[string]dbus.Variant); ok {
+				md := MediaMetadata(m)
+				events = append(events, &omnicast.Event{
+					Type:          omnicast.MediaChanged,
+					MediaURL:      md.MediaURL(),
+					MediaMetadata: md,
+					MediaDuration: md.MediaDuration(),
+				})
+			}
+		}
+
+		if v, ok := changed["Volume"]; ok {
+			if level, ok := v.Value().(float64); ok {
+				events = append(events, &omnicast.Event{
+					Type:        omnicast.VolumeChanged,
+					VolumeLevel: level,
+					Muted:       level == 0,
+				})
+			}
+		}
+
+		return events
+	default:
+		return nil
+	}
 }
@@ -0,0 +1,262 @@
+package mqtt_test
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+
+	"github.com/ericyan/omnicast/mqtt"
+	"github.com/ericyan/omnicast/omnicasttest"
+	"github.com/ericyan/omnicast/web"
+)
+
+// broker is a local stand-in of an MQTT broker serving a single client.
+// It keeps the retained messages, and sends publications to the client
+// regardless of its subscriptions.
+type broker struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	conn     net.Conn
+	clientID string
+	username string
+	password string
+	retained map[string]string
+}
+
+func newBroker(t *testing.T) *broker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &broker{ln: ln, retained: make(map[string]string)}
+	go b.serve()
+
+	return b
+}
+
+func (b *broker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		b.mu.Lock()
+		b.conn = conn
+		b.mu.Unlock()
+
+		go b.handle(conn)
+	}
+}
+
+func (b *broker) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		p, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		var resp packets.ControlPacket
+		switch p := p.(type) {
+		case *packets.ConnectPacket:
+			b.mu.Lock()
+			b.clientID = p.ClientIdentifier
+			b.username, b.password = p.Username, string(p.Password)
+			if p.WillFlag {
+				b.retained[p.WillTopic] = "(will) " + string(p.WillMessage)
+			}
+			b.mu.Unlock()
+
+			resp = packets.NewControlPacket(packets.Connack)
+		case *packets.SubscribePacket:
+			suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			suback.MessageID = p.MessageID
+			suback.ReturnCodes = p.Qoss
+			resp = suback
+		case *packets.PublishPacket:
+			if p.Retain {
+				b.mu.Lock()
+				b.retained[p.TopicName] = string(p.Payload)
+				b.mu.Unlock()
+			}
+			if p.Qos == 1 {
+				puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				puback.MessageID = p.MessageID
+				resp = puback
+			}
+		case *packets.PingreqPacket:
+			resp = packets.NewControlPacket(packets.Pingresp)
+		case *packets.DisconnectPacket:
+			return
+		}
+
+		if resp != nil {
+			b.mu.Lock()
+			err := resp.Write(conn)
+			b.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// publish sends the message to the client.
+func (b *broker) publish(t *testing.T, topic, payload string) {
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName = topic
+	p.Payload = []byte(payload)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := p.Write(b.conn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// get returns the retained message of the topic.
+func (b *broker) get(topic string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.retained[topic]
+}
+
+// waitFor waits for the retained message of the topic to be the payload.
+func (b *broker) waitFor(t *testing.T, topic, payload string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for b.get(topic) != payload {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: got %q, want %q", topic, b.get(topic), payload)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	mqtt.PollInterval = 50 * time.Millisecond
+
+	broker := newBroker(t)
+	defer broker.ln.Close()
+
+	player := omnicasttest.NewPlayer("Den")
+	player.SetMediaDuration(time.Minute)
+	players := new(web.Players)
+	players.Add("d1", player)
+
+	b := mqtt.NewBridge("tcp://user:secret@"+broker.ln.Addr().String(), players)
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	broker.waitFor(t, "omnicast/availability", "online")
+	broker.waitFor(t, "omnicast/d1/state", "idle")
+	broker.waitFor(t, "omnicast/d1/volume", "1")
+	if !strings.HasPrefix(broker.clientID, "omnicast") {
+		t.Errorf("Unexpected client ID: %q", broker.clientID)
+	}
+	if broker.username != "user" || broker.password != "secret" {
+		t.Errorf("Unexpected credentials: %q %q", broker.username, broker.password)
+	}
+
+	var cfg struct {
+		UniqueID          string   `json:"unique_id"`
+		StateTopic        string   `json:"state_topic"`
+		CommandTopic      string   `json:"command_topic"`
+		AvailabilityTopic string   `json:"availability_topic"`
+		Min               *float64 `json:"min"`
+		Device            struct {
+			Identifiers []string `json:"identifiers"`
+			Name        string   `json:"name"`
+		} `json:"device"`
+	}
+	if err := json.Unmarshal([]byte(broker.get("homeassistant/number/omnicast_d1/volume/config")), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.UniqueID != "omnicast_d1_volume" || cfg.StateTopic != "omnicast/d1/volume" ||
+		cfg.CommandTopic != "omnicast/d1/command/volume" || cfg.AvailabilityTopic != "omnicast/availability" ||
+		cfg.Min == nil || *cfg.Min != 0 || cfg.Device.Name != "Den" {
+		t.Errorf("Unexpected discovery payload: %+v", cfg)
+	}
+	for _, topic := range []string{
+		"homeassistant/sensor/omnicast_d1/state/config",
+		"homeassistant/sensor/omnicast_d1/title/config",
+		"homeassistant/sensor/omnicast_d1/position/config",
+		"homeassistant/text/omnicast_d1/load/config",
+		"homeassistant/button/omnicast_d1/play/config",
+		"homeassistant/button/omnicast_d1/pause/config",
+		"homeassistant/button/omnicast_d1/stop/config",
+	} {
+		if broker.get(topic) == "" {
+			t.Errorf("Missing discovery payload %s", topic)
+		}
+	}
+
+	broker.publish(t, "omnicast/d1/command/load", "http://example.com/a.mp3")
+	broker.waitFor(t, "omnicast/d1/state", "playing")
+
+	broker.publish(t, "omnicast/d1/command/volume", "0.3")
+	broker.waitFor(t, "omnicast/d1/volume", "0.3")
+
+	broker.publish(t, "omnicast/d1/command/seek", "12")
+	broker.waitFor(t, "omnicast/d1/position", "12")
+
+	broker.publish(t, "omnicast/d1/command/pause", "PRESS")
+	broker.waitFor(t, "omnicast/d1/state", "paused")
+
+	broker.publish(t, "omnicast/d1/command/load", `{"url": "http://example.com/b.mp3", "title": "B"}`)
+	broker.waitFor(t, "omnicast/d1/title", "B")
+
+	var s web.Status
+	if err := json.Unmarshal([]byte(broker.get("omnicast/d1/status")), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.ID != "d1" || s.MediaURL != "http://example.com/b.mp3" {
+		t.Errorf("Unexpected status: %+v", s)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := broker.get("omnicast/availability"); got != "offline" {
+		t.Errorf("Availability after close: %q", got)
+	}
+}
+
+func TestBridgePrefix(t *testing.T) {
+	mqtt.PollInterval = 50 * time.Millisecond
+
+	broker := newBroker(t)
+	defer broker.ln.Close()
+
+	players := new(web.Players)
+	players.Add("d1", omnicasttest.NewPlayer("Den"))
+
+	b := mqtt.NewBridge("tcp://"+broker.ln.Addr().String(), players)
+	b.ClientID = "den-bridge"
+	b.Prefix = "home/cast"
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	broker.waitFor(t, "home/cast/availability", "online")
+	broker.waitFor(t, "home/cast/d1/state", "idle")
+	if broker.clientID != "den-bridge" {
+		t.Errorf("Unexpected client ID: %q", broker.clientID)
+	}
+	if broker.get("homeassistant/sensor/home_cast_d1/state/config") == "" {
+		t.Error("Missing discovery payload under the prefix")
+	}
+}
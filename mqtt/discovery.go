@@ -0,0 +1,109 @@
+package mqtt
+
+import (
+	"strings"
+
+	"github.com/ericyan/omnicast"
+)
+
+// discoveryConfig is the Home Assistant MQTT discovery payload of an
+// entity, which is published to its topic.
+type discoveryConfig struct {
+	topic string
+
+	Name                string          `json:"name"`
+	UniqueID            string          `json:"unique_id"`
+	Icon                string          `json:"icon,omitempty"`
+	StateTopic          string          `json:"state_topic,omitempty"`
+	JSONAttributesTopic string          `json:"json_attributes_topic,omitempty"`
+	CommandTopic        string          `json:"command_topic,omitempty"`
+	AvailabilityTopic   string          `json:"availability_topic"`
+	UnitOfMeasurement   string          `json:"unit_of_measurement,omitempty"`
+	Min                 *float64        `json:"min,omitempty"`
+	Max                 *float64        `json:"max,omitempty"`
+	Step                float64         `json:"step,omitempty"`
+	Device              discoveryDevice `json:"device"`
+}
+
+// discoveryDevice is the device the entities belong to, i.e. the player.
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// discovery returns the discovery payloads of the entities of the player.
+// Home Assistant has no MQTT media player, so the player is a device with
+// sensors of its state, a volume slider, transport buttons, and a text
+// field to cast a URL.
+func (b *Bridge) discovery(id string, player omnicast.MediaPlayerV2) []*discoveryConfig {
+	// The node is keyed by the prefix rather than the client ID, so that
+	// entities survive changes of the latter, e.g. renaming the host.
+	node := nodeID(b.Prefix + "_" + id)
+	device := discoveryDevice{
+		Identifiers:  []string{node},
+		Name:         player.Name(),
+		Manufacturer: "Omnicast",
+		Model:        "Media player bridge",
+	}
+
+	entity := func(component, object, name string) *discoveryConfig {
+		return &discoveryConfig{
+			topic:             b.DiscoveryPrefix + "/" + component + "/" + node + "/" + object + "/config",
+			Name:              name,
+			UniqueID:          node + "_" + object,
+			AvailabilityTopic: b.topic("availability"),
+			Device:            device,
+		}
+	}
+
+	state := entity("sensor", "state", "State")
+	state.Icon = "mdi:cast"
+	state.StateTopic = b.topic(id, "state")
+	state.JSONAttributesTopic = b.topic(id, "status")
+
+	title := entity("sensor", "title", "Title")
+	title.Icon = "mdi:music"
+	title.StateTopic = b.topic(id, "title")
+
+	position := entity("sensor", "position", "Position")
+	position.Icon = "mdi:timer-outline"
+	position.StateTopic = b.topic(id, "position")
+	position.UnitOfMeasurement = "s"
+
+	min, max := 0.0, 1.0
+	volume := entity("number", "volume", "Volume")
+	volume.Icon = "mdi:volume-high"
+	volume.StateTopic = b.topic(id, "volume")
+	volume.CommandTopic = b.topic(id, "command", "volume")
+	volume.Min, volume.Max, volume.Step = &min, &max, 0.01
+
+	load := entity("text", "load", "Cast URL")
+	load.Icon = "mdi:link"
+	load.CommandTopic = b.topic(id, "command", "load")
+
+	configs := []*discoveryConfig{state, title, position, volume, load}
+	for _, action := range []string{"play", "pause", "stop"} {
+		button := entity("button", action, strings.Title(action))
+		button.Icon = "mdi:" + action
+		button.CommandTopic = b.topic(id, "command", action)
+
+		configs = append(configs, button)
+	}
+
+	return configs
+}
+
+// nodeID returns s with characters not allowed in discovery topics, i.e.
+// other than alphanumerics, underscores and hyphens, replaced.
+func nodeID(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
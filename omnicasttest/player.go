@@ -0,0 +1,307 @@
+// Package omnicasttest provides an in-memory media player for testing
+// the frontends.
+package omnicasttest
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ericyan/omnicast"
+)
+
+// Player is an in-memory omnicast.MediaPlayerV2. The playback position
+// only changes when seeking, so that tests are deterministic. State
+// changes are published to subscribers, like a real player would do.
+type Player struct {
+	name string
+
+	mu           sync.Mutex
+	mediaURL     *url.URL
+	metadata     omnicast.MediaMetadata
+	duration     time.Duration
+	state        omnicast.PlaybackState
+	position     time.Duration
+	level        float64
+	muted        bool
+	capabilities omnicast.Capability
+
+	broadcaster omnicast.EventBroadcaster
+}
+
+// NewPlayer returns a new idle Player with all capabilities.
+func NewPlayer(name string) *Player {
+	return &Player{
+		name:         name,
+		level:        1,
+		capabilities: omnicast.AllCapabilities,
+	}
+}
+
+// Name returns the name of the player.
+func (p *Player) Name() string {
+	return p.name
+}
+
+// Load loads the media and starts playback.
+func (p *Player) Load(ctx context.Context, mediaURL *url.URL, metadata omnicast.MediaMetadata) error {
+	if mediaURL == nil || !mediaURL.IsAbs() {
+		return omnicast.ErrInvalidMedia
+	}
+
+	p.mu.Lock()
+	p.mediaURL = mediaURL
+	p.metadata = metadata
+	p.position = 0
+	p.mu.Unlock()
+
+	p.broadcaster.Publish(&omnicast.Event{
+		Type:          omnicast.MediaChanged,
+		MediaURL:      mediaURL,
+		MediaMetadata: metadata,
+		MediaDuration: p.MediaDuration(),
+	})
+	p.SetState(omnicast.StatePlaying)
+
+	return nil
+}
+
+// MediaURL returns the URL of the loaded media, if any.
+func (p *Player) MediaURL() *url.URL {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.mediaURL
+}
+
+// MediaMetadata returns the metadata of the loaded media, if any.
+func (p *Player) MediaMetadata() omnicast.MediaMetadata {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.metadata
+}
+
+// MediaDuration returns the duration of the loaded media.
+func (p *Player) MediaDuration() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.duration
+}
+
+// SetMediaDuration sets the duration reported for loaded media.
+func (p *Player) SetMediaDuration(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.duration = d
+}
+
+// State returns the playback state.
+func (p *Player) State() omnicast.PlaybackState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.state
+}
+
+// SetState changes the playback state, as if caused by the user or the
+// media itself.
+func (p *Player) SetState(state omnicast.PlaybackState) {
+	p.mu.Lock()
+	changed := p.state != state
+	p.state = state
+	pos := p.position
+	p.mu.Unlock()
+
+	if changed {
+		p.broadcaster.Publish(&omnicast.Event{
+			Type:     omnicast.StateChanged,
+			State:    state,
+			Position: pos,
+		})
+	}
+}
+
+// IsIdle returns true if there is no media playing or paused.
+func (p *Player) IsIdle() bool {
+	return p.State() == omnicast.StateIdle
+}
+
+// IsPlaying returns true if the media is playing.
+func (p *Player) IsPlaying() bool {
+	return p.State() == omnicast.StatePlaying
+}
+
+// IsPaused returns true if the playback is paused.
+func (p *Player) IsPaused() bool {
+	return p.State() == omnicast.StatePaused
+}
+
+// IsBuffering returns true if the player is buffering.
+func (p *Player) IsBuffering() bool {
+	return p.State() == omnicast.StateBuffering
+}
+
+// PlaybackPosition returns the playback position.
+func (p *Player) PlaybackPosition() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.position
+}
+
+// PlaybackRate returns 1 if the media is playing, and 0 otherwise.
+func (p *Player) PlaybackRate() float32 {
+	if p.IsPlaying() {
+		return 1
+	}
+
+	return 0
+}
+
+// hasMedia returns omnicast.ErrNoMedia if no media is loaded.
+func (p *Player) hasMedia() error {
+	if p.MediaURL() == nil {
+		return omnicast.ErrNoMedia
+	}
+
+	return nil
+}
+
+// Play resumes the playback.
+func (p *Player) Play(ctx context.Context) error {
+	if err := p.hasMedia(); err != nil {
+		return err
+	}
+
+	p.SetState(omnicast.StatePlaying)
+	return nil
+}
+
+// Pause pauses the playback.
+func (p *Player) Pause(ctx context.Context) error {
+	if err := p.hasMedia(); err != nil {
+		return err
+	}
+	if !p.Capabilities().Has(omnicast.CanPause) {
+		return omnicast.ErrNotSupported
+	}
+
+	p.SetState(omnicast.StatePaused)
+	return nil
+}
+
+// Stop stops the playback and unloads the media.
+func (p *Player) Stop(ctx context.Context) error {
+	if err := p.hasMedia(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.mediaURL = nil
+	p.metadata = nil
+	p.position = 0
+	p.mu.Unlock()
+
+	p.SetState(omnicast.StateIdle)
+	p.broadcaster.Publish(&omnicast.Event{Type: omnicast.MediaChanged})
+
+	return nil
+}
+
+// SeekTo changes the playback position.
+func (p *Player) SeekTo(ctx context.Context, pos time.Duration) error {
+	if err := p.hasMedia(); err != nil {
+		return err
+	}
+	if !p.Capabilities().Has(omnicast.CanSeek) {
+		return omnicast.ErrNotSupported
+	}
+
+	p.mu.Lock()
+	p.position = pos
+	state := p.state
+	p.mu.Unlock()
+
+	p.broadcaster.Publish(&omnicast.Event{
+		Type:     omnicast.PositionJumped,
+		State:    state,
+		Position: pos,
+	})
+
+	return nil
+}
+
+// VolumeLevel returns the volume level between 0.0 and 1.0.
+func (p *Player) VolumeLevel() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.level
+}
+
+// IsMuted returns true if the player is muted.
+func (p *Player) IsMuted() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.muted
+}
+
+func (p *Player) setVolume(level float64, muted bool) error {
+	if !p.Capabilities().Has(omnicast.CanSetVolume) {
+		return omnicast.ErrNotSupported
+	}
+
+	p.mu.Lock()
+	p.level = level
+	p.muted = muted
+	p.mu.Unlock()
+
+	p.broadcaster.Publish(&omnicast.Event{
+		Type:        omnicast.VolumeChanged,
+		VolumeLevel: level,
+		Muted:       muted,
+	})
+
+	return nil
+}
+
+// SetVolumeLevel sets the volume level.
+func (p *Player) SetVolumeLevel(ctx context.Context, level float64) error {
+	return p.setVolume(level, p.IsMuted())
+}
+
+// Mute mutes the player.
+func (p *Player) Mute(ctx context.Context) error {
+	return p.setVolume(p.VolumeLevel(), true)
+}
+
+// Unmute unmutes the player.
+func (p *Player) Unmute(ctx context.Context) error {
+	return p.setVolume(p.VolumeLevel(), false)
+}
+
+// Capabilities implements the omnicast.CapabilityReporter interface.
+func (p *Player) Capabilities() omnicast.Capability {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.capabilities
+}
+
+// SetCapabilities changes the capabilities of the player.
+func (p *Player) SetCapabilities(c omnicast.Capability) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.capabilities = c
+}
+
+// Subscribe implements the omnicast.EventSource interface.
+func (p *Player) Subscribe(ctx context.Context) (<-chan *omnicast.Event, error) {
+	return p.broadcaster.Subscribe(ctx)
+}
@@ -1,10 +1,19 @@
 package omnicast
 
 import (
+	"context"
+	"errors"
 	"net/url"
 	"time"
 )
 
+// Errors reported by media players.
+var (
+	ErrNoMedia      = errors.New("no media loaded")
+	ErrInvalidMedia = errors.New("invalid media")
+	ErrNotSupported = errors.New("operation not supported")
+)
+
 // MediaPlayer is a generic media player.
 type MediaPlayer interface {
 	Name() string
@@ -65,3 +74,35 @@ type VolumeController interface {
 	Mute()
 	Unmute()
 }
+
+// MediaPlayerV2 is a generic media player whose control methods are
+// context-aware and report failures.
+type MediaPlayerV2 interface {
+	Name() string
+	MediaLoaderV2
+	MediaInfoReporter
+	PlaybackStateReporter
+	PlaybackControllerV2
+	VolumeReporter
+	VolumeControllerV2
+}
+
+// MediaLoaderV2 loads the media for playback.
+type MediaLoaderV2 interface {
+	Load(ctx context.Context, media *url.URL, metadata MediaMetadata) error
+}
+
+// PlaybackControllerV2 provides methods for controlling media playback.
+type PlaybackControllerV2 interface {
+	Play(ctx context.Context) error
+	Pause(ctx context.Context) error
+	Stop(ctx context.Context) error
+	SeekTo(ctx context.Context, pos time.Duration) error
+}
+
+// VolumeControllerV2 provides methods for adjusting volume settings.
+type VolumeControllerV2 interface {
+	SetVolumeLevel(ctx context.Context, level float64) error
+	Mute(ctx context.Context) error
+	Unmute(ctx context.Context) error
+}
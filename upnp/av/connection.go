@@ -0,0 +1,105 @@
+package av
+
+import (
+	"strings"
+
+	"github.com/ericyan/omnicast/upnp"
+	"github.com/ericyan/omnicast/upnp/internal/soap"
+)
+
+// SinkProtocols are the MIME types of media accepted by the renderer, as
+// reported by the ConnectionManager service.
+var SinkProtocols = []string{
+	"video/mp4",
+	"video/webm",
+	"video/x-matroska",
+	"video/mp2t",
+	"application/vnd.apple.mpegurl",
+	"application/dash+xml",
+	"audio/mpeg",
+	"audio/mp4",
+	"audio/aac",
+	"audio/flac",
+	"audio/ogg",
+	"audio/wav",
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+}
+
+// ConnectionManager returns a ConnectionManager UPnP service, with the
+// only connection of ID 0, as the renderer does not implement
+// PrepareForConnection.
+//
+// Spec: http://upnp.org/specs/av/UPnP-av-ConnectionManager-v1-Service.pdf
+func ConnectionManager() *upnp.Service {
+	svc := upnp.NewService("ConnectionManager", 1)
+
+	var (
+		ErrInvalidConnectionReference = &soap.Error{Code: 706, Description: "Invalid connection reference"}
+	)
+
+	svc.AddStateVariable(&upnp.StateVariable{Name: "SourceProtocolInfo", SendEvents: "yes", DataType: "string"})
+	svc.AddStateVariable(&upnp.StateVariable{Name: "SinkProtocolInfo", SendEvents: "yes", DataType: "string"})
+	svc.AddStateVariable(&upnp.StateVariable{Name: "CurrentConnectionIDs", SendEvents: "yes", DataType: "string"})
+	svc.AddStateVariable(stateVariable("A_ARG_TYPE_ConnectionStatus", "string", "OK", "ContentFormatMismatch", "InsufficientBandwidth", "UnreliableChannel", "Unknown"))
+	svc.AddStateVariable(stateVariable("A_ARG_TYPE_ConnectionManager", "string"))
+	svc.AddStateVariable(stateVariable("A_ARG_TYPE_Direction", "string", "Output", "Input"))
+	svc.AddStateVariable(stateVariable("A_ARG_TYPE_ProtocolInfo", "string"))
+	svc.AddStateVariable(stateVariable("A_ARG_TYPE_ConnectionID", "i4"))
+	svc.AddStateVariable(stateVariable("A_ARG_TYPE_AVTransportID", "i4"))
+	svc.AddStateVariable(stateVariable("A_ARG_TYPE_RcsID", "i4"))
+
+	svc.RegisterAction("GetProtocolInfo", []*upnp.SCPDArgument{
+		upnp.Out("Source", "SourceProtocolInfo"),
+		upnp.Out("Sink", "SinkProtocolInfo"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		sink := make([]string, len(SinkProtocols))
+		for i, mime := range SinkProtocols {
+			sink[i] = "http-get:*:" + mime + ":*"
+		}
+
+		resp.Args["Source"] = ""
+		resp.Args["Sink"] = strings.Join(sink, ",")
+	})
+
+	svc.RegisterAction("GetCurrentConnectionIDs", []*upnp.SCPDArgument{
+		upnp.Out("ConnectionIDs", "CurrentConnectionIDs"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		resp.Args["ConnectionIDs"] = "0"
+	})
+
+	svc.RegisterAction("GetCurrentConnectionInfo", []*upnp.SCPDArgument{
+		upnp.In("ConnectionID", "A_ARG_TYPE_ConnectionID"),
+		upnp.Out("RcsID", "A_ARG_TYPE_RcsID"),
+		upnp.Out("AVTransportID", "A_ARG_TYPE_AVTransportID"),
+		upnp.Out("ProtocolInfo", "A_ARG_TYPE_ProtocolInfo"),
+		upnp.Out("PeerConnectionManager", "A_ARG_TYPE_ConnectionManager"),
+		upnp.Out("PeerConnectionID", "A_ARG_TYPE_ConnectionID"),
+		upnp.Out("Direction", "A_ARG_TYPE_Direction"),
+		upnp.Out("Status", "A_ARG_TYPE_ConnectionStatus"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		var args struct {
+			ConnectionID int32
+		}
+		if err := req.Bind(&args); err != nil {
+			resp.Error = soap.ErrInvalidArgs
+			return
+		}
+		if args.ConnectionID != 0 {
+			resp.Error = ErrInvalidConnectionReference
+			return
+		}
+
+		resp.Args["RcsID"] = "0"
+		resp.Args["AVTransportID"] = "0"
+		resp.Args["ProtocolInfo"] = ""
+		resp.Args["PeerConnectionManager"] = ""
+		resp.Args["PeerConnectionID"] = "-1"
+		resp.Args["Direction"] = "Input"
+		resp.Args["Status"] = "OK"
+	})
+
+	return svc
+}
@@ -11,20 +11,53 @@ import (
 // RenderingControl returns a RenderingControl UPnP service for the Player.
 //
 // Spec: http://upnp.org/specs/av/UPnP-av-RenderingControl-v1-Service.pdf
-func RenderingControl(player omnicast.MediaPlayer) *upnp.Service {
+func RenderingControl(player omnicast.MediaPlayerV2) *upnp.Service {
 	svc := upnp.NewService("RenderingControl", 1)
 
+	volume := stateVariable("Volume", "ui2")
+	volume.AllowedValueRange = &upnp.AllowedValueRange{Minimum: "0", Maximum: "100", Step: "1"}
+
+	svc.AddStateVariable(stateVariable("A_ARG_TYPE_InstanceID", "ui4"))
+	svc.AddStateVariable(stateVariable("A_ARG_TYPE_Channel", "string", "Master"))
+	svc.AddStateVariable(stateVariable("A_ARG_TYPE_PresetName", "string", "FactoryDefault"))
+	svc.AddStateVariable(stateVariable("PresetNameList", "string"))
+	svc.AddStateVariable(volume)
+	svc.AddStateVariable(stateVariable("Mute", "boolean"))
+	svc.AddStateVariable(lastChange())
+
+	instanceID := upnp.In("InstanceID", "A_ARG_TYPE_InstanceID")
+	channel := upnp.In("Channel", "A_ARG_TYPE_Channel")
+
 	var (
-		ErrInvalidInstanceID = &soap.Error{702, "Invalid InstanceID"}
+		ErrInvalidInstanceID = &soap.Error{Code: 702, Description: "Invalid InstanceID"}
 	)
 
-	svc.RegisterAction("GetVolume", func(req *soap.Request, resp *soap.Response) {
-		if req.Args["InstanceID"] != "0" {
+	svc.RegisterAction("ListPresets", []*upnp.SCPDArgument{
+		instanceID,
+		upnp.Out("CurrentPresetNameList", "PresetNameList"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		if !isInstance(req) {
 			resp.Error = ErrInvalidInstanceID
 			return
 		}
-		if req.Args["Channel"] != "Master" {
-			resp.Error = soap.ErrInvalidArgs
+
+		resp.Args["CurrentPresetNameList"] = "FactoryDefault"
+	})
+
+	// There is nothing to restore for the only preset, since the volume
+	// level is controlled by the player.
+	svc.RegisterAction("SelectPreset", []*upnp.SCPDArgument{
+		instanceID,
+		upnp.In("PresetName", "A_ARG_TYPE_PresetName"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		if !isInstance(req) {
+			resp.Error = ErrInvalidInstanceID
+		}
+	})
+
+	svc.RegisterAction("GetVolume", []*upnp.SCPDArgument{instanceID, channel, upnp.Out("CurrentVolume", "Volume")}, func(req *soap.Request, resp *soap.Response) {
+		if !isInstance(req) {
+			resp.Error = ErrInvalidInstanceID
 			return
 		}
 
@@ -32,23 +65,73 @@ func RenderingControl(player omnicast.MediaPlayer) *upnp.Service {
 		resp.Args["CurrentVolume"] = strconv.Itoa(vol)
 	})
 
-	svc.RegisterAction("SetVolume", func(req *soap.Request, resp *soap.Response) {
-		if req.Args["InstanceID"] != "0" {
+	svc.RegisterAction("SetVolume", []*upnp.SCPDArgument{instanceID, channel, upnp.In("DesiredVolume", "Volume")}, func(req *soap.Request, resp *soap.Response) {
+		var args struct {
+			InstanceID    uint32
+			DesiredVolume uint16
+		}
+		if err := req.Bind(&args); err != nil {
+			resp.Error = soap.ErrInvalidArgs
+			return
+		}
+		if args.InstanceID != 0 {
 			resp.Error = ErrInvalidInstanceID
 			return
 		}
-		if req.Args["Channel"] != "Master" {
-			resp.Error = soap.ErrInvalidArgs
+		if !omnicast.CapabilitiesOf(player).Has(omnicast.CanSetVolume) {
+			resp.Error = actionError(omnicast.ErrNotSupported)
 			return
 		}
 
-		vol, err := strconv.Atoi(req.Args["DesiredVolume"])
-		if err != nil {
+		if err := player.SetVolumeLevel(req.Context(), float64(args.DesiredVolume)/100.0); err != nil {
+			resp.Error = actionError(err)
+		}
+	})
+
+	svc.RegisterAction("GetMute", []*upnp.SCPDArgument{instanceID, channel, upnp.Out("CurrentMute", "Mute")}, func(req *soap.Request, resp *soap.Response) {
+		if !isInstance(req) {
+			resp.Error = ErrInvalidInstanceID
+			return
+		}
+
+		if player.IsMuted() {
+			resp.Args["CurrentMute"] = "1"
+		} else {
+			resp.Args["CurrentMute"] = "0"
+		}
+	})
+
+	svc.RegisterAction("SetMute", []*upnp.SCPDArgument{instanceID, channel, upnp.In("DesiredMute", "Mute")}, func(req *soap.Request, resp *soap.Response) {
+		var args struct {
+			InstanceID  uint32
+			DesiredMute bool
+		}
+		if err := req.Bind(&args); err != nil {
 			resp.Error = soap.ErrInvalidArgs
 			return
 		}
+		if args.InstanceID != 0 {
+			resp.Error = ErrInvalidInstanceID
+			return
+		}
 
-		player.SetVolumeLevel(float64(vol) / 100.0)
+		// Players without independent muting may still emulate it by
+		// adjusting the volume level.
+		caps := omnicast.CapabilitiesOf(player)
+		if !caps.Has(omnicast.CanMute) && !caps.Has(omnicast.CanSetVolume) {
+			resp.Error = actionError(omnicast.ErrNotSupported)
+			return
+		}
+
+		var err error
+		if args.DesiredMute {
+			err = player.Mute(req.Context())
+		} else {
+			err = player.Unmute(req.Context())
+		}
+		if err != nil {
+			resp.Error = actionError(err)
+		}
 	})
 
 	return svc
@@ -0,0 +1,69 @@
+package av_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ericyan/omnicast/omnicasttest"
+	"github.com/ericyan/omnicast/upnp/av"
+	"github.com/ericyan/omnicast/upnp/internal/soap"
+)
+
+func TestValidation(t *testing.T) {
+	player := omnicasttest.NewPlayer("Test Player")
+	dev, err := av.NewMediaRenderer("Test Renderer", player)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(dev)
+	defer srv.Close()
+
+	controlURL := srv.URL + "/services/RenderingControl"
+	action := &soap.Action{Namespace: "urn:schemas-upnp-org:service:RenderingControl:1", Name: "SetVolume"}
+
+	tests := []struct {
+		instance, channel, volume string
+		code                      int
+	}{
+		{"0", "Master", "", 402},
+		{"zero", "Master", "50", 402},
+		{"-1", "Master", "50", 402},
+		{"0", "LF", "50", 600},
+		{"0", "Master", "101", 601},
+		{"1", "Master", "50", 702},
+		{"0", "Master", "50", 0},
+	}
+
+	for _, tc := range tests {
+		args := []soap.Arg{
+			{Name: "InstanceID", Value: tc.instance},
+			{Name: "Channel", Value: tc.channel},
+		}
+		if tc.volume != "" {
+			args = append(args, soap.Arg{Name: "DesiredVolume", Value: tc.volume})
+		}
+
+		_, err := soap.Call(context.Background(), nil, controlURL, action, args)
+		if tc.code == 0 {
+			if err != nil {
+				t.Errorf("%v: %s", args, err)
+			}
+			continue
+		}
+
+		if uerr, ok := err.(*soap.Error); !ok || uerr.Code != tc.code {
+			t.Errorf("%v: unexpected error: %v; want %d", args, err, tc.code)
+		}
+	}
+	if player.VolumeLevel() != 0.5 {
+		t.Errorf("Unexpected volume level: %.2f", player.VolumeLevel())
+	}
+
+	action.Name = "Dance"
+	_, err = soap.Call(context.Background(), nil, controlURL, action, nil)
+	if uerr, ok := err.(*soap.Error); !ok || uerr.Code != 401 {
+		t.Errorf("Unexpected error for unknown action: %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package av
+
+import (
+	"errors"
+	"log"
+
+	"github.com/ericyan/omnicast"
+	"github.com/ericyan/omnicast/upnp/internal/soap"
+)
+
+// AVTransport specific errors.
+var (
+	errTransitionNotAvailable = &soap.Error{Code: 701, Description: "Transition not available"}
+	errResourceNotFound       = &soap.Error{Code: 716, Description: "Resource not found"}
+)
+
+// actionError converts an error returned by the player into an UPnP
+// error to be sent to the control point.
+func actionError(err error) *soap.Error {
+	log.Println(err)
+
+	switch {
+	case errors.Is(err, omnicast.ErrNoMedia):
+		return errTransitionNotAvailable
+	case errors.Is(err, omnicast.ErrInvalidMedia):
+		return errResourceNotFound
+	case errors.Is(err, omnicast.ErrNotSupported):
+		return soap.ErrActionNotImplemented
+	default:
+		return soap.ErrActionFailed
+	}
+}
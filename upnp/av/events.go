@@ -0,0 +1,161 @@
+package av
+
+import (
+	"context"
+	"encoding/xml"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ericyan/omnicast"
+	"github.com/ericyan/omnicast/upnp/internal/types"
+)
+
+// parseLastChange returns the state variables of the only instance in the
+// LastChange event. Variables of channels other than Master are ignored.
+func parseLastChange(lastChange string) (map[string]string, error) {
+	var v struct {
+		Instances []struct {
+			ID   string `xml:"val,attr"`
+			Vars []struct {
+				XMLName xml.Name
+				Channel string `xml:"channel,attr"`
+				Value   string `xml:"val,attr"`
+			} `xml:",any"`
+		} `xml:"InstanceID"`
+	}
+	if err := xml.Unmarshal([]byte(lastChange), &v); err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string)
+	for _, instance := range v.Instances {
+		if instance.ID != "0" {
+			continue
+		}
+
+		for _, sv := range instance.Vars {
+			if sv.Channel == "" || sv.Channel == "Master" {
+				vars[sv.XMLName.Local] = sv.Value
+			}
+		}
+	}
+
+	return vars, nil
+}
+
+// first returns the first of the variables present.
+func first(vars map[string]string, names ...string) (string, bool) {
+	for _, name := range names {
+		if v, ok := vars[name]; ok {
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+// events converts the evented state variables into events.
+func (r *Renderer) events(vars map[string]string) []*omnicast.Event {
+	if lastChange, ok := vars["LastChange"]; ok {
+		var err error
+		if vars, err = parseLastChange(lastChange); err != nil {
+			log.Printf("%s: failed to parse LastChange: %s\n", r.Name(), err)
+			return nil
+		}
+	}
+
+	var events []*omnicast.Event
+	if uri, ok := first(vars, "AVTransportURI", "CurrentTrackURI"); ok {
+		e := &omnicast.Event{Type: omnicast.MediaChanged}
+		if u, err := url.Parse(uri); err == nil && uri != "" {
+			e.MediaURL = u
+		}
+		if didl, ok := first(vars, "AVTransportURIMetaData", "CurrentTrackMetaData"); ok {
+			e.MediaMetadata = parseMetadata(didl)
+		}
+		if d, ok := first(vars, "CurrentMediaDuration", "CurrentTrackDuration"); ok {
+			e.MediaDuration, _ = types.ParseDuration(d)
+		}
+
+		events = append(events, e)
+	}
+
+	if state, ok := vars["TransportState"]; ok {
+		events = append(events, &omnicast.Event{
+			Type:     omnicast.StateChanged,
+			State:    playbackState(state),
+			Position: r.PlaybackPosition(),
+		})
+	}
+
+	vol, hasVolume := vars["Volume"]
+	mute, hasMute := vars["Mute"]
+	if hasVolume || hasMute {
+		e := &omnicast.Event{Type: omnicast.VolumeChanged}
+		if v, err := strconv.Atoi(vol); hasVolume && err == nil {
+			e.VolumeLevel = float64(v) / float64(r.maxVolume)
+		} else {
+			e.VolumeLevel = r.VolumeLevel()
+		}
+		if m, err := strconv.ParseBool(mute); hasMute && err == nil {
+			e.Muted = m
+		} else {
+			e.Muted = r.IsMuted()
+		}
+
+		events = append(events, e)
+	}
+
+	return events
+}
+
+// Subscribe implements the omnicast.EventSource interface. Events are
+// derived from the LastChange events of the AVTransport service and, if
+// available, the RenderingControl service.
+func (r *Renderer) Subscribe(ctx context.Context) (<-chan *omnicast.Event, error) {
+	avt, err := r.avt.Subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var rc <-chan map[string]string
+	if r.rc != nil {
+		if rc, err = r.rc.Subscribe(ctx); err != nil {
+			log.Printf("%s: failed to subscribe to volume changes: %s\n", r.Name(), err)
+		}
+	}
+
+	evCh := make(chan *omnicast.Event, 16)
+	go func() {
+		defer close(evCh)
+
+		for avt != nil || rc != nil {
+			var vars map[string]string
+			var ok bool
+			select {
+			case vars, ok = <-avt:
+				if !ok {
+					avt = nil
+					continue
+				}
+			case vars, ok = <-rc:
+				if !ok {
+					rc = nil
+					continue
+				}
+			}
+
+			for _, e := range r.events(vars) {
+				e.Time = time.Now()
+				select {
+				case evCh <- e:
+				default:
+				}
+			}
+		}
+	}()
+
+	return evCh, nil
+}
@@ -0,0 +1,399 @@
+package av
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ericyan/omnicast"
+	"github.com/ericyan/omnicast/upnp"
+	"github.com/ericyan/omnicast/upnp/internal/soap"
+	"github.com/ericyan/omnicast/upnp/internal/types"
+)
+
+// MediaRendererType is the URN of MediaRenderer devices searched for.
+const MediaRendererType = "urn:schemas-upnp-org:device:MediaRenderer:1"
+
+// controlTimeout is the maximum time to wait for the renderer to report
+// its state.
+const controlTimeout = 5 * time.Second
+
+// Errors returned when controlling renderers.
+var (
+	ErrNotRenderer      = errors.New("av: device has no AVTransport service")
+	ErrRendererNotFound = errors.New("av: renderer not found")
+)
+
+// A Renderer is a remote MediaRenderer, e.g. a smart TV or a DLNA speaker,
+// controlled as an omnicast.MediaPlayerV2 via its AVTransport service and,
+// if available, RenderingControl service.
+type Renderer struct {
+	dev *upnp.RemoteDevice
+	avt *upnp.RemoteService
+	rc  *upnp.RemoteService
+
+	maxVolume int
+}
+
+// NewRenderer returns a Renderer for the device.
+func NewRenderer(dev *upnp.RemoteDevice) (*Renderer, error) {
+	r := &Renderer{
+		dev:       dev,
+		avt:       dev.Service("AVTransport"),
+		rc:        dev.Service("RenderingControl"),
+		maxVolume: 100,
+	}
+	if r.avt == nil {
+		return nil, ErrNotRenderer
+	}
+
+	// Volume levels are 0 to 100 by default, unless restricted otherwise.
+	if r.rc != nil && r.rc.SCPD != nil {
+		if v := r.rc.SCPD.StateVariable("Volume"); v != nil && v.AllowedValueRange != nil {
+			var max int
+			if _, err := fmt.Sscan(v.AllowedValueRange.Maximum, &max); err == nil && max > 0 {
+				r.maxVolume = max
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// DiscoverRenderers searches the network for MediaRenderer devices, on the
+// named interfaces or all multicast-capable ones.
+func DiscoverRenderers(ctx context.Context, ifaces ...string) ([]*upnp.RemoteDevice, error) {
+	return upnp.Discover(ctx, MediaRendererType, ifaces...)
+}
+
+// FindRenderer returns a Renderer for the first MediaRenderer found whose
+// friendly name or UDN matches one of the hints, or the first one found if
+// no hint is given.
+func FindRenderer(ctx context.Context, hints []string, ifaces ...string) (*Renderer, error) {
+	devices, err := DiscoverRenderers(ctx, ifaces...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dev := range devices {
+		if len(hints) == 0 {
+			return NewRenderer(dev)
+		}
+
+		for _, hint := range hints {
+			if hint == dev.FriendlyName || hint == dev.UDN || "uuid:"+hint == dev.UDN {
+				return NewRenderer(dev)
+			}
+		}
+	}
+
+	return nil, ErrRendererNotFound
+}
+
+// Device returns the device of the renderer.
+func (r *Renderer) Device() *upnp.RemoteDevice {
+	return r.dev
+}
+
+// Name returns the friendly name of the renderer.
+func (r *Renderer) Name() string {
+	return r.dev.FriendlyName
+}
+
+// rendererError converts an UPnP error reported by the renderer into the
+// omnicast error of the same meaning, if any.
+func rendererError(err error) error {
+	var uerr *soap.Error
+	if !errors.As(err, &uerr) {
+		return err
+	}
+
+	switch uerr.Code {
+	case errTransitionNotAvailable.Code:
+		return fmt.Errorf("%s: %w", uerr.Description, omnicast.ErrNoMedia)
+	case errResourceNotFound.Code, 714:
+		return fmt.Errorf("%s: %w", uerr.Description, omnicast.ErrInvalidMedia)
+	case soap.ErrInvalidAction.Code, soap.ErrActionNotImplemented.Code:
+		return fmt.Errorf("%s: %w", uerr.Description, omnicast.ErrNotSupported)
+	default:
+		return err
+	}
+}
+
+// call invokes the action of the service for the only instance supported.
+func (r *Renderer) call(ctx context.Context, svc *upnp.RemoteService, action string, args map[string]interface{}) (upnp.Args, error) {
+	if svc == nil {
+		return nil, omnicast.ErrNotSupported
+	}
+
+	in := map[string]interface{}{"InstanceID": 0}
+	for k, v := range args {
+		in[k] = v
+	}
+
+	out, err := svc.Call(ctx, action, in)
+	if errors.Is(err, upnp.ErrActionNotFound) {
+		return nil, fmt.Errorf("%s: %w", action, omnicast.ErrNotSupported)
+	}
+
+	return out, rendererError(err)
+}
+
+// query invokes the action for reporting the state of the renderer.
+func (r *Renderer) query(svc *upnp.RemoteService, action string, args map[string]interface{}) upnp.Args {
+	ctx, cancel := context.WithTimeout(context.Background(), controlTimeout)
+	defer cancel()
+
+	out, err := r.call(ctx, svc, action, args)
+	if err != nil {
+		return upnp.Args{}
+	}
+
+	return out
+}
+
+// Load loads the media and starts playback.
+func (r *Renderer) Load(ctx context.Context, media *url.URL, metadata omnicast.MediaMetadata) error {
+	var didl string
+	if metadata != nil {
+		data, err := types.NewMetadata(omnicast.DetailsOf(metadata)).MarshalText()
+		if err != nil {
+			return err
+		}
+		didl = string(data)
+	}
+
+	_, err := r.call(ctx, r.avt, "SetAVTransportURI", map[string]interface{}{
+		"CurrentURI":         media,
+		"CurrentURIMetaData": didl,
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.Play(ctx)
+}
+
+// mediaInfo returns the output of GetMediaInfo.
+func (r *Renderer) mediaInfo() upnp.Args {
+	return r.query(r.avt, "GetMediaInfo", nil)
+}
+
+// MediaURL returns the URL of the loaded media, if any.
+func (r *Renderer) MediaURL() *url.URL {
+	u, err := url.Parse(r.mediaInfo()["CurrentURI"])
+	if err != nil || u.String() == "" {
+		return nil
+	}
+
+	return u
+}
+
+// parseMetadata returns the media metadata in DIDL-Lite, or nil if there
+// is none.
+func parseMetadata(didl string) omnicast.MediaMetadata {
+	if didl == "" || didl == "NOT_IMPLEMENTED" {
+		return nil
+	}
+
+	m := make(types.Metadata)
+	if err := m.UnmarshalText([]byte(didl)); err != nil || len(m) == 0 {
+		return nil
+	}
+
+	return m
+}
+
+// MediaMetadata returns the metadata of the loaded media, if any.
+func (r *Renderer) MediaMetadata() omnicast.MediaMetadata {
+	return parseMetadata(r.mediaInfo()["CurrentURIMetaData"])
+}
+
+// MediaDuration returns the duration of the loaded media.
+func (r *Renderer) MediaDuration() time.Duration {
+	d, _ := r.mediaInfo().Duration("MediaDuration")
+	return d
+}
+
+// transportState returns the CurrentTransportState of the renderer.
+func (r *Renderer) transportState() string {
+	return r.query(r.avt, "GetTransportInfo", nil)["CurrentTransportState"]
+}
+
+// playbackState converts a TransportState into the playback state.
+func playbackState(state string) omnicast.PlaybackState {
+	switch state {
+	case "PLAYING":
+		return omnicast.StatePlaying
+	case "PAUSED_PLAYBACK", "PAUSED_RECORDING":
+		return omnicast.StatePaused
+	case "TRANSITIONING":
+		return omnicast.StateBuffering
+	default:
+		return omnicast.StateIdle
+	}
+}
+
+// IsIdle returns true if there is no media playing or paused, including
+// when stopped.
+func (r *Renderer) IsIdle() bool {
+	return playbackState(r.transportState()) == omnicast.StateIdle
+}
+
+// IsPlaying returns true if the media is playing.
+func (r *Renderer) IsPlaying() bool {
+	return playbackState(r.transportState()) == omnicast.StatePlaying
+}
+
+// IsPaused returns true if the playback is paused.
+func (r *Renderer) IsPaused() bool {
+	return playbackState(r.transportState()) == omnicast.StatePaused
+}
+
+// IsBuffering returns true if the renderer is transitioning.
+func (r *Renderer) IsBuffering() bool {
+	return playbackState(r.transportState()) == omnicast.StateBuffering
+}
+
+// PlaybackPosition returns the playback position.
+func (r *Renderer) PlaybackPosition() time.Duration {
+	pos, _ := r.query(r.avt, "GetPositionInfo", nil).Duration("RelTime")
+	return pos
+}
+
+// PlaybackRate returns the transport play speed.
+func (r *Renderer) PlaybackRate() float32 {
+	speed, ok := new(big.Rat).SetString(r.query(r.avt, "GetTransportInfo", nil)["CurrentSpeed"])
+	if !ok {
+		return 0
+	}
+
+	rate, _ := speed.Float32()
+	return rate
+}
+
+// Play starts or resumes playback.
+func (r *Renderer) Play(ctx context.Context) error {
+	_, err := r.call(ctx, r.avt, "Play", map[string]interface{}{"Speed": "1"})
+	return err
+}
+
+// Pause pauses playback.
+func (r *Renderer) Pause(ctx context.Context) error {
+	_, err := r.call(ctx, r.avt, "Pause", nil)
+	return err
+}
+
+// Stop stops playback.
+func (r *Renderer) Stop(ctx context.Context) error {
+	_, err := r.call(ctx, r.avt, "Stop", nil)
+	return err
+}
+
+// SeekTo seeks to the position relative to the start of the track.
+func (r *Renderer) SeekTo(ctx context.Context, pos time.Duration) error {
+	_, err := r.call(ctx, r.avt, "Seek", map[string]interface{}{
+		"Unit":   "REL_TIME",
+		"Target": pos,
+	})
+	return err
+}
+
+// VolumeLevel returns the volume level of the master channel, between 0
+// and 1.
+func (r *Renderer) VolumeLevel() float64 {
+	vol, err := r.query(r.rc, "GetVolume", map[string]interface{}{"Channel": "Master"}).Int("CurrentVolume")
+	if err != nil {
+		return 0
+	}
+
+	return float64(vol) / float64(r.maxVolume)
+}
+
+// IsMuted returns true if the master channel is muted.
+func (r *Renderer) IsMuted() bool {
+	muted, _ := r.query(r.rc, "GetMute", map[string]interface{}{"Channel": "Master"}).Bool("CurrentMute")
+	return muted
+}
+
+// SetVolumeLevel sets the volume level of the master channel, between 0
+// and 1.
+func (r *Renderer) SetVolumeLevel(ctx context.Context, level float64) error {
+	_, err := r.call(ctx, r.rc, "SetVolume", map[string]interface{}{
+		"Channel":       "Master",
+		"DesiredVolume": int(math.Round(level * float64(r.maxVolume))),
+	})
+	return err
+}
+
+// Mute mutes the master channel.
+func (r *Renderer) Mute(ctx context.Context) error {
+	return r.setMute(ctx, true)
+}
+
+// Unmute unmutes the master channel.
+func (r *Renderer) Unmute(ctx context.Context) error {
+	return r.setMute(ctx, false)
+}
+
+func (r *Renderer) setMute(ctx context.Context, mute bool) error {
+	_, err := r.call(ctx, r.rc, "SetMute", map[string]interface{}{
+		"Channel":     "Master",
+		"DesiredMute": mute,
+	})
+	return err
+}
+
+// hasAction returns true if the service provides the action, which is
+// assumed if its description is unavailable.
+func hasAction(svc *upnp.RemoteService, action string) bool {
+	if svc == nil {
+		return false
+	}
+
+	return svc.SCPD == nil || svc.SCPD.Action(action) != nil
+}
+
+// Capabilities implements the omnicast.CapabilityReporter interface. The
+// transport actions are those currently available, as reported by the
+// renderer if supported.
+func (r *Renderer) Capabilities() omnicast.Capability {
+	var c omnicast.Capability
+
+	actions := strings.Split(r.query(r.avt, "GetCurrentTransportActions", nil)["Actions"], ",")
+	if len(actions) == 1 && actions[0] == "" {
+		actions = nil
+		for _, action := range []string{"Pause", "Seek", "Next", "Previous"} {
+			if hasAction(r.avt, action) {
+				actions = append(actions, action)
+			}
+		}
+	}
+
+	for _, action := range actions {
+		switch strings.TrimSpace(action) {
+		case "Pause":
+			c |= omnicast.CanPause
+		case "Seek", "X_DLNA_SeekTime":
+			c |= omnicast.CanSeek
+		case "Next":
+			c |= omnicast.CanGoNext
+		case "Previous":
+			c |= omnicast.CanGoPrevious
+		}
+	}
+
+	if hasAction(r.rc, "SetVolume") {
+		c |= omnicast.CanSetVolume
+	}
+	if hasAction(r.rc, "SetMute") {
+		c |= omnicast.CanMute
+	}
+
+	return c
+}
@@ -0,0 +1,272 @@
+package av_test
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ericyan/omnicast"
+	"github.com/ericyan/omnicast/omnicasttest"
+	"github.com/ericyan/omnicast/upnp"
+	"github.com/ericyan/omnicast/upnp/av"
+)
+
+// genaServer adds event subscriptions to a device, which are otherwise
+// not supported by the device side.
+type genaServer struct {
+	http.Handler
+
+	mu        sync.Mutex
+	callbacks map[string]string
+}
+
+func (s *genaServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "SUBSCRIBE":
+		s.mu.Lock()
+		s.callbacks[r.URL.Path] = strings.Trim(r.Header.Get("CALLBACK"), "<>")
+		s.mu.Unlock()
+
+		w.Header().Set("SID", "uuid:"+r.URL.Path)
+		w.Header().Set("TIMEOUT", "Second-1800")
+	case "UNSUBSCRIBE":
+	default:
+		s.Handler.ServeHTTP(w, r)
+	}
+}
+
+// notify sends the LastChange event to the subscriber of the path.
+func (s *genaServer) notify(t *testing.T, path, lastChange string) {
+	s.mu.Lock()
+	callback := s.callbacks[path]
+	s.mu.Unlock()
+
+	b := new(strings.Builder)
+	xml.EscapeText(b, []byte(lastChange))
+	body := `<?xml version="1.0"?><e:propertyset xmlns:e="urn:schemas-upnp-org:event-1-0"><e:property><LastChange>` + b.String() + `</LastChange></e:property></e:propertyset>`
+
+	req, err := http.NewRequest("NOTIFY", callback, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("NT", "upnp:event")
+	req.Header.Set("NTS", "upnp:propchange")
+	req.Header.Set("SID", "uuid:"+path)
+	req.Header.Set("SEQ", "0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected response to event: %s", resp.Status)
+	}
+}
+
+func newRemoteRenderer(t *testing.T) (*av.Renderer, *omnicasttest.Player, *genaServer, func()) {
+	player := omnicasttest.NewPlayer("Test Player")
+	dev, err := av.NewMediaRenderer("Test Renderer", player)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gena := &genaServer{Handler: dev, callbacks: make(map[string]string)}
+	srv := httptest.NewServer(gena)
+
+	loc, _ := url.Parse(srv.URL + "/")
+	rdev, err := upnp.NewRemoteDevice(context.Background(), loc)
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+
+	r, err := av.NewRenderer(rdev)
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+
+	return r, player, gena, srv.Close
+}
+
+func TestRenderer(t *testing.T) {
+	r, player, _, done := newRemoteRenderer(t)
+	defer done()
+
+	if r.Name() != "Test Renderer" || r.Device().UDN == "" {
+		t.Errorf("Unexpected device: %+v", r.Device())
+	}
+	for _, svc := range r.Device().Services {
+		if svc.SCPD == nil {
+			t.Errorf("Missing SCPD of %s", svc.ServiceType)
+		}
+	}
+
+	ctx := context.Background()
+	if err := r.Play(ctx); !errors.Is(err, omnicast.ErrNoMedia) {
+		t.Errorf("Unexpected error without media: %v", err)
+	}
+
+	media, _ := url.Parse("http://example.com/video.mp4")
+	metadata := (&omnicast.MediaDetails{Type: omnicast.Movie, Title: "Big Buck Bunny"}).Metadata()
+	if err := r.Load(ctx, media, metadata); err != nil {
+		t.Fatal(err)
+	}
+	if player.MediaURL().String() != media.String() || player.MediaMetadata().Title() != "Big Buck Bunny" {
+		t.Errorf("Unexpected media loaded: %s %v", player.MediaURL(), player.MediaMetadata())
+	}
+	if !r.IsPlaying() || r.MediaURL().String() != media.String() || r.MediaMetadata().Title() != "Big Buck Bunny" {
+		t.Errorf("Unexpected state after loading: %s %s %v", omnicast.StateOf(r), r.MediaURL(), r.MediaMetadata())
+	}
+	if caps := r.Capabilities(); !caps.Has(omnicast.CanPause, omnicast.CanSeek, omnicast.CanSetVolume, omnicast.CanMute) {
+		t.Errorf("Unexpected capabilities: %s", caps)
+	}
+
+	if err := r.Pause(ctx); err != nil || !player.IsPaused() || !r.IsPaused() {
+		t.Errorf("Unexpected state after pausing: %s %v", player.State(), err)
+	}
+
+	if err := r.SeekTo(ctx, 90*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if player.PlaybackPosition() != 90*time.Second || r.PlaybackPosition() != 90*time.Second {
+		t.Errorf("Unexpected position after seeking: %s", player.PlaybackPosition())
+	}
+
+	if err := r.SetVolumeLevel(ctx, 0.4); err != nil {
+		t.Fatal(err)
+	}
+	if player.VolumeLevel() != 0.4 || r.VolumeLevel() != 0.4 {
+		t.Errorf("Unexpected volume level: %.2f", player.VolumeLevel())
+	}
+
+	if err := r.Mute(ctx); err != nil || !player.IsMuted() || !r.IsMuted() {
+		t.Errorf("Unexpected mute state: %t %v", player.IsMuted(), err)
+	}
+	if err := r.Unmute(ctx); err != nil || player.IsMuted() || r.IsMuted() {
+		t.Errorf("Unexpected mute state: %t %v", player.IsMuted(), err)
+	}
+
+	if err := r.Stop(ctx); err != nil || !player.IsIdle() || !r.IsIdle() {
+		t.Errorf("Unexpected state after stopping: %s %v", player.State(), err)
+	}
+}
+
+func TestRendererCall(t *testing.T) {
+	r, _, _, done := newRemoteRenderer(t)
+	defer done()
+
+	ctx := context.Background()
+	avt := r.Device().Service("urn:schemas-upnp-org:service:AVTransport:1")
+	if avt == nil || avt != r.Device().Service("AVTransport") {
+		t.Fatal("AVTransport not found")
+	}
+
+	if _, err := avt.Call(ctx, "Dance", nil); !errors.Is(err, upnp.ErrActionNotFound) {
+		t.Errorf("Unexpected error for unknown action: %v", err)
+	}
+	if _, err := avt.Call(ctx, "Stop", nil); err == nil {
+		t.Error("Expect error for missing argument")
+	}
+	if _, err := avt.Call(ctx, "Stop", map[string]interface{}{"InstanceID": 0, "Speed": 1}); !errors.Is(err, upnp.ErrArgumentNotFound) {
+		t.Errorf("Unexpected error for unknown argument: %v", err)
+	}
+
+	_, err := avt.Call(ctx, "Stop", map[string]interface{}{"InstanceID": 1})
+	if uerr, ok := err.(*upnp.Error); !ok || uerr.Code != 718 {
+		t.Errorf("Unexpected error for invalid instance: %v", err)
+	}
+
+	for _, svc := range r.Device().Services {
+		for _, a := range svc.SCPD.Actions {
+			if strings.HasPrefix(a.Name, "Record") || strings.HasPrefix(a.Name, "SetRecord") || a.Name == "Next" {
+				t.Errorf("Unimplemented action %s advertised", a.Name)
+			}
+		}
+	}
+
+	cm := r.Device().Service("ConnectionManager")
+	info, err := cm.Call(ctx, "GetProtocolInfo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(info["Sink"], "http-get:*:video/mp4:*") {
+		t.Errorf("Unexpected protocol info: %v", info)
+	}
+	if _, err := cm.Call(ctx, "GetCurrentConnectionInfo", map[string]interface{}{"ConnectionID": 1}); err == nil {
+		t.Error("Expect error for invalid connection")
+	}
+
+	out, err := avt.Call(ctx, "GetTransportInfo", map[string]interface{}{"InstanceID": uint32(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["CurrentTransportState"] != "NO_MEDIA_PRESENT" || out["CurrentTransportStatus"] != "OK" {
+		t.Errorf("Unexpected transport info: %v", out)
+	}
+}
+
+func TestRendererEvents(t *testing.T) {
+	r, _, gena, done := newRemoteRenderer(t)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := r.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gena.notify(t, "/services/AVTransport/events", `<Event xmlns="urn:schemas-upnp-org:metadata-1-0/AVT/">
+  <InstanceID val="0">
+    <TransportState val="PLAYING"/>
+    <AVTransportURI val="http://example.com/song.mp3"/>
+    <CurrentMediaDuration val="0:03:30"/>
+  </InstanceID>
+</Event>`)
+	gena.notify(t, "/services/RenderingControl/events", `<Event xmlns="urn:schemas-upnp-org:metadata-1-0/RCS/">
+  <InstanceID val="0">
+    <Volume channel="LF" val="10"/>
+    <Volume channel="Master" val="50"/>
+    <Mute channel="Master" val="1"/>
+  </InstanceID>
+</Event>`)
+
+	want := []omnicast.EventType{omnicast.MediaChanged, omnicast.StateChanged, omnicast.VolumeChanged}
+	for _, typ := range want {
+		select {
+		case e := <-events:
+			if e.Type != typ {
+				t.Fatalf("Unexpected event: %s; want %s", e.Type, typ)
+			}
+
+			switch e.Type {
+			case omnicast.MediaChanged:
+				if e.MediaURL.String() != "http://example.com/song.mp3" || e.MediaDuration != 210*time.Second {
+					t.Errorf("Unexpected media: %s %s", e.MediaURL, e.MediaDuration)
+				}
+			case omnicast.StateChanged:
+				if e.State != omnicast.StatePlaying {
+					t.Errorf("Unexpected state: %s", e.State)
+				}
+			case omnicast.VolumeChanged:
+				if e.VolumeLevel != 0.5 || !e.Muted {
+					t.Errorf("Unexpected volume: %.2f %t", e.VolumeLevel, e.Muted)
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Missing %s event", typ)
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+}
@@ -3,17 +3,48 @@ package av
 import (
 	"github.com/ericyan/omnicast"
 	"github.com/ericyan/omnicast/upnp"
+	"github.com/ericyan/omnicast/upnp/internal/soap"
 )
 
 // NewMediaRenderer returns a MediaRenderer UPnP device.
 //
 // Spec: http://upnp.org/specs/av/UPnP-av-MediaRenderer-v1-Device.pdf
-func NewMediaRenderer(name string, player omnicast.MediaPlayer) (*upnp.Device, error) {
+func NewMediaRenderer(name string, player omnicast.MediaPlayerV2) (*upnp.Device, error) {
 	dev := upnp.NewDevice(name, "MediaRenderer", 1)
 
 	dev.RegisterService(AVTransport(player))
 	dev.RegisterService(RenderingControl(player))
-	dev.RegisterService(upnp.NewService("ConnectionManager", 1))
+	dev.RegisterService(ConnectionManager())
 
 	return dev, nil
 }
+
+// isInstance returns true if the request is for the only instance of the
+// service, which is always 0.
+func isInstance(req *soap.Request) bool {
+	var args struct {
+		InstanceID uint32
+	}
+	if err := req.Bind(&args); err != nil {
+		return false
+	}
+
+	return args.InstanceID == 0
+}
+
+// stateVariable returns a state variable which is not evented, with the
+// allowed values if any.
+func stateVariable(name, dataType string, allowedValues ...string) *upnp.StateVariable {
+	return &upnp.StateVariable{
+		Name:          name,
+		SendEvents:    "no",
+		DataType:      dataType,
+		AllowedValues: allowedValues,
+	}
+}
+
+// lastChange returns the LastChange state variable, which is the only
+// evented one of AVTransport and RenderingControl.
+func lastChange() *upnp.StateVariable {
+	return &upnp.StateVariable{Name: "LastChange", SendEvents: "yes", DataType: "string"}
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/ericyan/omnicast"
 	"github.com/ericyan/omnicast/upnp"
@@ -14,48 +15,101 @@ import (
 // AVTransport returns an AVTransport UPnP service for the Player.
 //
 // Spec: http://upnp.org/specs/av/UPnP-av-AVTransport-v1-Service.pdf
-func AVTransport(player omnicast.MediaPlayer) *upnp.Service {
+func AVTransport(player omnicast.MediaPlayerV2) *upnp.Service {
 	svc := upnp.NewService("AVTransport", 1)
 
+	svc.AddStateVariable(stateVariable("A_ARG_TYPE_InstanceID", "ui4"))
+	svc.AddStateVariable(stateVariable("AVTransportURI", "string"))
+	svc.AddStateVariable(stateVariable("AVTransportURIMetaData", "string"))
+	svc.AddStateVariable(stateVariable("NextAVTransportURI", "string"))
+	svc.AddStateVariable(stateVariable("NextAVTransportURIMetaData", "string"))
+	svc.AddStateVariable(stateVariable("NumberOfTracks", "ui4"))
+	svc.AddStateVariable(stateVariable("CurrentMediaDuration", "string"))
+	svc.AddStateVariable(stateVariable("PlaybackStorageMedium", "string", "UNKNOWN", "NETWORK", "NONE", "NOT_IMPLEMENTED"))
+	svc.AddStateVariable(stateVariable("RecordStorageMedium", "string", "NOT_IMPLEMENTED"))
+	svc.AddStateVariable(stateVariable("RecordMediumWriteStatus", "string", "NOT_IMPLEMENTED"))
+	svc.AddStateVariable(stateVariable("PossiblePlaybackStorageMedia", "string"))
+	svc.AddStateVariable(stateVariable("PossibleRecordStorageMedia", "string"))
+	svc.AddStateVariable(stateVariable("PossibleRecordQualityModes", "string"))
+	svc.AddStateVariable(stateVariable("CurrentPlayMode", "string", "NORMAL"))
+	svc.AddStateVariable(stateVariable("CurrentRecordQualityMode", "string", "NOT_IMPLEMENTED"))
+	svc.AddStateVariable(stateVariable("TransportState", "string", "STOPPED", "PLAYING", "TRANSITIONING", "PAUSED_PLAYBACK", "NO_MEDIA_PRESENT"))
+	svc.AddStateVariable(stateVariable("TransportStatus", "string", "OK", "ERROR_OCCURRED"))
+	svc.AddStateVariable(stateVariable("TransportPlaySpeed", "string"))
+	svc.AddStateVariable(stateVariable("CurrentTrack", "ui4"))
+	svc.AddStateVariable(stateVariable("CurrentTrackDuration", "string"))
+	svc.AddStateVariable(stateVariable("CurrentTrackMetaData", "string"))
+	svc.AddStateVariable(stateVariable("CurrentTrackURI", "string"))
+	svc.AddStateVariable(stateVariable("RelativeTimePosition", "string"))
+	svc.AddStateVariable(stateVariable("AbsoluteTimePosition", "string"))
+	svc.AddStateVariable(stateVariable("RelativeCounterPosition", "i4"))
+	svc.AddStateVariable(stateVariable("AbsoluteCounterPosition", "i4"))
+	svc.AddStateVariable(stateVariable("CurrentTransportActions", "string"))
+	svc.AddStateVariable(stateVariable("A_ARG_TYPE_SeekMode", "string", "TRACK_NR", "ABS_TIME", "REL_TIME"))
+	svc.AddStateVariable(stateVariable("A_ARG_TYPE_SeekTarget", "string"))
+	svc.AddStateVariable(lastChange())
+
+	instanceID := upnp.In("InstanceID", "A_ARG_TYPE_InstanceID")
+
 	var (
-		ErrSeekModeNotSupported = &soap.Error{710, "Seek mode not supported"}
-		ErrIllegalSeekTarget    = &soap.Error{711, "Illegal seek target"}
-		ErrInvalidInstanceID    = &soap.Error{718, "Invalid InstanceID"}
+		ErrSeekModeNotSupported  = &soap.Error{Code: 710, Description: "Seek mode not supported"}
+		ErrIllegalSeekTarget     = &soap.Error{Code: 711, Description: "Illegal seek target"}
+		ErrPlaySpeedNotSupported = &soap.Error{Code: 717, Description: "Play speed not supported"}
+		ErrInvalidInstanceID     = &soap.Error{Code: 718, Description: "Invalid InstanceID"}
 	)
 
-	svc.RegisterAction("SetAVTransportURI", func(req *soap.Request, resp *soap.Response) {
-		if req.Args["InstanceID"] != "0" {
-			resp.Error = ErrInvalidInstanceID
-			return
+	svc.RegisterAction("SetAVTransportURI", []*upnp.SCPDArgument{
+		instanceID,
+		upnp.In("CurrentURI", "AVTransportURI"),
+		upnp.In("CurrentURIMetaData", "AVTransportURIMetaData"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		var args struct {
+			InstanceID         uint32
+			CurrentURI         string
+			CurrentURIMetaData string
 		}
-		if _, ok := req.Args["CurrentURI"]; !ok {
+		if err := req.Bind(&args); err != nil {
 			resp.Error = soap.ErrInvalidArgs
 			return
 		}
+		if args.InstanceID != 0 {
+			resp.Error = ErrInvalidInstanceID
+			return
+		}
 
-		mediaURL, err := url.Parse(req.Args["CurrentURI"])
+		mediaURL, err := url.Parse(args.CurrentURI)
 		if err != nil {
 			log.Println(err)
 
-			resp.Error = soap.ErrInvalidArgs
+			resp.Error = soap.ErrArgValueInvalid
 			return
 		}
 
 		mediaMetadata := make(types.Metadata)
-		if didl, ok := req.Args["CurrentURIMetaData"]; ok && didl != "" {
-			if err := mediaMetadata.UnmarshalText([]byte(didl)); err != nil {
+		if args.CurrentURIMetaData != "" {
+			if err := mediaMetadata.UnmarshalText([]byte(args.CurrentURIMetaData)); err != nil {
 				log.Println("parsing metadata failed:", err)
 			}
 		}
 
-		if err := player.Load(mediaURL, mediaMetadata); err != nil {
-			log.Println(err)
-			resp.Error = soap.ErrActionFailed
+		if err := player.Load(req.Context(), mediaURL, mediaMetadata); err != nil {
+			resp.Error = actionError(err)
 		}
 	})
 
-	svc.RegisterAction("GetMediaInfo", func(req *soap.Request, resp *soap.Response) {
-		if req.Args["InstanceID"] != "0" {
+	svc.RegisterAction("GetMediaInfo", []*upnp.SCPDArgument{
+		instanceID,
+		upnp.Out("NrTracks", "NumberOfTracks"),
+		upnp.Out("MediaDuration", "CurrentMediaDuration"),
+		upnp.Out("CurrentURI", "AVTransportURI"),
+		upnp.Out("CurrentURIMetaData", "AVTransportURIMetaData"),
+		upnp.Out("NextURI", "NextAVTransportURI"),
+		upnp.Out("NextURIMetaData", "NextAVTransportURIMetaData"),
+		upnp.Out("PlayMedium", "PlaybackStorageMedium"),
+		upnp.Out("RecordMedium", "RecordStorageMedium"),
+		upnp.Out("WriteStatus", "RecordMediumWriteStatus"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		if !isInstance(req) {
 			resp.Error = ErrInvalidInstanceID
 			return
 		}
@@ -70,16 +124,21 @@ func AVTransport(player omnicast.MediaPlayer) *upnp.Service {
 			resp.Args["CurrentURI"] = ""
 		}
 
-		resp.Args["CurrentURIMetadata"] = "NOT_IMPLEMENTED"
+		resp.Args["CurrentURIMetaData"] = didlMetadata(player)
 		resp.Args["NextURI"] = "NOT_IMPLEMENTED"
-		resp.Args["NextURIMetadata"] = "NOT_IMPLEMENTED"
+		resp.Args["NextURIMetaData"] = "NOT_IMPLEMENTED"
 		resp.Args["PlayMedium"] = "UNKNOWN"
 		resp.Args["RecordMedium"] = "NOT_IMPLEMENTED"
 		resp.Args["WriteStatus"] = "NOT_IMPLEMENTED"
 	})
 
-	svc.RegisterAction("GetTransportInfo", func(req *soap.Request, resp *soap.Response) {
-		if req.Args["InstanceID"] != "0" {
+	svc.RegisterAction("GetTransportInfo", []*upnp.SCPDArgument{
+		instanceID,
+		upnp.Out("CurrentTransportState", "TransportState"),
+		upnp.Out("CurrentTransportStatus", "TransportStatus"),
+		upnp.Out("CurrentSpeed", "TransportPlaySpeed"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		if !isInstance(req) {
 			resp.Error = ErrInvalidInstanceID
 			return
 		}
@@ -101,8 +160,18 @@ func AVTransport(player omnicast.MediaPlayer) *upnp.Service {
 		resp.Args["CurrentSpeed"] = types.ParseFloat32(player.PlaybackRate()).String()
 	})
 
-	svc.RegisterAction("GetPositionInfo", func(req *soap.Request, resp *soap.Response) {
-		if req.Args["InstanceID"] != "0" {
+	svc.RegisterAction("GetPositionInfo", []*upnp.SCPDArgument{
+		instanceID,
+		upnp.Out("Track", "CurrentTrack"),
+		upnp.Out("TrackDuration", "CurrentTrackDuration"),
+		upnp.Out("TrackMetaData", "CurrentTrackMetaData"),
+		upnp.Out("TrackURI", "CurrentTrackURI"),
+		upnp.Out("RelTime", "RelativeTimePosition"),
+		upnp.Out("AbsTime", "AbsoluteTimePosition"),
+		upnp.Out("RelCount", "RelativeCounterPosition"),
+		upnp.Out("AbsCount", "AbsoluteCounterPosition"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		if !isInstance(req) {
 			resp.Error = ErrInvalidInstanceID
 			return
 		}
@@ -120,7 +189,7 @@ func AVTransport(player omnicast.MediaPlayer) *upnp.Service {
 		}
 
 		resp.Args["TrackDuration"] = types.FormatDuration(player.MediaDuration())
-		resp.Args["TrackMetaData"] = "NOT_IMPLEMENTED"
+		resp.Args["TrackMetaData"] = didlMetadata(player)
 
 		pos := player.PlaybackPosition()
 		resp.Args["RelTime"] = types.FormatDuration(pos)
@@ -129,48 +198,134 @@ func AVTransport(player omnicast.MediaPlayer) *upnp.Service {
 		resp.Args["AbsCount"] = strconv.Itoa(int(pos.Seconds()))
 	})
 
-	svc.RegisterAction("Play", func(req *soap.Request, resp *soap.Response) {
-		if req.Args["InstanceID"] != "0" {
+	svc.RegisterAction("GetCurrentTransportActions", []*upnp.SCPDArgument{
+		instanceID,
+		upnp.Out("Actions", "CurrentTransportActions"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		if !isInstance(req) {
+			resp.Error = ErrInvalidInstanceID
+			return
+		}
+
+		resp.Args["Actions"] = strings.Join(transportActions(player), ",")
+	})
+
+	svc.RegisterAction("GetDeviceCapabilities", []*upnp.SCPDArgument{
+		instanceID,
+		upnp.Out("PlayMedia", "PossiblePlaybackStorageMedia"),
+		upnp.Out("RecMedia", "PossibleRecordStorageMedia"),
+		upnp.Out("RecQualityModes", "PossibleRecordQualityModes"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		if !isInstance(req) {
+			resp.Error = ErrInvalidInstanceID
+			return
+		}
+
+		resp.Args["PlayMedia"] = "NETWORK"
+		resp.Args["RecMedia"] = "NOT_IMPLEMENTED"
+		resp.Args["RecQualityModes"] = "NOT_IMPLEMENTED"
+	})
+
+	svc.RegisterAction("GetTransportSettings", []*upnp.SCPDArgument{
+		instanceID,
+		upnp.Out("PlayMode", "CurrentPlayMode"),
+		upnp.Out("RecQualityMode", "CurrentRecordQualityMode"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		if !isInstance(req) {
+			resp.Error = ErrInvalidInstanceID
+			return
+		}
+
+		resp.Args["PlayMode"] = "NORMAL"
+		resp.Args["RecQualityMode"] = "NOT_IMPLEMENTED"
+	})
+
+	svc.RegisterAction("Play", []*upnp.SCPDArgument{
+		instanceID,
+		upnp.In("Speed", "TransportPlaySpeed"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		var args struct {
+			InstanceID uint32
+			Speed      string
+		}
+		if err := req.Bind(&args); err != nil {
+			resp.Error = soap.ErrInvalidArgs
+			return
+		}
+		if args.InstanceID != 0 {
 			resp.Error = ErrInvalidInstanceID
 			return
 		}
+		if args.Speed != "1" {
+			resp.Error = ErrPlaySpeedNotSupported
+			return
+		}
 
-		player.Play()
+		if err := player.Play(req.Context()); err != nil {
+			resp.Error = actionError(err)
+		}
 	})
 
-	svc.RegisterAction("Pause", func(req *soap.Request, resp *soap.Response) {
-		if req.Args["InstanceID"] != "0" {
+	svc.RegisterAction("Pause", []*upnp.SCPDArgument{instanceID}, func(req *soap.Request, resp *soap.Response) {
+		if !isInstance(req) {
 			resp.Error = ErrInvalidInstanceID
 			return
 		}
+		if !omnicast.CapabilitiesOf(player).Has(omnicast.CanPause) {
+			resp.Error = errTransitionNotAvailable
+			return
+		}
 
-		player.Pause()
+		if err := player.Pause(req.Context()); err != nil {
+			resp.Error = actionError(err)
+		}
 	})
 
-	svc.RegisterAction("Stop", func(req *soap.Request, resp *soap.Response) {
-		if req.Args["InstanceID"] != "0" {
+	svc.RegisterAction("Stop", []*upnp.SCPDArgument{instanceID}, func(req *soap.Request, resp *soap.Response) {
+		if !isInstance(req) {
 			resp.Error = ErrInvalidInstanceID
 			return
 		}
 
-		player.Stop()
+		if err := player.Stop(req.Context()); err != nil {
+			resp.Error = actionError(err)
+		}
 	})
 
-	svc.RegisterAction("Seek", func(req *soap.Request, resp *soap.Response) {
-		if req.Args["InstanceID"] != "0" {
+	svc.RegisterAction("Seek", []*upnp.SCPDArgument{
+		instanceID,
+		upnp.In("Unit", "A_ARG_TYPE_SeekMode"),
+		upnp.In("Target", "A_ARG_TYPE_SeekTarget"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		var args struct {
+			InstanceID uint32
+			Unit       string
+			Target     string
+		}
+		if err := req.Bind(&args); err != nil {
+			resp.Error = soap.ErrInvalidArgs
+			return
+		}
+		if args.InstanceID != 0 {
 			resp.Error = ErrInvalidInstanceID
 			return
 		}
+		if !omnicast.CapabilitiesOf(player).Has(omnicast.CanSeek) {
+			resp.Error = ErrSeekModeNotSupported
+			return
+		}
 
-		switch req.Args["Unit"] {
+		switch args.Unit {
 		case "ABS_TIME", "REL_TIME":
-			pos, err := types.ParseDuration(req.Args["Target"])
+			pos, err := types.ParseDuration(args.Target)
 			if err != nil {
 				resp.Error = ErrIllegalSeekTarget
 				return
 			}
 
-			player.SeekTo(pos)
+			if err := player.SeekTo(req.Context(), pos); err != nil {
+				resp.Error = actionError(err)
+			}
 		default:
 			resp.Error = ErrSeekModeNotSupported
 			return
@@ -179,3 +334,37 @@ func AVTransport(player omnicast.MediaPlayer) *upnp.Service {
 
 	return svc
 }
+
+// didlMetadata returns the metadata of the current media as DIDL-Lite.
+func didlMetadata(player omnicast.MediaPlayerV2) string {
+	md := player.MediaMetadata()
+	if md == nil {
+		return ""
+	}
+
+	data, err := types.NewMetadata(omnicast.DetailsOf(md)).MarshalText()
+	if err != nil {
+		log.Println(err)
+		return "NOT_IMPLEMENTED"
+	}
+
+	return string(data)
+}
+
+// transportActions returns the transport actions currently available.
+func transportActions(player omnicast.MediaPlayerV2) []string {
+	if player.IsIdle() {
+		return []string{}
+	}
+
+	caps := omnicast.CapabilitiesOf(player)
+
+	actions := []string{"Play", "Stop"}
+	if caps.Has(omnicast.CanPause) {
+		actions = append(actions, "Pause")
+	}
+	if caps.Has(omnicast.CanSeek) {
+		actions = append(actions, "Seek")
+	}
+	return actions
+}
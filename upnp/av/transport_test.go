@@ -0,0 +1,74 @@
+package av_test
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/ericyan/omnicast/omnicasttest"
+	"github.com/ericyan/omnicast/upnp/av"
+	"github.com/ericyan/omnicast/upnp/internal/soap"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// golden compares the data with the golden file, or updates the file if
+// the -update flag is set.
+func golden(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("%s mismatch:\n%s\nwant:\n%s", name, data, want)
+	}
+}
+
+// TestOutputOrder checks that output arguments are in the order declared
+// by the actions, rather than sorted by names.
+func TestOutputOrder(t *testing.T) {
+	dev, err := av.NewMediaRenderer("Test Renderer", omnicasttest.NewPlayer("Test Player"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(dev)
+	defer srv.Close()
+
+	for _, name := range []string{"GetMediaInfo", "GetPositionInfo"} {
+		action := &soap.Action{Namespace: "urn:schemas-upnp-org:service:AVTransport:1", Name: name}
+		req, err := soap.NewHTTPRequest(context.Background(), srv.URL+"/services/AVTransport", action, []soap.Arg{
+			{Name: "InstanceID", Value: "0"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: unexpected status: %s", name, resp.Status)
+		}
+		golden(t, name, body)
+	}
+}
@@ -0,0 +1,391 @@
+package upnp
+
+import (
+	"context"
+	"encoding"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ericyan/omnicast/upnp/internal/soap"
+	"github.com/ericyan/omnicast/upnp/internal/ssdp"
+	"github.com/ericyan/omnicast/upnp/internal/types"
+)
+
+// SearchTimeout is the maximum time to wait for devices to respond when
+// discovering devices.
+const SearchTimeout = 3 * time.Second
+
+// An Error is an UPnP error reported by a service.
+type Error = soap.Error
+
+// Errors returned by the control point.
+var (
+	ErrNoSCPD           = errors.New("upnp: service description unavailable")
+	ErrActionNotFound   = errors.New("upnp: action not found")
+	ErrArgumentNotFound = errors.New("upnp: argument not found")
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// A RemoteDevice is a UPnP device on the network, as described by its
+// device description.
+type RemoteDevice struct {
+	Location     *url.URL
+	DeviceType   string
+	UDN          string
+	FriendlyName string
+	Manufacturer string
+	ModelName    string
+
+	Services []*RemoteService
+	Devices  []*RemoteDevice
+}
+
+// A RemoteService is a service of a RemoteDevice, which can be controlled
+// by invoking its actions.
+type RemoteService struct {
+	ServiceType string
+	ServiceID   string
+	ControlURL  *url.URL
+	EventSubURL *url.URL
+	SCPDURL     *url.URL
+
+	// SCPD is the service description, or nil if unavailable. Actions
+	// can still be invoked without it, with arguments in no particular
+	// order.
+	SCPD *SCPD
+}
+
+type deviceDescription struct {
+	DeviceType   string `xml:"deviceType"`
+	UDN          string `xml:"UDN"`
+	FriendlyName string `xml:"friendlyName"`
+	Manufacturer string `xml:"manufacturer"`
+	ModelName    string `xml:"modelName"`
+	Services     []struct {
+		ServiceType string `xml:"serviceType"`
+		ServiceID   string `xml:"serviceId"`
+		ControlURL  string `xml:"controlURL"`
+		EventSubURL string `xml:"eventSubURL"`
+		SCPDURL     string `xml:"SCPDURL"`
+	} `xml:"serviceList>service"`
+	Devices []*deviceDescription `xml:"deviceList>device"`
+}
+
+// get fetches the document at the URL.
+func get(ctx context.Context, u *url.URL, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upnp: GET %s: %s", u, resp.Status)
+	}
+
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
+
+// NewRemoteDevice fetches the device description at the location, along
+// with the descriptions of its services.
+func NewRemoteDevice(ctx context.Context, location *url.URL) (*RemoteDevice, error) {
+	var root struct {
+		URLBase string            `xml:"URLBase"`
+		Device  deviceDescription `xml:"device"`
+	}
+	if err := get(ctx, location, &root); err != nil {
+		return nil, err
+	}
+
+	base := location
+	if root.URLBase != "" {
+		u, err := url.Parse(root.URLBase)
+		if err != nil {
+			return nil, err
+		}
+		base = u
+	}
+
+	return newRemoteDevice(ctx, location, base, &root.Device)
+}
+
+func newRemoteDevice(ctx context.Context, location, base *url.URL, desc *deviceDescription) (*RemoteDevice, error) {
+	dev := &RemoteDevice{
+		Location:     location,
+		DeviceType:   desc.DeviceType,
+		UDN:          desc.UDN,
+		FriendlyName: desc.FriendlyName,
+		Manufacturer: desc.Manufacturer,
+		ModelName:    desc.ModelName,
+	}
+
+	for _, s := range desc.Services {
+		svc := &RemoteService{ServiceType: s.ServiceType, ServiceID: s.ServiceID}
+		for _, ref := range []struct {
+			dst **url.URL
+			src string
+		}{
+			{&svc.ControlURL, s.ControlURL},
+			{&svc.EventSubURL, s.EventSubURL},
+			{&svc.SCPDURL, s.SCPDURL},
+		} {
+			u, err := base.Parse(ref.src)
+			if err != nil {
+				return nil, err
+			}
+			*ref.dst = u
+		}
+
+		scpd := new(SCPD)
+		if err := get(ctx, svc.SCPDURL, scpd); err != nil {
+			log.Printf("upnp: failed to fetch SCPD of %s: %s\n", svc.ServiceType, err)
+		} else {
+			svc.SCPD = scpd
+		}
+
+		dev.Services = append(dev.Services, svc)
+	}
+
+	for _, d := range desc.Devices {
+		embedded, err := newRemoteDevice(ctx, location, base, d)
+		if err != nil {
+			return nil, err
+		}
+
+		dev.Devices = append(dev.Devices, embedded)
+	}
+
+	return dev, nil
+}
+
+// typeName returns the name of a device or service type, such as
+// "AVTransport" for "urn:schemas-upnp-org:service:AVTransport:1".
+func typeName(urn string) string {
+	parts := strings.Split(urn, ":")
+	if len(parts) < 5 || parts[0] != "urn" {
+		return urn
+	}
+
+	return parts[3]
+}
+
+// isType returns true if the URN is of the type, given as either a URN
+// of any version or a type name.
+func isType(urn, t string) bool {
+	if urn == t {
+		return true
+	}
+
+	if strings.HasPrefix(t, "urn:") {
+		return strings.HasPrefix(urn, t[:strings.LastIndexByte(t, ':')+1])
+	}
+
+	return typeName(urn) == t
+}
+
+// Find returns the device, or one of its embedded devices, of the type,
+// which is either a URN of any version or a type name such as
+// "MediaRenderer". It returns nil if not found.
+func (dev *RemoteDevice) Find(deviceType string) *RemoteDevice {
+	if isType(dev.DeviceType, deviceType) {
+		return dev
+	}
+
+	for _, d := range dev.Devices {
+		if found := d.Find(deviceType); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// Service returns the service of the type, which is either a URN of any
+// version or a type name such as "AVTransport". It returns nil if the
+// device does not provide the service.
+func (dev *RemoteDevice) Service(serviceType string) *RemoteService {
+	for _, svc := range dev.Services {
+		if isType(svc.ServiceType, serviceType) {
+			return svc
+		}
+	}
+
+	return nil
+}
+
+// Discover searches the network for devices of the type, given as a URN,
+// on the named interfaces or all multicast-capable ones. Devices are
+// searched for up to SearchTimeout, or until ctx is done.
+func Discover(ctx context.Context, deviceType string, ifaces ...string) ([]*RemoteDevice, error) {
+	searchCtx, cancel := context.WithTimeout(ctx, SearchTimeout)
+	defer cancel()
+
+	results, err := ssdp.Search(searchCtx, deviceType, int(SearchTimeout/time.Second)-1, ifaces...)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []*RemoteDevice
+	seen := make(map[string]bool)
+	for _, r := range results {
+		if seen[r.Location.String()] {
+			continue
+		}
+		seen[r.Location.String()] = true
+
+		root, err := NewRemoteDevice(ctx, r.Location)
+		if err != nil {
+			log.Printf("upnp: failed to fetch description of %s: %s\n", r.USN, err)
+			continue
+		}
+
+		if dev := root.Find(deviceType); dev != nil {
+			devices = append(devices, dev)
+		}
+	}
+
+	return devices, nil
+}
+
+// formatValue returns the string representation of an argument value.
+func formatValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int8, int16, int32, int64:
+		return fmt.Sprintf("%d", v), nil
+	case uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case time.Duration:
+		return types.FormatDuration(v), nil
+	case *url.URL:
+		return v.String(), nil
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		return string(text), err
+	case fmt.Stringer:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("upnp: unsupported argument type %T", v)
+	}
+}
+
+// Call invokes the action of the service with the input arguments, and
+// returns the output arguments. Argument values are converted to strings
+// as UPnP defines, e.g. booleans to "0" or "1", and durations to H:MM:SS.
+//
+// If the service description is available, the action and the arguments
+// are checked against it, and the arguments are sent in its order. UPnP
+// errors reported by the service are returned as *Error.
+func (svc *RemoteService) Call(ctx context.Context, action string, args map[string]interface{}) (Args, error) {
+	var names []string
+	if svc.SCPD != nil {
+		a := svc.SCPD.Action(action)
+		if a == nil {
+			return nil, fmt.Errorf("%w: %s", ErrActionNotFound, action)
+		}
+
+		for _, arg := range a.Arguments {
+			if arg.Direction != "in" {
+				continue
+			}
+
+			if _, ok := args[arg.Name]; !ok {
+				return nil, fmt.Errorf("upnp: missing argument %s of %s", arg.Name, action)
+			}
+			names = append(names, arg.Name)
+		}
+
+		if len(names) != len(args) {
+			for name := range args {
+				if !contains(names, name) {
+					return nil, fmt.Errorf("%w: %s of %s", ErrArgumentNotFound, name, action)
+				}
+			}
+		}
+	} else {
+		for name := range args {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	in := make([]soap.Arg, 0, len(names))
+	for _, name := range names {
+		v, err := formatValue(args[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s of %s: %w", name, action, err)
+		}
+
+		in = append(in, soap.Arg{Name: name, Value: v})
+	}
+
+	out, err := soap.Call(ctx, httpClient, svc.ControlURL.String(), &soap.Action{Namespace: svc.ServiceType, Name: action}, in)
+	if err != nil {
+		return nil, err
+	}
+
+	return Args(out), nil
+}
+
+func contains(s []string, v string) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Args are the output arguments of an action, with methods to convert
+// them from their string representations.
+type Args map[string]string
+
+// Int returns the argument as an integer.
+func (args Args) Int(name string) (int, error) {
+	return strconv.Atoi(args[name])
+}
+
+// Bool returns the argument as a boolean, which may be represented as
+// "0", "1", "false", "true", "no" or "yes".
+func (args Args) Bool(name string) (bool, error) {
+	switch strings.ToLower(args[name]) {
+	case "1", "true", "yes":
+		return true, nil
+	case "0", "false", "no":
+		return false, nil
+	default:
+		return false, fmt.Errorf("upnp: invalid boolean %s: %q", name, args[name])
+	}
+}
+
+// Duration returns the argument as a duration in H+:MM:SS format.
+func (args Args) Duration(name string) (time.Duration, error) {
+	return types.ParseDuration(args[name])
+}
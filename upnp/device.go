@@ -2,37 +2,76 @@ package upnp
 
 import (
 	"crypto/md5"
-	"encoding/hex"
+	"encoding/xml"
+	"hash/fnv"
 	"io"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
-	"github.com/rakyll/statik/fs"
+	"github.com/google/uuid"
 
-	_ "github.com/ericyan/omnicast/upnp/internal/scpd"
+	"github.com/ericyan/omnicast/metrics"
 	"github.com/ericyan/omnicast/upnp/internal/soap"
 )
 
+var (
+	soapActions = metrics.NewCounter(
+		"omnicast_upnp_soap_actions_total",
+		"SOAP actions handled, by action name and UPnP error code, or ok.",
+		"action", "code",
+	)
+	soapDuration = metrics.NewHistogram(
+		"omnicast_upnp_soap_action_duration_seconds",
+		"Time taken to handle SOAP actions, by action name and UPnP error code, or ok.",
+		metrics.DefBuckets, "action", "code",
+	)
+)
+
 type Device struct {
 	Name    string
 	Type    string
 	Version uint
 
-	uuid     [16]byte
+	// UUID identifies the device in its UDN. It is derived from the name
+	// and type by default, and thus changes when the device is renamed.
+	// Set it to a persisted one, e.g. from LoadUUID, or one derived from
+	// the bridged device with DeriveUUID, to keep the identity.
+	UUID uuid.UUID
+
+	// Fields of the device description. Empty optional ones are omitted.
+	Manufacturer     string
+	ManufacturerURL  string
+	ModelName        string
+	ModelDescription string
+	ModelNumber      string
+	ModelURL         string
+	SerialNumber     string
+	PresentationURL  string
+	Icons            []*Icon
+
 	services map[string]*Service
+	handlers map[string]http.Handler
 }
 
 func NewDevice(name, deviceType string, ver uint) *Device {
 	return &Device{
-		Name:     name,
-		Type:     deviceType,
-		Version:  ver,
-		uuid:     md5.Sum([]byte(name + deviceType)),
-		services: make(map[string]*Service),
+		Name:             name,
+		Type:             deviceType,
+		Version:          ver,
+		UUID:             uuid.UUID(md5.Sum([]byte(name + deviceType))),
+		Manufacturer:     "Eric Yan",
+		ManufacturerURL:  "https://ericyan.me/",
+		ModelName:        "Omnicast",
+		ModelDescription: "DLNA media renderer written in Go",
+		ModelNumber:      "0.1",
+		ModelURL:         "http://github.com/ericyan/omnicast",
+		services:         make(map[string]*Service),
+		handlers:         make(map[string]http.Handler),
 	}
 }
 
@@ -42,20 +81,30 @@ func (dev *Device) RegisterService(svc *Service) {
 	}
 }
 
-func (dev *Device) UDN() string {
-	var buf [5 + 36]byte
-	copy(buf[:], "uuid:")
-	hex.Encode(buf[5:], dev.uuid[:4])
-	buf[13] = '-'
-	hex.Encode(buf[14:18], dev.uuid[4:6])
-	buf[18] = '-'
-	hex.Encode(buf[19:23], dev.uuid[6:8])
-	buf[23] = '-'
-	hex.Encode(buf[24:28], dev.uuid[8:10])
-	buf[28] = '-'
-	hex.Encode(buf[29:], dev.uuid[10:])
+// Handle registers the handler for paths with the prefix, which is served
+// along with the device, e.g. a web interface linked by PresentationURL.
+// The handler with the longest matching prefix is used.
+func (dev *Device) Handle(prefix string, handler http.Handler) {
+	dev.handlers[prefix] = handler
+}
+
+// handler returns the handler registered for the path, or nil if none.
+func (dev *Device) handler(path string) http.Handler {
+	var prefix string
+	for p := range dev.handlers {
+		if strings.HasPrefix(path, p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	if prefix == "" {
+		return nil
+	}
 
-	return string(buf[:])
+	return dev.handlers[prefix]
+}
+
+func (dev *Device) UDN() string {
+	return "uuid:" + dev.UUID.String()
 }
 
 func (dev *Device) URN() string {
@@ -82,6 +131,16 @@ func (dev *Device) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if strings.HasPrefix(r.URL.Path, "/icons/") {
+		dev.serveIcon(w, r)
+		return
+	}
+
+	if h := dev.handler(r.URL.Path); h != nil && !strings.HasPrefix(r.URL.Path, "/services/") {
+		h.ServeHTTP(w, r)
+		return
+	}
+
 	if strings.HasPrefix(r.URL.Path, "/services/") {
 		st := r.URL.Path[len("/services/"):len(r.URL.Path)]
 
@@ -95,35 +154,30 @@ func (dev *Device) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			log.Printf("[DEBUG] %s %s from %s\n", r.Method, r.URL.Path, r.RemoteAddr)
 
-			scpd, err := fs.New()
-			if err != nil {
-				log.Println(err)
-				http.NotFound(w, r)
-				return
-			}
-
-			filename := "/" + st + ".xml"
-			f, err := scpd.Open(filename)
-			if err != nil {
+			w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+			if err := svc.writeSCPD(w); err != nil {
 				log.Println(err)
-				http.NotFound(w, r)
-				return
 			}
-
-			http.ServeContent(w, r, filename, time.Time{}, f)
 			return
 		}
 
-		if r.Method == http.MethodPost {
+		if r.Method == http.MethodPost || r.Method == "M-POST" {
+			start := time.Now()
+			var resp *soap.Response
+
 			req, err := soap.ParseHTTPRequest(r)
 			if err != nil {
 				log.Println(err)
-				return
-			}
 
-			log.Printf("[DEBUG] %s %v from %s\n", req.Action.Name, req.Args, r.RemoteAddr)
+				resp = &soap.Response{Error: soap.ErrInvalidAction}
+			} else {
+				log.Printf("[DEBUG] %s %v from %s\n", req.Action.Name, req.Args, r.RemoteAddr)
 
-			err = svc.HandleRequest(req).WriteTo(w)
+				resp = svc.HandleRequest(req)
+			}
+			observeAction(req, resp, time.Since(start))
+
+			err = resp.WriteHTTP(w)
 			if err != nil {
 				log.Println(err)
 				return
@@ -135,8 +189,25 @@ func (dev *Device) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	http.NotFound(w, r)
 }
 
+// observeAction records the SOAP action in the metrics. Undeclared and
+// malformed actions are recorded without names, since they are arbitrary.
+func observeAction(req *soap.Request, resp *soap.Response, d time.Duration) {
+	var action string
+	if req != nil && resp.Error != soap.ErrInvalidAction {
+		action = req.Action.Name
+	}
+
+	code := "ok"
+	if resp.Error != nil {
+		code = strconv.Itoa(resp.Error.Code)
+	}
+
+	soapActions.Inc(action, code)
+	soapDuration.Observe(d.Seconds(), action, code)
+}
+
 const deviceTemplate = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
-<root xmlns="urn:schemas-upnp-org:device-1-0">
+<root xmlns="urn:schemas-upnp-org:device-1-0"{{with .ConfigID}} configId="{{.}}"{{end}}>
   <specVersion>
     <major>1</major>
     <minor>0</minor>
@@ -144,14 +215,38 @@ const deviceTemplate = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
   <device>
     <deviceType>{{.URN}}</deviceType>
     <UDN>{{.UDN}}</UDN>
-    <friendlyName>{{.Name}}</friendlyName>
-    <manufacturer>Eric Yan</manufacturer>
-    <manufacturerURL>https://ericyan.me/</manufacturerURL>
-    <modelName>Omnicast</modelName>
-    <modelDescription>DLNA media renderer written in Go</modelDescription>
-    <modelNumber>0.1</modelNumber>
-    <modelURL>http://github.com/ericyan/omnicast</modelURL>
+    <friendlyName>{{escape .Name}}</friendlyName>
+    <manufacturer>{{escape .Manufacturer}}</manufacturer>
+    {{- with .ManufacturerURL}}
+    <manufacturerURL>{{escape .}}</manufacturerURL>
+    {{- end}}
+    {{- with .ModelDescription}}
+    <modelDescription>{{escape .}}</modelDescription>
+    {{- end}}
+    <modelName>{{escape .ModelName}}</modelName>
+    {{- with .ModelNumber}}
+    <modelNumber>{{escape .}}</modelNumber>
+    {{- end}}
+    {{- with .ModelURL}}
+    <modelURL>{{escape .}}</modelURL>
+    {{- end}}
+    {{- with .SerialNumber}}
+    <serialNumber>{{escape .}}</serialNumber>
+    {{- end}}
     <dlna:X_DLNADOC xmlns:dlna="urn:schemas-dlna-org:device-1-0">DMR-1.50</dlna:X_DLNADOC>
+    {{- with .IconList}}
+    <iconList>
+    {{- range .}}
+      <icon>
+        <mimetype>{{.MIMEType}}</mimetype>
+        <width>{{.Width}}</width>
+        <height>{{.Height}}</height>
+        <depth>{{.Depth}}</depth>
+        <url>{{.URL}}</url>
+      </icon>
+    {{- end}}
+    </iconList>
+    {{- end}}
     <serviceList>
     {{- range $path, $svc := .Services }}
       <service>
@@ -163,26 +258,83 @@ const deviceTemplate = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
       </service>
     {{- end}}
     </serviceList>
+    {{- with .PresentationURL}}
+    <presentationURL>{{escape .}}</presentationURL>
+    {{- end}}
   </device>
 </root>`
 
+var deviceTpl = template.Must(template.New("device").Funcs(template.FuncMap{
+	"escape": func(s string) string {
+		b := new(strings.Builder)
+		xml.EscapeText(b, []byte(s))
+		return b.String()
+	},
+}).Parse(deviceTemplate))
+
+// description is the device description, with its CONFIGID.
+type description struct {
+	*Device
+
+	ConfigID int
+}
+
+// iconEntry is an icon in the description, with the URL serving it.
+type iconEntry struct {
+	*Icon
+
+	URL string
+}
+
+// IconList returns the icons with their URLs.
+func (d description) IconList() []iconEntry {
+	icons := make([]iconEntry, len(d.Icons))
+	for i, icon := range d.Icons {
+		icons[i] = iconEntry{icon, icon.path(i)}
+	}
+
+	return icons
+}
+
 func (dev *Device) writeDevice(w io.Writer) error {
-	tpl := template.Must(template.New("device").Parse(deviceTemplate))
+	return deviceTpl.Execute(w, description{dev, dev.ConfigID()})
+}
 
-	return tpl.Execute(w, dev)
+// ConfigID returns the CONFIGID of the device description, which is the
+// hash of the descriptions of the device and its services, so that it
+// changes along with them. It is in the range of [0, 16777215] as
+// required.
+func (dev *Device) ConfigID() int {
+	h := fnv.New32a()
+	deviceTpl.Execute(h, description{dev, 0})
+
+	paths := make([]string, 0, len(dev.services))
+	for path := range dev.services {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		dev.services[path].writeSCPD(h)
+	}
+
+	return int(h.Sum32() & 0xffffff)
 }
 
 type Service struct {
 	Type    string
 	Version uint
 
+	scpd    *SCPD
 	actions map[string]func(*soap.Request, *soap.Response)
 }
 
+// NewService returns a new service of the type, without any actions or
+// state variables declared.
 func NewService(serviceType string, ver uint) *Service {
 	return &Service{
 		Type:    serviceType,
 		Version: ver,
+		scpd:    &SCPD{SpecVersion: SpecVersion{1, 0}},
 		actions: make(map[string]func(*soap.Request, *soap.Response)),
 	}
 }
@@ -191,21 +343,101 @@ func (svc *Service) URN() string {
 	return "urn:schemas-upnp-org:service:" + svc.Type + ":" + strconv.Itoa(int(svc.Version))
 }
 
-func (svc *Service) RegisterAction(name string, handler func(*soap.Request, *soap.Response)) {
+// SCPD returns the service description, which consists of the declared
+// state variables and the registered actions.
+func (svc *Service) SCPD() *SCPD {
+	return svc.scpd
+}
+
+// AddStateVariable declares the state variable, replacing the one of the
+// same name if any. State variables must be declared before the actions
+// with arguments related to them.
+func (svc *Service) AddStateVariable(v *StateVariable) {
+	for i, sv := range svc.scpd.StateVariables {
+		if sv.Name == v.Name {
+			svc.scpd.StateVariables[i] = v
+			return
+		}
+	}
+
+	svc.scpd.StateVariables = append(svc.scpd.StateVariables, v)
+}
+
+// In returns an input argument, whose type is that of the state variable.
+func In(name, stateVariable string) *SCPDArgument {
+	return &SCPDArgument{name, "in", stateVariable}
+}
+
+// Out returns an output argument, whose type is that of the state
+// variable.
+func Out(name, stateVariable string) *SCPDArgument {
+	return &SCPDArgument{name, "out", stateVariable}
+}
+
+// RegisterAction declares the action with its arguments, and registers
+// the handler for it, so that only actions implemented are advertised.
+// It panics if an argument relates to an undeclared state variable.
+func (svc *Service) RegisterAction(name string, args []*SCPDArgument, handler func(*soap.Request, *soap.Response)) {
+	for _, arg := range args {
+		if svc.scpd.StateVariable(arg.RelatedStateVariable) == nil {
+			panic("upnp: " + name + " argument " + arg.Name + " relates to undeclared state variable " + arg.RelatedStateVariable)
+		}
+	}
+
 	svc.actions[name] = handler
+
+	action := &SCPDAction{name, args}
+	for i, a := range svc.scpd.Actions {
+		if a.Name == name {
+			svc.scpd.Actions[i] = action
+			return
+		}
+	}
+	svc.scpd.Actions = append(svc.scpd.Actions, action)
+}
+
+// writeSCPD writes the service description in XML.
+func (svc *Service) writeSCPD(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(svc.scpd); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
 }
 
+// HandleRequest validates the request against the service description,
+// and calls the handler of the action.
 func (svc *Service) HandleRequest(req *soap.Request) *soap.Response {
 	resp := new(soap.Response)
 	resp.Action = req.Action
 	resp.Args = make(map[string]string)
 
-	handler, ok := svc.actions[req.Action.Name]
-	if !ok {
-		resp.Error = soap.ErrActionNotImplemented
+	action := svc.scpd.Action(req.Action.Name)
+	if action == nil {
+		resp.Error = soap.ErrInvalidAction
 		return resp
 	}
 
-	handler(req, resp)
+	values, err := svc.scpd.validate(action, req.Args)
+	if err != nil {
+		resp.Error = err
+		return resp
+	}
+	req.Values = values
+
+	for _, arg := range action.Arguments {
+		if arg.Direction == "out" {
+			resp.Order = append(resp.Order, arg.Name)
+		}
+	}
+
+	svc.actions[req.Action.Name](req, resp)
 	return resp
 }
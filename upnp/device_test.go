@@ -0,0 +1,350 @@
+package upnp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/ericyan/omnicast/metrics"
+	"github.com/ericyan/omnicast/upnp"
+	"github.com/ericyan/omnicast/upnp/internal/soap"
+)
+
+func newSwitchPower() *upnp.Service {
+	svc := upnp.NewService("SwitchPower", 1)
+	svc.AddStateVariable(&upnp.StateVariable{Name: "Target", SendEvents: "no", DataType: "boolean"})
+	svc.AddStateVariable(&upnp.StateVariable{Name: "Status", SendEvents: "yes", DataType: "boolean"})
+
+	var status bool
+	svc.RegisterAction("SetTarget", []*upnp.SCPDArgument{
+		upnp.In("newTargetValue", "Target"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		var args struct {
+			Value bool `soap:"newTargetValue"`
+		}
+		if err := req.Bind(&args); err != nil {
+			resp.Error = soap.ErrInvalidArgs
+			return
+		}
+
+		status = args.Value
+	})
+	svc.RegisterAction("GetStatus", []*upnp.SCPDArgument{
+		upnp.Out("ResultStatus", "Status"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		if status {
+			resp.Args["ResultStatus"] = "1"
+		} else {
+			resp.Args["ResultStatus"] = "0"
+		}
+	})
+
+	return svc
+}
+
+func TestCustomService(t *testing.T) {
+	dev := upnp.NewDevice("Test Light", "BinaryLight", 1)
+	dev.RegisterService(newSwitchPower())
+
+	srv := httptest.NewServer(dev)
+	defer srv.Close()
+
+	loc, _ := url.Parse(srv.URL + "/")
+	rdev, err := upnp.NewRemoteDevice(context.Background(), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := rdev.Service("SwitchPower")
+	if svc == nil || svc.SCPD == nil {
+		t.Fatalf("Missing SwitchPower service: %+v", rdev.Services)
+	}
+	if len(svc.SCPD.Actions) != 2 || svc.SCPD.SpecVersion.Major != 1 {
+		t.Errorf("Unexpected SCPD: %+v", svc.SCPD)
+	}
+	if v := svc.SCPD.StateVariable("Status"); v == nil || v.DataType != "boolean" || v.SendEvents != "yes" {
+		t.Errorf("Unexpected state variable: %+v", v)
+	}
+
+	ctx := context.Background()
+	if _, err := svc.Call(ctx, "SetTarget", map[string]interface{}{"newTargetValue": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := svc.Call(ctx, "GetStatus", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if on, err := out.Bool("ResultStatus"); err != nil || !on {
+		t.Errorf("Unexpected status: %v", out)
+	}
+}
+
+func TestActionMetrics(t *testing.T) {
+	dev := upnp.NewDevice("Test Light", "BinaryLight", 1)
+	dev.RegisterService(newSwitchPower())
+
+	srv := httptest.NewServer(dev)
+	defer srv.Close()
+
+	call := func(name string, args ...soap.Arg) {
+		action := &soap.Action{Namespace: "urn:schemas-upnp-org:service:SwitchPower:1", Name: name}
+		soap.Call(context.Background(), nil, srv.URL+"/services/SwitchPower", action, args)
+	}
+	call("GetStatus")
+	call("SetTarget", soap.Arg{Name: "newTargetValue", Value: "maybe"})
+	call("Explode")
+
+	buf := new(bytes.Buffer)
+	metrics.WriteTo(buf)
+	for _, s := range []string{
+		`omnicast_upnp_soap_actions_total{action="GetStatus",code="ok"}`,
+		`omnicast_upnp_soap_actions_total{action="SetTarget",code="402"}`,
+		`omnicast_upnp_soap_actions_total{action="",code="401"}`,
+		`omnicast_upnp_soap_action_duration_seconds_count{action="GetStatus",code="ok"}`,
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("Missing metric %s", s)
+		}
+	}
+}
+
+func TestValidateInt(t *testing.T) {
+	svc := upnp.NewService("Counter", 1)
+	svc.AddStateVariable(&upnp.StateVariable{Name: "Offset", SendEvents: "no", DataType: "int"})
+
+	var offset interface{}
+	svc.RegisterAction("SetOffset", []*upnp.SCPDArgument{
+		upnp.In("NewOffset", "Offset"),
+	}, func(req *soap.Request, resp *soap.Response) {
+		offset = req.Values["NewOffset"]
+	})
+
+	dev := upnp.NewDevice("Test Counter", "Counter", 1)
+	dev.RegisterService(svc)
+
+	srv := httptest.NewServer(dev)
+	defer srv.Close()
+
+	action := &soap.Action{Namespace: "urn:schemas-upnp-org:service:Counter:1", Name: "SetOffset"}
+	for value, code := range map[string]int{
+		"2147483647":  0,
+		"-2147483648": 0,
+		"2147483648":  402,
+		"-2147483649": 402,
+		"one":         402,
+	} {
+		offset = nil
+		_, err := soap.Call(context.Background(), nil, srv.URL+"/services/Counter", action, []soap.Arg{{Name: "NewOffset", Value: value}})
+		if code == 0 {
+			if _, ok := offset.(int32); err != nil || !ok {
+				t.Errorf("%s: unexpected value %#v (%v)", value, offset, err)
+			}
+			continue
+		}
+
+		if uerr, ok := err.(*soap.Error); !ok || uerr.Code != code {
+			t.Errorf("%s: unexpected error: %v; want %d", value, err, code)
+		}
+	}
+}
+
+func TestConfigID(t *testing.T) {
+	dev := upnp.NewDevice("Test Light", "BinaryLight", 1)
+	dev.RegisterService(newSwitchPower())
+
+	id := dev.ConfigID()
+	if id < 0 || id > 0xffffff {
+		t.Errorf("CONFIGID out of range: %d", id)
+	}
+
+	svc := dev.Services()["SwitchPower"]
+	svc.RegisterAction("GetTarget", []*upnp.SCPDArgument{
+		upnp.Out("RetTargetValue", "Target"),
+	}, func(req *soap.Request, resp *soap.Response) {})
+	if dev.ConfigID() == id {
+		t.Error("CONFIGID unchanged after declaring an action")
+	}
+}
+
+func TestRegisterActionUndeclared(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expect panic for undeclared state variable")
+		}
+	}()
+
+	svc := upnp.NewService("SwitchPower", 1)
+	svc.RegisterAction("GetStatus", []*upnp.SCPDArgument{
+		upnp.Out("ResultStatus", "Status"),
+	}, func(req *soap.Request, resp *soap.Response) {})
+}
+
+func TestHandle(t *testing.T) {
+	dev := upnp.NewDevice("Test Light", "BinaryLight", 1)
+	dev.RegisterService(newSwitchPower())
+	dev.Handle("/ui/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ui"))
+	}))
+	dev.Handle("/ui/api/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("api"))
+	}))
+	dev.Handle("/services/", http.NotFoundHandler())
+
+	srv := httptest.NewServer(dev)
+	defer srv.Close()
+
+	for path, want := range map[string]string{
+		"/ui/":            "ui",
+		"/ui/players":     "ui",
+		"/ui/api/players": "api",
+	} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if got := string(body); got != want {
+			t.Errorf("GET %s: got %q, want %q", path, got, want)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/services/SwitchPower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Services should not be overridden, got %s", resp.Status)
+	}
+}
+
+func TestDescription(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewNRGBA(image.Rect(0, 0, 48, 32))); err != nil {
+		t.Fatal(err)
+	}
+	icon, err := upnp.NewIcon(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if icon.MIMEType != "image/png" || icon.Width != 48 || icon.Height != 32 || icon.Depth != 32 {
+		t.Errorf("Unexpected icon: %+v", icon)
+	}
+	if _, err := upnp.NewIcon([]byte("GIF89a")); err != upnp.ErrUnsupportedIcon {
+		t.Errorf("Unexpected error for GIF: %v", err)
+	}
+
+	dev := upnp.NewDevice("Tom & Jerry", "BinaryLight", 1)
+	dev.UUID = uuid.MustParse("2fac1234-31f8-11b4-a222-08002b34c003")
+	dev.Manufacturer = "ACME"
+	dev.ModelDescription = ""
+	dev.SerialNumber = "SN-42"
+	dev.PresentationURL = "/ui/"
+	dev.Icons = []*upnp.Icon{icon}
+
+	srv := httptest.NewServer(dev)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var desc struct {
+		Device struct {
+			UDN              string  `xml:"UDN"`
+			FriendlyName     string  `xml:"friendlyName"`
+			Manufacturer     string  `xml:"manufacturer"`
+			ModelDescription *string `xml:"modelDescription"`
+			SerialNumber     string  `xml:"serialNumber"`
+			PresentationURL  string  `xml:"presentationURL"`
+			Icons            []struct {
+				MIMEType string `xml:"mimetype"`
+				Width    int    `xml:"width"`
+				URL      string `xml:"url"`
+			} `xml:"iconList>icon"`
+		} `xml:"device"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&desc); err != nil {
+		t.Fatal(err)
+	}
+
+	d := desc.Device
+	if d.UDN != "uuid:2fac1234-31f8-11b4-a222-08002b34c003" || d.FriendlyName != "Tom & Jerry" || d.Manufacturer != "ACME" {
+		t.Errorf("Unexpected description: %+v", d)
+	}
+	if d.ModelDescription != nil || d.SerialNumber != "SN-42" || d.PresentationURL != "/ui/" {
+		t.Errorf("Unexpected description: %+v", d)
+	}
+	if len(d.Icons) != 1 || d.Icons[0].MIMEType != "image/png" || d.Icons[0].Width != 48 {
+		t.Fatalf("Unexpected icons: %+v", d.Icons)
+	}
+
+	resp, err = http.Get(srv.URL + d.Icons[0].URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "image/png" || !bytes.Equal(data, icon.Data) {
+		t.Errorf("Unexpected icon served: %s %d bytes", resp.Header.Get("Content-Type"), len(data))
+	}
+
+	for _, path := range []string{"/icons/1.png", "/icons/0.jpg", "/icons/x"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: unexpected status: %s", path, resp.Status)
+		}
+	}
+}
+
+func TestLoadUUID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upnp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "uuid")
+	id, err := upnp.LoadUUID(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := upnp.LoadUUID(filename)
+	if err != nil || again != id {
+		t.Errorf("Unexpected UUID reloaded: %s; want %s (%v)", again, id, err)
+	}
+}
+
+func TestDeriveUUID(t *testing.T) {
+	cast := uuid.MustParse("8c7a2f3e-5b4d-4e1a-9f0c-1d2e3f405162")
+
+	id := upnp.DeriveUUID(cast, "urn:schemas-upnp-org:device:MediaRenderer:1")
+	if id == cast || id != upnp.DeriveUUID(cast, "urn:schemas-upnp-org:device:MediaRenderer:1") {
+		t.Errorf("Unexpected UUID derived: %s", id)
+	}
+	if id == upnp.DeriveUUID(cast, "urn:schemas-upnp-org:device:MediaServer:1") {
+		t.Error("Same UUID derived for different device types")
+	}
+}
@@ -0,0 +1,250 @@
+package upnp
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SubscriptionTimeout is the duration of event subscriptions requested,
+// which are renewed halfway through.
+const SubscriptionTimeout = 30 * time.Minute
+
+// ErrNotEvented is returned when subscribing to a service without events.
+var ErrNotEvented = errors.New("upnp: service not evented")
+
+// A subscription is a GENA subscription to the events of a service.
+type subscription struct {
+	svc      *RemoteService
+	callback string
+
+	mu      sync.Mutex
+	sid     string
+	timeout time.Duration
+}
+
+// subscribe sends a SUBSCRIBE request, either for a new subscription or
+// to renew the current one.
+func (sub *subscription) subscribe(ctx context.Context, renew bool) error {
+	req, err := http.NewRequest("SUBSCRIBE", sub.svc.EventSubURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	sub.mu.Lock()
+	if renew {
+		req.Header.Set("SID", sub.sid)
+	} else {
+		req.Header.Set("CALLBACK", "<"+sub.callback+">")
+		req.Header.Set("NT", "upnp:event")
+	}
+	sub.mu.Unlock()
+	req.Header.Set("TIMEOUT", "Second-"+strconv.Itoa(int(SubscriptionTimeout/time.Second)))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upnp: SUBSCRIBE %s: %s", sub.svc.EventSubURL, resp.Status)
+	}
+
+	sid := resp.Header.Get("SID")
+	if sid == "" {
+		return errors.New("upnp: SUBSCRIBE without SID")
+	}
+
+	// Subscriptions without a timeout given are assumed to last as long
+	// as requested.
+	timeout := SubscriptionTimeout
+	if s := strings.TrimPrefix(resp.Header.Get("TIMEOUT"), "Second-"); s != "" {
+		if secs, err := strconv.Atoi(s); err == nil && secs > 0 {
+			timeout = time.Duration(secs) * time.Second
+		}
+	}
+
+	sub.mu.Lock()
+	sub.sid, sub.timeout = sid, timeout
+	sub.mu.Unlock()
+
+	return nil
+}
+
+// unsubscribe cancels the subscription.
+func (sub *subscription) unsubscribe(ctx context.Context) error {
+	req, err := http.NewRequest("UNSUBSCRIBE", sub.svc.EventSubURL.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	sub.mu.Lock()
+	req.Header.Set("SID", sub.sid)
+	sub.mu.Unlock()
+
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// isCurrent returns true if the SID is of the subscription. Events may
+// arrive before the SID is known, as the initial event is sent right
+// after accepting the subscription.
+func (sub *subscription) isCurrent(sid string) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	return sub.sid == "" || sub.sid == sid
+}
+
+// renewDelay returns the delay until the subscription is to be renewed.
+func (sub *subscription) renewDelay() time.Duration {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	return sub.timeout / 2
+}
+
+// parsePropertySet returns the state variables in the event message.
+func parsePropertySet(r *http.Request) (map[string]string, error) {
+	var v struct {
+		Properties []struct {
+			Vars []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"property"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&v); err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string)
+	for _, p := range v.Properties {
+		for _, sv := range p.Vars {
+			vars[sv.XMLName.Local] = sv.Value
+		}
+	}
+
+	return vars, nil
+}
+
+// localAddr returns the local address used to reach the host of the URL.
+func localAddr(host string) (net.IP, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "80")
+	}
+
+	// No packet is sent by dialing UDP, which just picks the route.
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// Subscribe subscribes to the events of the service. The evented state
+// variables are delivered on the returned channel, starting with all of
+// them in the initial event. The subscription is renewed until ctx is
+// done, when it is cancelled and the channel is closed.
+//
+// Events are received by an HTTP server listening on the local address
+// reachable by the device.
+func (svc *RemoteService) Subscribe(ctx context.Context) (<-chan map[string]string, error) {
+	if svc.EventSubURL == nil || svc.EventSubURL.Path == "" {
+		return nil, ErrNotEvented
+	}
+
+	ip, err := localAddr(svc.EventSubURL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &subscription{
+		svc:      svc,
+		callback: "http://" + ln.Addr().String() + "/",
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	ch := make(chan map[string]string, 16)
+	hs := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "NOTIFY" || r.Header.Get("NT") != "upnp:event" || r.Header.Get("NTS") != "upnp:propchange" {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			if !sub.isCurrent(r.Header.Get("SID")) {
+				http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+				return
+			}
+
+			vars, err := parsePropertySet(r)
+			if err != nil {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+
+			select {
+			case ch <- vars:
+			case <-ctx.Done():
+			}
+		}),
+	}
+	go hs.Serve(ln)
+
+	if err := sub.subscribe(ctx, false); err != nil {
+		cancel()
+		hs.Close()
+		return nil, err
+	}
+
+	go func() {
+		defer close(ch)
+
+		for {
+			select {
+			case <-time.After(sub.renewDelay()):
+				if err := sub.subscribe(ctx, true); err != nil {
+					log.Printf("upnp: failed to renew subscription to %s: %s\n", svc.ServiceType, err)
+
+					// The subscription may have expired, e.g. after the
+					// device restarted.
+					if err := sub.subscribe(ctx, false); err != nil {
+						log.Printf("upnp: failed to subscribe to %s: %s\n", svc.ServiceType, err)
+					}
+				}
+			case <-ctx.Done():
+				shutdownCtx, done := context.WithTimeout(context.Background(), 5*time.Second)
+				defer done()
+
+				sub.unsubscribe(shutdownCtx)
+				hs.Shutdown(shutdownCtx)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
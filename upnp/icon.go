@@ -0,0 +1,102 @@
+package upnp
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/jpeg" // register JPEG for image.DecodeConfig
+	_ "image/png"  // register PNG for image.DecodeConfig
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedIcon is returned for icons other than PNG or JPEG.
+var ErrUnsupportedIcon = errors.New("upnp: icon must be PNG or JPEG")
+
+// An Icon is an image depicting the device in the user interface of
+// control points, which is served by the device.
+type Icon struct {
+	MIMEType string
+	Width    int
+	Height   int
+	Depth    int
+	Data     []byte
+}
+
+// NewIcon returns an Icon of the PNG or JPEG image.
+func NewIcon(data []byte) (*Icon, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedIcon
+	}
+
+	icon := &Icon{
+		Width:  cfg.Width,
+		Height: cfg.Height,
+		Depth:  24,
+		Data:   data,
+	}
+
+	switch format {
+	case "png":
+		icon.MIMEType = "image/png"
+	case "jpeg":
+		icon.MIMEType = "image/jpeg"
+	default:
+		return nil, ErrUnsupportedIcon
+	}
+
+	switch cfg.ColorModel {
+	case color.RGBAModel, color.NRGBAModel, color.RGBA64Model, color.NRGBA64Model:
+		icon.Depth = 32
+	case color.GrayModel:
+		icon.Depth = 8
+	}
+	if _, ok := cfg.ColorModel.(color.Palette); ok {
+		icon.Depth = 8
+	}
+
+	return icon, nil
+}
+
+// LoadIcon reads the PNG or JPEG image file as an Icon.
+func LoadIcon(filename string) (*Icon, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewIcon(data)
+}
+
+// path returns the path the icon is served at, given its index.
+func (icon *Icon) path(i int) string {
+	ext := ".png"
+	if icon.MIMEType == "image/jpeg" {
+		ext = ".jpg"
+	}
+
+	return "/icons/" + strconv.Itoa(i) + ext
+}
+
+// serveIcon serves the icon at the path.
+func (dev *Device) serveIcon(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/icons/")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[:i]
+	}
+
+	i, err := strconv.Atoi(name)
+	if err != nil || i < 0 || i >= len(dev.Icons) || dev.Icons[i].path(i) != r.URL.Path {
+		http.NotFound(w, r)
+		return
+	}
+
+	icon := dev.Icons[i]
+	w.Header().Set("Content-Type", icon.MIMEType)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(icon.Data))
+}
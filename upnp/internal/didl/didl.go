@@ -7,6 +7,7 @@ import (
 // String represents a string value
 type String struct {
 	XMLName xml.Name
+	Role    string `xml:"role,attr,omitempty"`
 	Value   string `xml:",chardata"`
 }
 
@@ -0,0 +1,157 @@
+package soap
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrNotStruct is returned when binding into a value other than a
+// pointer to struct.
+var ErrNotStruct = errors.New("soap: bind target must be a pointer to struct")
+
+// Bind stores the arguments of the request in the struct pointed to by v.
+// Each exported field is bound to the argument of the same name, or the
+// one given in its "soap" tag. A tag of "-" skips the field, and fields
+// without an argument are left as is.
+//
+// Typed values in Values are converted to the field type if possible.
+// Otherwise the raw value in Args is parsed according to the field type,
+// or passed to its UnmarshalText method.
+func (req *Request) Bind(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return ErrNotStruct
+	}
+	rv = rv.Elem()
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("soap"); ok {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+
+		raw, ok := req.Args[name]
+		if !ok {
+			continue
+		}
+
+		if err := bindValue(rv.Field(i), req.Values[name], raw); err != nil {
+			return fmt.Errorf("soap: binding %s: %s: %w", name, err, ErrInvalidArgs)
+		}
+	}
+
+	return nil
+}
+
+// bindValue sets the field to the typed value if convertible without loss,
+// or to the raw value parsed otherwise.
+func bindValue(field reflect.Value, typed interface{}, raw string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+
+	if typed != nil {
+		tv := reflect.ValueOf(typed)
+		if tv.Type().AssignableTo(field.Type()) {
+			field.Set(tv)
+			return nil
+		}
+		if kindOf(tv.Kind()) == kindOf(field.Kind()) && tv.Type().ConvertibleTo(field.Type()) {
+			if overflows(field, tv) {
+				return fmt.Errorf("%v overflows %s", typed, field.Type())
+			}
+
+			field.Set(tv.Convert(field.Type()))
+			return nil
+		}
+	}
+
+	switch kindOf(field.Kind()) {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		i, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint:
+		u, err := strconv.ParseUint(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
+
+// overflows returns true if the numeric value cannot be represented by
+// the field of the same kind group.
+func overflows(field, v reflect.Value) bool {
+	switch kindOf(field.Kind()) {
+	case reflect.Int:
+		return field.OverflowInt(v.Int())
+	case reflect.Uint:
+		return field.OverflowUint(v.Uint())
+	case reflect.Float64:
+		return field.OverflowFloat(v.Float())
+	default:
+		return false
+	}
+}
+
+// kindOf groups the kinds which are safe to convert between, so that an
+// integer never becomes a string of the rune.
+func kindOf(k reflect.Kind) reflect.Kind {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.Int
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return reflect.Uint
+	case reflect.Float32, reflect.Float64:
+		return reflect.Float64
+	default:
+		return k
+	}
+}
+
+// ParseBool parses the UPnP boolean, which is one of "1", "true" or
+// "yes" for true, and "0", "false" or "no" for false.
+func ParseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "1", "true", "yes":
+		return true, nil
+	case "0", "false", "no":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid boolean %q", s)
+	}
+}
@@ -0,0 +1,136 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// An Arg is an argument of an action. Arguments are sent in the order
+// defined by the service description, as required by UPnP.
+type Arg struct {
+	Name  string
+	Value string
+}
+
+// ErrNoResponse is returned when the response of the action is missing.
+var ErrNoResponse = errors.New("soap: missing action response")
+
+// NewHTTPRequest returns the POST request invoking the action at the
+// control URL with the input arguments.
+func NewHTTPRequest(ctx context.Context, controlURL string, action *Action, args []Arg) (*http.Request, error) {
+	body := new(bytes.Buffer)
+	err := encodeEnvelope(body, func(e *xml.Encoder) error {
+		return encodeAction(e, action, action.Name, args)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, controlURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", strconv.Quote(action.String()))
+
+	return req, nil
+}
+
+// ParseHTTPResponse reads the output arguments of the action from the
+// response, or the UPnP error reported in its fault as *Error.
+func ParseHTTPResponse(resp *http.Response, action *Action) (map[string]string, error) {
+	args, err := decodeResponse(resp.Body, action)
+	if err != nil {
+		if _, ok := err.(*Error); !ok && resp.StatusCode != http.StatusOK {
+			return nil, errors.New("soap: " + resp.Status)
+		}
+
+		return nil, err
+	}
+
+	return args, nil
+}
+
+// decodeResponse reads the output arguments of the action from the SOAP
+// envelope, or the UPnP error reported in its fault. Some devices send
+// both, in which case the fault takes precedence.
+func decodeResponse(r io.Reader, action *Action) (map[string]string, error) {
+	var args map[string]string
+	var fault *Error
+
+	d := xml.NewDecoder(r)
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case action.Name + "Response":
+			args, err = decodeArgs(d, &start)
+			if err != nil {
+				return nil, err
+			}
+		case "Fault":
+			var v struct {
+				FaultString string `xml:"faultstring"`
+				UPnPError   struct {
+					Code        int    `xml:"errorCode"`
+					Description string `xml:"errorDescription"`
+				} `xml:"detail>UPnPError"`
+			}
+			if err := d.DecodeElement(&v, &start); err != nil {
+				return nil, err
+			}
+
+			fault = &Error{v.UPnPError.Code, v.UPnPError.Description}
+			if fault.Description == "" {
+				fault.Description = v.FaultString
+			}
+		}
+	}
+
+	if fault != nil {
+		return nil, fault
+	}
+	if args == nil {
+		return nil, ErrNoResponse
+	}
+
+	return args, nil
+}
+
+// Call invokes the action at the control URL with the input arguments,
+// and returns the output arguments. UPnP errors reported by the service
+// are returned as *Error.
+func Call(ctx context.Context, client *http.Client, controlURL string, action *Action, args []Arg) (map[string]string, error) {
+	req, err := NewHTTPRequest(ctx, controlURL, action, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ParseHTTPResponse(resp, action)
+}
@@ -1,12 +1,23 @@
 package soap
 
 import (
+	"bytes"
+	"context"
 	"encoding/xml"
+	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
-	"text/template"
+)
+
+const (
+	// EnvelopeNamespace is the namespace of SOAP 1.1 envelopes, which is
+	// also the extension declared by the MAN header of M-POST requests.
+	EnvelopeNamespace = "http://schemas.xmlsoap.org/soap/envelope/"
+
+	encodingStyle = "http://schemas.xmlsoap.org/soap/encoding/"
 )
 
 type Action struct {
@@ -14,6 +25,12 @@ type Action struct {
 	Name      string
 }
 
+// String returns the action in the form used by the SOAPACTION header,
+// without quotes.
+func (a *Action) String() string {
+	return a.Namespace + "#" + a.Name
+}
+
 // An Error represents an UPnP DCP specific error.
 type Error struct {
 	Code        int
@@ -41,10 +58,30 @@ var (
 type Request struct {
 	Action *Action
 	Args   map[string]string
+
+	// Values are the typed values of the arguments, keyed by names, if
+	// the arguments have been validated against the service description.
+	Values map[string]interface{}
+
+	ctx context.Context
+}
+
+// Context returns the request's context, which is canceled when the
+// client's connection closes.
+func (req *Request) Context() context.Context {
+	if req.ctx != nil {
+		return req.ctx
+	}
+
+	return context.Background()
 }
 
+// ParseHTTPRequest parses the action invoked by the HTTP request, which
+// is either a POST with the SOAPACTION header, or an M-POST with the
+// header in the namespace declared by its MAN header. Requests that are
+// not valid invocations result in errors wrapping ErrInvalidAction.
 func ParseHTTPRequest(r *http.Request) (*Request, error) {
-	action, err := parseAction(r.Header.Get("SOAPAction"))
+	action, err := parseAction(soapAction(r.Header))
 	if err != nil {
 		return nil, err
 	}
@@ -54,97 +91,256 @@ func ParseHTTPRequest(r *http.Request) (*Request, error) {
 		return nil, err
 	}
 
-	return &Request{action, args}, nil
+	return &Request{Action: action, Args: args, ctx: r.Context()}, nil
+}
+
+// soapAction returns the value of the SOAPACTION header. For M-POST
+// requests, the header is prefixed with the namespace number given in
+// the MAN header, e.g.:
+//
+//	MAN: "http://schemas.xmlsoap.org/soap/envelope/"; ns=01
+//	01-SOAPACTION: "urn:schemas-upnp-org:service:AVTransport:1#Play"
+func soapAction(h http.Header) string {
+	if v := h.Get("SOAPAction"); v != "" {
+		return v
+	}
+
+	for _, man := range h["Man"] {
+		params := strings.Split(man, ";")
+		if strings.Trim(strings.TrimSpace(params[0]), `"`) != EnvelopeNamespace {
+			continue
+		}
+
+		for _, p := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(kv[0], "ns") {
+				return h.Get(kv[1] + "-SOAPAction")
+			}
+		}
+	}
+
+	return ""
 }
 
+// parseAction parses the SOAPACTION header value in the form of
+// "namespace#name". The quotes are required by UPnP, but are optional
+// here, since not all control points send them.
 func parseAction(s string) (*Action, error) {
-	action, err := strconv.Unquote(s)
-	if err != nil {
-		return nil, err
+	action := strings.TrimSpace(s)
+	if len(action) >= 2 && action[0] == '"' && action[len(action)-1] == '"' {
+		action = action[1 : len(action)-1]
 	}
 
-	a := strings.SplitN(action, "#", 2)
+	i := strings.LastIndex(action, "#")
+	if i <= 0 || i == len(action)-1 {
+		return nil, fmt.Errorf("soap: malformed SOAPACTION %q: %w", s, ErrInvalidAction)
+	}
 
-	return &Action{a[0], a[1]}, nil
+	return &Action{action[:i], action[i+1:]}, nil
 }
 
+// parseArgs reads the input arguments of the action from the envelope.
+// The action element must match the one in the SOAPACTION header.
 func parseArgs(r io.Reader, action *Action) (map[string]string, error) {
-	actionName := xml.Name{action.Namespace, action.Name}
-	args := make(map[string]string)
-
 	d := xml.NewDecoder(r)
-	var v string
 	for {
 		token, err := d.Token()
-		if token == nil {
-			break
+		if err == io.EOF {
+			return nil, fmt.Errorf("soap: missing %s element: %w", action.Name, ErrInvalidAction)
 		}
-		if err != nil && err != io.EOF {
-			return nil, err
+		if err != nil {
+			return nil, fmt.Errorf("soap: malformed envelope (%s): %w", err, ErrInvalidAction)
 		}
 
-		switch t := token.(type) {
-		case xml.StartElement:
-			if t.Name != actionName {
-				break
-			}
-		case xml.CharData:
-			v = string(t)
-		case xml.EndElement:
-			if t.Name == actionName {
-				return args, nil
-			}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Space == EnvelopeNamespace {
+			continue
+		}
+
+		if start.Name.Local != action.Name || start.Name.Space != action.Namespace {
+			return nil, fmt.Errorf("soap: %s element does not match SOAPACTION: %w", start.Name.Local, ErrInvalidAction)
+		}
+
+		args, err := decodeArgs(d, &start)
+		if err != nil {
+			return nil, fmt.Errorf("soap: malformed envelope (%s): %w", err, ErrInvalidAction)
+		}
+
+		return args, nil
+	}
+}
+
+// decodeArgs decodes the child elements of start as arguments, keyed by
+// their local names.
+func decodeArgs(d *xml.Decoder, start *xml.StartElement) (map[string]string, error) {
+	var v struct {
+		Args []struct {
+			XMLName xml.Name
+			Value   string `xml:",chardata"`
+		} `xml:",any"`
+	}
+	if err := d.DecodeElement(&v, start); err != nil {
+		return nil, err
+	}
+
+	args := make(map[string]string, len(v.Args))
+	for _, arg := range v.Args {
+		args[arg.XMLName.Local] = arg.Value
+	}
+
+	return args, nil
+}
+
+// encodeEnvelope writes the SOAP envelope, with the body written by fn.
+func encodeEnvelope(w io.Writer, fn func(e *xml.Encoder) error) error {
+	envelope := xml.StartElement{
+		Name: xml.Name{Local: "s:Envelope"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "xmlns:s"}, Value: EnvelopeNamespace},
+			{Name: xml.Name{Local: "s:encodingStyle"}, Value: encodingStyle},
+		},
+	}
+	body := xml.StartElement{Name: xml.Name{Local: "s:Body"}}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.EncodeToken(envelope); err != nil {
+		return err
+	}
+	if err := e.EncodeToken(body); err != nil {
+		return err
+	}
+	if err := fn(e); err != nil {
+		return err
+	}
+	if err := e.EncodeToken(body.End()); err != nil {
+		return err
+	}
+	if err := e.EncodeToken(envelope.End()); err != nil {
+		return err
+	}
+	if err := e.Flush(); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// encodeAction writes the action element with the arguments in order.
+func encodeAction(e *xml.Encoder, action *Action, name string, args []Arg) error {
+	start := xml.StartElement{
+		Name: xml.Name{Local: "u:" + name},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns:u"}, Value: action.Namespace}},
+	}
 
-			args[t.Name.Local] = v
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if err := e.EncodeElement(arg.Value, xml.StartElement{Name: xml.Name{Local: arg.Name}}); err != nil {
+			return err
 		}
 	}
 
-	return nil, io.EOF
+	return e.EncodeToken(start.End())
+}
+
+// fault is the SOAP fault reporting an UPnP error.
+type fault struct {
+	XMLName     xml.Name `xml:"s:Fault"`
+	FaultCode   string   `xml:"faultcode"`
+	FaultString string   `xml:"faultstring"`
+	UPnPError   struct {
+		XMLName     xml.Name `xml:"urn:schemas-upnp-org:control-1-0 UPnPError"`
+		Code        int      `xml:"errorCode"`
+		Description string   `xml:"errorDescription"`
+	} `xml:"detail>UPnPError"`
 }
 
+// Response is the result of an action, which is either the output
+// arguments or an error.
+//
+// UPnP requires the output arguments to be in the order declared by the
+// action. Those in Order are written first in that order, followed by
+// the rest sorted by names.
 type Response struct {
 	Action *Action
 	Args   map[string]string
+	Order  []string
 	Error  *Error
 }
 
-const responseTemplate = `<?xml version="1.0" encoding="utf-8"?>
-<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
-  <s:Body>
-    <u:{{.Action.Name}}Response xmlns:u="{{.Action.Namespace}}">
-    {{- range $k, $v := .Args }}
-      <{{$k}}>{{escape $v}}</{{$k}}>
-    {{- end}}
-    </u:{{.Action.Name}}Response>
-		{{- with .Error }}
-		<s:Fault>
-			<faultcode>s:Client</faultcode>
-			<faultstring>UPnPError</faultstring>
-			<detail>
-				<UPnPError xmlns="urn:schemas-upnp-org:control-1-0">
-					<errorCode>{{.Code}}</errorCode>
-					<errorDescription>{{.Description}}</errorDescription>
-				</UPnPError>
-			</detail>
-		</s:Fault>
-		{{- end }}
-  </s:Body>
-</s:Envelope>
-`
-
-func (resp *Response) WriteTo(w io.Writer) error {
-	funcs := template.FuncMap{
-		"escape": func(s string) string {
-			b := new(strings.Builder)
-			err := xml.EscapeText(b, []byte(s))
-			if err != nil {
-				panic(err)
+// StatusCode returns the HTTP status code of the response. Errors are
+// reported with 500 Internal Server Error, as required by UPnP.
+func (resp *Response) StatusCode() int {
+	if resp.Error != nil {
+		return http.StatusInternalServerError
+	}
+
+	return http.StatusOK
+}
+
+// WriteTo writes the SOAP envelope of the response to w. It contains
+// either the action response with the output arguments, or only a fault
+// if there is an error.
+func (resp *Response) WriteTo(w io.Writer) (int64, error) {
+	buf := new(bytes.Buffer)
+	err := encodeEnvelope(buf, func(e *xml.Encoder) error {
+		if resp.Error != nil {
+			f := &fault{FaultCode: "s:Client", FaultString: "UPnPError"}
+			f.UPnPError.Code = resp.Error.Code
+			f.UPnPError.Description = resp.Error.Description
+
+			return e.Encode(f)
+		}
+
+		ordered := make(map[string]bool, len(resp.Order))
+		args := make([]Arg, 0, len(resp.Args))
+		for _, name := range resp.Order {
+			if value, ok := resp.Args[name]; ok && !ordered[name] {
+				ordered[name] = true
+				args = append(args, Arg{name, value})
+			}
+		}
+
+		names := make([]string, 0, len(resp.Args)-len(args))
+		for name := range resp.Args {
+			if !ordered[name] {
+				names = append(names, name)
 			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			args = append(args, Arg{name, resp.Args[name]})
+		}
+
+		return encodeAction(e, resp.Action, resp.Action.Name+"Response", args)
+	})
+	if err != nil {
+		return 0, err
+	}
 
-			return b.String()
-		}}
+	return buf.WriteTo(w)
+}
+
+// WriteHTTP writes the response with the HTTP status code and headers.
+func (resp *Response) WriteHTTP(w http.ResponseWriter) error {
+	buf := new(bytes.Buffer)
+	if _, err := resp.WriteTo(buf); err != nil {
+		return err
+	}
 
-	tpl := template.Must(template.New("response").Funcs(funcs).Parse(responseTemplate))
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header()["EXT"] = []string{""}
+	w.WriteHeader(resp.StatusCode())
 
-	return tpl.Execute(w, resp)
+	_, err := buf.WriteTo(w)
+	return err
 }
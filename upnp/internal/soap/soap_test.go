@@ -0,0 +1,316 @@
+package soap_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ericyan/omnicast/upnp/internal/soap"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// golden compares the data with the golden file, or updates the file if
+// the -update flag is set.
+func golden(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("%s mismatch:\n%s\nwant:\n%s", name, data, want)
+	}
+}
+
+var setURI = &soap.Action{
+	Namespace: "urn:schemas-upnp-org:service:AVTransport:1",
+	Name:      "SetAVTransportURI",
+}
+
+var setURIArgs = []soap.Arg{
+	{Name: "InstanceID", Value: "0"},
+	{Name: "CurrentURI", Value: "http://example.com/video.mp4?a=1&b=2"},
+	{Name: "CurrentURIMetaData", Value: `<DIDL-Lite><item><dc:title>Big Buck Bunny</dc:title></item></DIDL-Lite>`},
+}
+
+func newRequest(t *testing.T) *http.Request {
+	req, err := soap.NewHTTPRequest(context.Background(), "http://example.com/control", setURI, setURIArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return req
+}
+
+func TestNewHTTPRequest(t *testing.T) {
+	req := newRequest(t)
+	if req.Method != http.MethodPost {
+		t.Errorf("Unexpected method: %s", req.Method)
+	}
+	if v := req.Header.Get("SOAPAction"); v != `"urn:schemas-upnp-org:service:AVTransport:1#SetAVTransportURI"` {
+		t.Errorf("Unexpected SOAPACTION: %s", v)
+	}
+	if v := req.Header.Get("Content-Type"); v != `text/xml; charset="utf-8"` {
+		t.Errorf("Unexpected Content-Type: %s", v)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "request", body)
+}
+
+func TestParseHTTPRequest(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "request.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		header map[string]string
+		ok     bool
+	}{
+		{"POST", map[string]string{"SOAPACTION": `"urn:schemas-upnp-org:service:AVTransport:1#SetAVTransportURI"`}, true},
+		{"POST", map[string]string{"SOAPACTION": `urn:schemas-upnp-org:service:AVTransport:1#SetAVTransportURI`}, true},
+		{"POST", map[string]string{"SOAPACTION": ` "urn:schemas-upnp-org:service:AVTransport:1#SetAVTransportURI" `}, true},
+		{"M-POST", map[string]string{
+			"MAN":           `"http://schemas.xmlsoap.org/soap/envelope/"; ns=01`,
+			"01-SOAPACTION": `"urn:schemas-upnp-org:service:AVTransport:1#SetAVTransportURI"`,
+		}, true},
+		{"M-POST", map[string]string{
+			"MAN":           `"http://schemas.xmlsoap.org/soap/envelope/"; ns=01`,
+			"02-SOAPACTION": `"urn:schemas-upnp-org:service:AVTransport:1#SetAVTransportURI"`,
+		}, false},
+		{"POST", map[string]string{"SOAPACTION": `"urn:schemas-upnp-org:service:AVTransport:1"`}, false},
+		{"POST", map[string]string{"SOAPACTION": `"#SetAVTransportURI"`}, false},
+		{"POST", map[string]string{"SOAPACTION": `"urn:schemas-upnp-org:service:AVTransport:1#"`}, false},
+		{"POST", map[string]string{"SOAPACTION": `"urn:schemas-upnp-org:service:AVTransport:1#Play"`}, false},
+		{"POST", map[string]string{"SOAPACTION": `"urn:schemas-upnp-org:service:AVTransport:2#SetAVTransportURI"`}, false},
+		{"POST", map[string]string{"SOAPACTION": `"`}, false},
+		{"POST", nil, false},
+	}
+
+	for _, tc := range tests {
+		r := httptest.NewRequest(tc.method, "/control", bytes.NewReader(body))
+		for k, v := range tc.header {
+			r.Header.Set(k, v)
+		}
+
+		req, err := soap.ParseHTTPRequest(r)
+		if !tc.ok {
+			if !errors.Is(err, soap.ErrInvalidAction) {
+				t.Errorf("%s %v: unexpected error: %v", tc.method, tc.header, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %v: %s", tc.method, tc.header, err)
+			continue
+		}
+
+		if *req.Action != *setURI {
+			t.Errorf("Unexpected action: %+v", req.Action)
+		}
+		for _, arg := range setURIArgs {
+			if req.Args[arg.Name] != arg.Value {
+				t.Errorf("Unexpected %s: %q", arg.Name, req.Args[arg.Name])
+			}
+		}
+	}
+}
+
+func TestParseHTTPRequestMalformed(t *testing.T) {
+	for _, body := range []string{
+		"",
+		"<s:Envelope",
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body></s:Body></s:Envelope>`,
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:SetAVTransportURI xmlns:u="urn:schemas-upnp-org:service:AVTransport:1"><InstanceID>0</s:Body></s:Envelope>`,
+	} {
+		r := httptest.NewRequest("POST", "/control", strings.NewReader(body))
+		r.Header.Set("SOAPACTION", `"`+setURI.String()+`"`)
+
+		if _, err := soap.ParseHTTPRequest(r); !errors.Is(err, soap.ErrInvalidAction) {
+			t.Errorf("%q: unexpected error: %v", body, err)
+		}
+	}
+}
+
+func TestResponse(t *testing.T) {
+	getInfo := &soap.Action{Namespace: setURI.Namespace, Name: "GetTransportInfo"}
+	resp := &soap.Response{
+		Action: getInfo,
+		Args: map[string]string{
+			"CurrentTransportState":  "PLAYING",
+			"CurrentTransportStatus": "OK",
+			"CurrentSpeed":           "1",
+		},
+		Order: []string{"CurrentTransportState", "CurrentTransportStatus", "CurrentSpeed"},
+	}
+
+	w := httptest.NewRecorder()
+	if err := resp.WriteHTTP(w); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status: %d", w.Code)
+	}
+	if _, ok := w.Header()["EXT"]; !ok {
+		t.Error("Missing EXT header")
+	}
+	golden(t, "response", w.Body.Bytes())
+
+	args, err := soap.ParseHTTPResponse(w.Result(), getInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(args, resp.Args) {
+		t.Errorf("Unexpected output arguments: %v", args)
+	}
+}
+
+func TestFault(t *testing.T) {
+	resp := &soap.Response{
+		Action: setURI,
+		Args:   map[string]string{"Ignored": "1"},
+		Error:  &soap.Error{Code: 716, Description: "Resource not found"},
+	}
+
+	w := httptest.NewRecorder()
+	if err := resp.WriteHTTP(w); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Unexpected status: %d", w.Code)
+	}
+	golden(t, "fault", w.Body.Bytes())
+
+	_, err := soap.ParseHTTPResponse(w.Result(), setURI)
+	if uerr, ok := err.(*soap.Error); !ok || *uerr != *resp.Error {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseHTTPResponse(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		err    error
+	}{
+		{http.StatusOK, "", soap.ErrNoResponse},
+		{http.StatusOK, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:PlayResponse xmlns:u="urn:schemas-upnp-org:service:AVTransport:1"/></s:Body></s:Envelope>`, soap.ErrNoResponse},
+		{http.StatusInternalServerError, "Internal Server Error", nil},
+		{http.StatusOK, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring></s:Fault></s:Body></s:Envelope>`, &soap.Error{Description: "UPnPError"}},
+	}
+
+	for _, tc := range tests {
+		resp := &http.Response{
+			StatusCode: tc.status,
+			Status:     http.StatusText(tc.status),
+			Body:       ioutil.NopCloser(strings.NewReader(tc.body)),
+		}
+
+		_, err := soap.ParseHTTPResponse(resp, setURI)
+		if err == nil {
+			t.Errorf("%q: expect error", tc.body)
+			continue
+		}
+
+		switch want := tc.err.(type) {
+		case nil:
+		case *soap.Error:
+			if uerr, ok := err.(*soap.Error); !ok || *uerr != *want {
+				t.Errorf("%q: unexpected error: %v", tc.body, err)
+			}
+		default:
+			if err != want {
+				t.Errorf("%q: unexpected error: %v", tc.body, err)
+			}
+		}
+	}
+}
+
+type level float64
+
+func (l *level) UnmarshalText(text []byte) error {
+	var pct int
+	if _, err := fmt.Sscanf(string(text), "%d%%", &pct); err != nil {
+		return err
+	}
+	*l = level(pct) / 100
+
+	return nil
+}
+
+func TestBind(t *testing.T) {
+	req := &soap.Request{
+		Args: map[string]string{
+			"InstanceID":  "0",
+			"Channel":     "Master",
+			"DesiredMute": "yes",
+			"Volume":      "42",
+			"Level":       "50%",
+			"Ignored":     "x",
+		},
+		Values: map[string]interface{}{
+			"InstanceID": uint32(0),
+			"Volume":     uint16(42),
+		},
+	}
+
+	var args struct {
+		InstanceID int
+		Channel    string
+		Mute       bool `soap:"DesiredMute"`
+		Volume     uint8
+		Level      level
+		Ignored    string `soap:"-"`
+		Missing    string
+	}
+	args.Missing = "default"
+	if err := req.Bind(&args); err != nil {
+		t.Fatal(err)
+	}
+	if args.InstanceID != 0 || args.Channel != "Master" || !args.Mute || args.Volume != 42 || args.Level != 0.5 {
+		t.Errorf("Unexpected arguments: %+v", args)
+	}
+	if args.Ignored != "" || args.Missing != "default" {
+		t.Errorf("Unexpected arguments: %+v", args)
+	}
+
+	req.Args["Volume"] = "300"
+	req.Values["Volume"] = uint32(300)
+	if err := req.Bind(&args); !errors.Is(err, soap.ErrInvalidArgs) || args.Volume != 42 {
+		t.Errorf("Unexpected error for typed overflow: %v (volume: %d)", err, args.Volume)
+	}
+
+	req.Args["Volume"] = "256"
+	delete(req.Values, "Volume")
+	if err := req.Bind(&args); !errors.Is(err, soap.ErrInvalidArgs) {
+		t.Errorf("Unexpected error for overflow: %v", err)
+	}
+
+	if err := req.Bind(args); err != soap.ErrNotStruct {
+		t.Errorf("Unexpected error for non-pointer: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package ssdp
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// A controlMessage describes how a packet is received.
+type controlMessage struct {
+	// IfIndex is the index of the interface, or 0 if unknown.
+	IfIndex int
+
+	// Dst is the destination address, or nil if unknown.
+	Dst net.IP
+}
+
+// isMulticast returns true if the packet is sent to a multicast group.
+// Packets of unknown destinations are assumed to be multicast if received
+// on a socket joining the groups.
+func (cm controlMessage) isMulticast(joined bool) bool {
+	if cm.Dst == nil {
+		return joined
+	}
+
+	return cm.Dst.IsMulticast()
+}
+
+// packetConn is a UDP connection joining multicast groups on selected
+// interfaces, which reports the interface each packet is received on.
+type packetConn interface {
+	JoinGroup(ifi *net.Interface, group net.Addr) error
+	LeaveGroup(ifi *net.Interface, group net.Addr) error
+
+	// ReadFrom reads a packet, with how it is received.
+	ReadFrom(b []byte) (n int, cm controlMessage, src net.Addr, err error)
+
+	// WriteTo writes a packet, to be sent on the interface if not 0.
+	WriteTo(b []byte, ifIndex int, dst net.Addr) (int, error)
+
+	Close() error
+}
+
+type ipv4Conn struct {
+	*ipv4.PacketConn
+}
+
+func (c ipv4Conn) ReadFrom(b []byte) (int, controlMessage, net.Addr, error) {
+	n, cm, src, err := c.PacketConn.ReadFrom(b)
+	if cm == nil {
+		return n, controlMessage{}, src, err
+	}
+
+	return n, controlMessage{cm.IfIndex, cm.Dst}, src, err
+}
+
+func (c ipv4Conn) WriteTo(b []byte, ifIndex int, dst net.Addr) (int, error) {
+	var cm *ipv4.ControlMessage
+	if ifIndex != 0 {
+		cm = &ipv4.ControlMessage{IfIndex: ifIndex}
+	}
+
+	return c.PacketConn.WriteTo(b, cm, dst)
+}
+
+type ipv6Conn struct {
+	*ipv6.PacketConn
+}
+
+func (c ipv6Conn) ReadFrom(b []byte) (int, controlMessage, net.Addr, error) {
+	n, cm, src, err := c.PacketConn.ReadFrom(b)
+	if cm == nil {
+		return n, controlMessage{}, src, err
+	}
+
+	return n, controlMessage{cm.IfIndex, cm.Dst}, src, err
+}
+
+func (c ipv6Conn) WriteTo(b []byte, ifIndex int, dst net.Addr) (int, error) {
+	var cm *ipv6.ControlMessage
+	if ifIndex != 0 {
+		cm = &ipv6.ControlMessage{IfIndex: ifIndex}
+	}
+
+	return c.PacketConn.WriteTo(b, cm, dst)
+}
+
+// listenPacket listens on the port of the address family. If shared, the
+// port may be bound by other SSDP servers on the host as well.
+func listenPacket(ipv6Family bool, port int, shared bool) (packetConn, error) {
+	lc := new(net.ListenConfig)
+	if shared {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			var err error
+			c.Control(func(fd uintptr) {
+				err = setReuseAddr(fd)
+			})
+
+			return err
+		}
+	}
+
+	network, addr := "udp4", &net.UDPAddr{IP: net.IPv4zero, Port: port}
+	if ipv6Family {
+		network, addr = "udp6", &net.UDPAddr{IP: net.IPv6unspecified, Port: port}
+	}
+
+	c, err := lc.ListenPacket(context.Background(), network, addr.String())
+	if err != nil {
+		return nil, err
+	}
+	c.(*net.UDPConn).SetReadBuffer(MTU)
+
+	if ipv6Family {
+		p := ipv6.NewPacketConn(c)
+		if err := p.SetControlMessage(ipv6.FlagInterface|ipv6.FlagDst, true); err != nil {
+			// Not supported on all platforms, which only loses how
+			// packets are received.
+			p.SetControlMessage(ipv6.FlagInterface|ipv6.FlagDst, false)
+		}
+		p.SetMulticastLoopback(true)
+
+		return ipv6Conn{p}, nil
+	}
+
+	p := ipv4.NewPacketConn(c)
+	if err := p.SetControlMessage(ipv4.FlagInterface|ipv4.FlagDst, true); err != nil {
+		p.SetControlMessage(ipv4.FlagInterface|ipv4.FlagDst, false)
+	}
+	p.SetMulticastLoopback(true)
+
+	return ipv4Conn{p}, nil
+}
+
+// Range of ports to listen for unicast M-SEARCH requests, as advertised in
+// the SEARCHPORT.UPNP.ORG header.
+const (
+	searchPortMin = 49152
+	searchPortMax = 65535
+)
+
+// listenSearch listens on a random port for unicast M-SEARCH requests, as
+// the SSDP port is shared and unicast packets sent to it reach only one of
+// the servers on the host.
+func listenSearch(ipv6Family bool) (packetConn, int, error) {
+	var err error
+	for i := 0; i < 32; i++ {
+		port := searchPortMin + randIntn(searchPortMax-searchPortMin+1)
+
+		var conn packetConn
+		conn, err = listenPacket(ipv6Family, port, false)
+		if err == nil {
+			return conn, port, nil
+		}
+	}
+
+	return nil, 0, err
+}
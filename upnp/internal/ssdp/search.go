@@ -0,0 +1,146 @@
+package ssdp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// A Result is a response to an M-SEARCH request.
+type Result struct {
+	ST       string
+	USN      string
+	Location *url.URL
+	Server   string
+}
+
+// selectInterface returns true if the interface is to be used, either
+// named explicitly, or multicast-capable and not loopback if none is.
+func selectInterface(names []string, ifi *net.Interface) bool {
+	if ifi.Flags&net.FlagUp == 0 {
+		return false
+	}
+
+	if len(names) == 0 {
+		return ifi.Flags&net.FlagMulticast != 0 && ifi.Flags&net.FlagLoopback == 0
+	}
+
+	// Interfaces named explicitly are used even without the multicast
+	// flag, which is not set for loopback on some platforms.
+	for _, name := range names {
+		if name == ifi.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Search sends M-SEARCH requests for the search target to the IPv4
+// multicast group on the named interfaces, or all multicast-capable ones
+// if none is named, and returns the responses received until ctx is done,
+// one for each USN. Devices are asked to respond within mx seconds.
+func Search(ctx context.Context, st string, mx int, ifaces ...string) ([]*Result, error) {
+	group, err := net.ResolveUDPAddr("udp4", MulticastIPv4Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ifis, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method: "M-SEARCH",
+		URL:    &url.URL{Opaque: "*"},
+		Host:   MulticastIPv4Addr,
+		Header: http.Header{
+			"MAN":           []string{`"ssdp:discover"`},
+			"MX":            []string{strconv.Itoa(mx)},
+			"ST":            []string{st},
+			"USER-AGENT":    []string{ServerName},
+			"CPFN.UPNP.ORG": []string{"omnicast"},
+		},
+	}
+	buf := new(bytes.Buffer)
+	req.Write(buf)
+
+	p := ipv4.NewPacketConn(conn)
+	var sent int
+	for i := range ifis {
+		ifi := &ifis[i]
+		if !selectInterface(ifaces, ifi) {
+			continue
+		}
+
+		if err := p.SetMulticastInterface(ifi); err != nil {
+			log.Printf("SSDP: failed to search on %s: %s\n", ifi.Name, err)
+			continue
+		}
+		if _, err := p.WriteTo(buf.Bytes(), nil, group); err != nil {
+			log.Printf("SSDP: failed to search on %s: %s\n", ifi.Name, err)
+			continue
+		}
+
+		sent++
+	}
+	if sent == 0 {
+		// Fall back to the default interface for multicast.
+		if _, err := conn.WriteTo(buf.Bytes(), group); err != nil {
+			return nil, err
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	var results []*Result
+	seen := make(map[string]bool)
+	b := make([]byte, MTU)
+	for {
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return results, nil
+			}
+
+			return results, err
+		}
+
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b[:n])), nil)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			continue
+		}
+
+		r := &Result{
+			ST:     resp.Header.Get("ST"),
+			USN:    resp.Header.Get("USN"),
+			Server: resp.Header.Get("SERVER"),
+		}
+		if r.Location, err = url.Parse(resp.Header.Get("LOCATION")); err != nil || !r.Location.IsAbs() {
+			continue
+		}
+
+		if !seen[r.USN] {
+			seen[r.USN] = true
+			results = append(results, r)
+		}
+	}
+}
@@ -6,22 +6,62 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ericyan/omnicast/metrics"
 )
 
 const (
-	MulticastIPv4Addr     = "239.255.255.250:1900"
-	MTU                   = 8192
-	AliveInterval         = 15 * time.Minute
-	CacheControlDirective = "max-age=1800"
-	ServerName            = runtime.GOARCH + "/" + runtime.GOARCH + " UPnP/2.0 omnicast/0.1"
+	MulticastIPv4Addr          = "239.255.255.250:1900"
+	MulticastIPv6LinkLocalAddr = "[FF02::C]:1900"
+	MulticastIPv6SiteLocalAddr = "[FF05::C]:1900"
+	MTU                        = 8192
+	AliveInterval              = 15 * time.Minute
+	AliveRepeat                = 3
+	RescanInterval             = 10 * time.Second
+	MaxMX                      = 5
+	CacheControlDirective      = "max-age=1800"
+	ServerName                 = runtime.GOARCH + "/" + runtime.GOARCH + " UPnP/2.0 omnicast/0.1"
+)
+
+// aliveRepeatDelay is the delay between repeated announcements.
+const aliveRepeatDelay = 100 * time.Millisecond
+
+var (
+	searchRequests = metrics.NewCounter(
+		"omnicast_ssdp_msearch_requests_total",
+		"M-SEARCH requests received, by whether they are multicast or unicast.",
+		"mode",
+	)
+	searchResponses = metrics.NewCounter(
+		"omnicast_ssdp_msearch_responses_total",
+		"Responses sent to M-SEARCH requests, one per matching search target.",
+	)
 )
 
+var (
+	rndMu sync.Mutex
+	rnd   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// randIntn returns a random number in [0, n).
+func randIntn(n int) int {
+	rndMu.Lock()
+	defer rndMu.Unlock()
+
+	return rnd.Intn(n)
+}
+
 type Device interface {
 	// Returns the Unique Device Name, which will be the prefix of the USN
 	// header field in all discovery messages.
@@ -30,97 +70,564 @@ type Device interface {
 	URN() string
 	// Returns the URNs of all services provided by the device.
 	ServiceURNs() []string
+	// Returns the CONFIGID of the device description, which changes along
+	// with the description.
+	ConfigID() int
+}
+
+// A family is an address family served with a socket joining the
+// multicast groups of the family on each interface, and another one for
+// unicast searches.
+type family struct {
+	ipv6   bool
+	groups []*net.UDPAddr
+	conn   packetConn
+
+	search     packetConn
+	searchPort int
+}
+
+// An iface is an interface served, with the addresses to announce on it.
+type iface struct {
+	*net.Interface
+
+	ipv4 net.IP
+	ipv6 net.IP
+}
+
+// addr returns the address of the family on the interface, or nil.
+func (ifc *iface) addr(ipv6 bool) net.IP {
+	if ipv6 {
+		return ifc.ipv6
+	}
+
+	return ifc.ipv4
+}
+
+func (ifc *iface) String() string {
+	s := ifc.Name
+	for _, ip := range []net.IP{ifc.ipv4, ifc.ipv6} {
+		if ip != nil {
+			s += " " + ip.String()
+		}
+	}
+
+	return s
 }
 
 type Server struct {
-	dev   Device
-	loc   *url.URL
-	addr  *net.UDPAddr
-	conn  *net.UDPConn
-	alive *time.Ticker
-	done  chan bool
+	// Interfaces are the names of the network interfaces to serve. If
+	// empty, all multicast-capable interfaces which are up will be served,
+	// except loopback ones. Interfaces are rescanned periodically, so that
+	// those appearing later or changing addresses are picked up.
+	Interfaces []string
+
+	dev      Device
+	loc      *url.URL
+	families []*family
+
+	mu     sync.Mutex
+	ifaces map[int]*iface
+	bootID int
+	done   chan struct{}
+	closed bool
 }
 
 // NewServer returns a SSDP server for the given device that announces
 // the URL to its UPnP description.
+//
+// If the host of the URL is an IP address, only the multicast groups of
+// its address family will be joined. If it is unspecified, the groups of
+// both families will be joined, and the URL will be announced on each
+// interface with the address of that interface.
 func NewServer(dev Device, loc *url.URL) (*Server, error) {
-	addr, err := net.ResolveUDPAddr("udp", MulticastIPv4Addr)
+	var v4, v6 bool
+
+	host := loc.Hostname()
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil && host != "":
+		// Host names are announced as is, to IPv4 only for compatibility.
+		v4 = true
+	case ip == nil || ip.IsUnspecified():
+		v4, v6 = true, true
+	case ip.To4() != nil:
+		v4 = true
+	default:
+		v6 = true
+	}
+
+	srv := &Server{dev: dev, loc: loc, done: make(chan struct{})}
+	if v4 {
+		f, err := newFamily(false, MulticastIPv4Addr)
+		if err != nil {
+			return nil, err
+		}
+		srv.families = append(srv.families, f)
+	}
+	if v6 {
+		f, err := newFamily(true, MulticastIPv6LinkLocalAddr, MulticastIPv6SiteLocalAddr)
+		if err != nil {
+			return nil, err
+		}
+		srv.families = append(srv.families, f)
+	}
+
+	return srv, nil
+}
+
+func newFamily(ipv6 bool, groups ...string) (*family, error) {
+	f := &family{ipv6: ipv6}
+	for _, g := range groups {
+		addr, err := net.ResolveUDPAddr("udp", g)
+		if err != nil {
+			return nil, err
+		}
+
+		f.groups = append(f.groups, addr)
+	}
+
+	return f, nil
+}
+
+// isUnspecified returns true if the host of the URL is not an address to
+// be announced as is.
+func (srv *Server) isUnspecified() bool {
+	host := srv.loc.Hostname()
+	if host == "" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// withIP returns the URL with its host replaced by the IP address. Zones
+// of link-local addresses are dropped, as they are meaningless to remote
+// hosts.
+func (srv *Server) withIP(ip net.IP) *url.URL {
+	loc := *srv.loc
+	loc.Host = net.JoinHostPort(ip.String(), loc.Port())
+
+	return &loc
+}
+
+// locationOn returns the URL to announce on the interface to the address
+// family, or nil if the interface has no address of the family.
+func (srv *Server) locationOn(ifc *iface, ipv6 bool) *url.URL {
+	if !srv.isUnspecified() {
+		return srv.loc
+	}
+
+	ip := ifc.addr(ipv6)
+	if ip == nil {
+		return nil
+	}
+
+	return srv.withIP(ip)
+}
+
+// locationFor returns the URL to send in reply to the remote address, for
+// a request received on the interface of the index. If the interface is
+// unknown, the local address used to reach the remote one is announced.
+func (srv *Server) locationFor(ifIndex int, raddr *net.UDPAddr) *url.URL {
+	if !srv.isUnspecified() {
+		return srv.loc
+	}
+
+	srv.mu.Lock()
+	ifc := srv.ifaces[ifIndex]
+	srv.mu.Unlock()
+
+	if ifc != nil {
+		if loc := srv.locationOn(ifc, raddr.IP.To4() == nil); loc != nil {
+			return loc
+		}
+	}
+
+	// No packet is sent by dialing UDP, which just picks the route.
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	return srv.withIP(conn.LocalAddr().(*net.UDPAddr).IP)
+}
+
+// selected returns true if the interface is to be served.
+func (srv *Server) selected(ifi *net.Interface) bool {
+	return selectInterface(srv.Interfaces, ifi)
+}
+
+// preferred returns true if the address is preferred over the current
+// one for announcement, i.e. it is routable while the current one is not.
+func preferred(ip, current net.IP) bool {
+	return current == nil || (current.IsLinkLocalUnicast() && !ip.IsLinkLocalUnicast())
+}
+
+// scan returns the interfaces to serve, indexed by interface index. If
+// the host of the URL is an IP address, only the interfaces having it will
+// be served by default, unless it is not found on any, e.g. behind NAT.
+func (srv *Server) scan() (map[int]*iface, error) {
+	ifis, err := net.Interfaces()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Server{dev: dev, loc: loc, addr: addr}, nil
+	host := net.ParseIP(srv.loc.Hostname())
+	if srv.isUnspecified() || len(srv.Interfaces) > 0 {
+		host = nil
+	}
+
+	ifaces := make(map[int]*iface)
+	owners := make(map[int]*iface)
+	for i := range ifis {
+		ifi := &ifis[i]
+		if !srv.selected(ifi) {
+			continue
+		}
+
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			log.Printf("SSDP: failed to get addresses of %s: %s\n", ifi.Name, err)
+			continue
+		}
+
+		ifc := &iface{Interface: ifi}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+
+			if ipnet.IP.Equal(host) {
+				owners[ifi.Index] = ifc
+			}
+
+			if ip := ipnet.IP.To4(); ip != nil {
+				if preferred(ip, ifc.ipv4) {
+					ifc.ipv4 = ip
+				}
+			} else if preferred(ipnet.IP, ifc.ipv6) {
+				ifc.ipv6 = ipnet.IP
+			}
+		}
+
+		if ifc.ipv4 != nil || ifc.ipv6 != nil {
+			ifaces[ifi.Index] = ifc
+		}
+	}
+
+	if len(owners) > 0 {
+		return owners, nil
+	}
+
+	return ifaces, nil
 }
 
-func (srv *Server) ListenAndServe() error {
-	conn, err := net.ListenMulticastUDP("udp", nil, srv.addr)
+// rescan updates the interfaces served, joining the multicast groups on
+// those appearing and leaving those on the ones disappearing.
+//
+// The device is announced on interfaces which are new or have changed
+// address. As the device is then reachable differently, its BOOTID is
+// increased, with an ssdp:update sent on the interfaces served before.
+func (srv *Server) rescan() {
+	ifaces, err := srv.scan()
 	if err != nil {
-		return err
+		log.Println("SSDP: failed to scan interfaces:", err)
+		return
 	}
-	conn.SetReadBuffer(MTU)
-	srv.conn = conn
 
-	log.Printf("SSDP server listening on: %s", srv.conn.LocalAddr())
+	srv.mu.Lock()
+	prev := srv.ifaces
+	srv.ifaces = ifaces
+	srv.mu.Unlock()
+
+	var changed, kept []*iface
+	for index, ifc := range ifaces {
+		old := prev[index]
+		for _, f := range srv.families {
+			has := ifc.addr(f.ipv6) != nil
+			had := old != nil && old.addr(f.ipv6) != nil
+			switch {
+			case has && !had:
+				srv.join(f, ifc)
+			case !has && had:
+				srv.leave(f, ifc)
+			}
+		}
 
-	srv.done = make(chan bool)
+		if old != nil {
+			kept = append(kept, ifc)
+		}
 
-	srv.sendNotification("ssdp:alive")
-	if AliveInterval > 0 {
-		srv.alive = time.NewTicker(AliveInterval)
-		go func() {
-			for range srv.alive.C {
-				srv.sendNotification("ssdp:alive")
+		if old == nil || !ifc.ipv4.Equal(old.ipv4) || !ifc.ipv6.Equal(old.ipv6) {
+			log.Printf("SSDP server serving on: %s\n", ifc)
+			changed = append(changed, ifc)
+		}
+	}
+
+	for index, old := range prev {
+		if _, ok := ifaces[index]; !ok {
+			log.Printf("SSDP server stopped serving on: %s\n", old.Name)
+			for _, f := range srv.families {
+				if old.addr(f.ipv6) != nil {
+					srv.leave(f, old)
+				}
 			}
-		}()
+		}
 	}
 
-	buf := make([]byte, MTU)
+	if len(changed) == 0 {
+		return
+	}
+
+	if len(prev) > 0 {
+		for _, ifc := range kept {
+			if err := srv.notifyOn(ifc, "ssdp:update"); err != nil {
+				log.Printf("SSDP: failed to send update on %s: %s\n", ifc.Name, err)
+			}
+		}
+
+		srv.mu.Lock()
+		srv.bootID++
+		srv.mu.Unlock()
+
+		changed = srv.served()
+	}
+
+	go srv.announce(changed)
+}
+
+func (srv *Server) join(f *family, ifc *iface) {
+	if f.conn == nil {
+		return
+	}
+
+	for _, g := range f.groups {
+		if err := f.conn.JoinGroup(ifc.Interface, g); err != nil {
+			log.Printf("SSDP: failed to join %s on %s: %s\n", g.IP, ifc.Name, err)
+		}
+	}
+}
+
+func (srv *Server) leave(f *family, ifc *iface) {
+	if f.conn == nil {
+		return
+	}
+
+	// Errors are expected for interfaces which have gone, as the groups
+	// have been left along with them.
+	for _, g := range f.groups {
+		f.conn.LeaveGroup(ifc.Interface, g)
+	}
+}
+
+// served returns the interfaces served.
+func (srv *Server) served() []*iface {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	ifaces := make([]*iface, 0, len(srv.ifaces))
+	for _, ifc := range srv.ifaces {
+		ifaces = append(ifaces, ifc)
+	}
+
+	return ifaces
+}
+
+// BootID returns the BOOTID of the device, which is the time it starts
+// serving and increases whenever it becomes reachable differently.
+func (srv *Server) BootID() int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	return srv.bootID
+}
+
+func (srv *Server) ListenAndServe() error {
+	srv.mu.Lock()
+	srv.bootID = int(time.Now().Unix() & 0x7fffffff)
+	srv.mu.Unlock()
+
+	var listening []*family
+	for _, f := range srv.families {
+		conn, err := listenPacket(f.ipv6, f.groups[0].Port, true)
+		if err != nil {
+			log.Printf("SSDP: failed to listen for %s: %s\n", f.groups[0], err)
+			continue
+		}
+
+		search, port, err := listenSearch(f.ipv6)
+		if err != nil {
+			conn.Close()
+			log.Printf("SSDP: failed to listen for unicast search: %s\n", err)
+			continue
+		}
+
+		srv.mu.Lock()
+		if srv.closed {
+			srv.mu.Unlock()
+			conn.Close()
+			search.Close()
+			return nil
+		}
+		f.conn, f.search, f.searchPort = conn, search, port
+		srv.mu.Unlock()
+
+		listening = append(listening, f)
+	}
+
+	if len(listening) == 0 {
+		return errors.New("ssdp: failed to listen on any address family")
+	}
+
+	srv.rescan()
+	go srv.tick()
+
+	var eg errgroup.Group
+	for _, f := range listening {
+		f := f
+		eg.Go(func() error {
+			return srv.serve(f, f.conn)
+		})
+		eg.Go(func() error {
+			return srv.serve(f, f.search)
+		})
+	}
+
+	return eg.Wait()
+}
+
+// aliveDelay returns the delay to the next announcement, which is
+// randomized so that announcements of devices are spread out.
+func aliveDelay() time.Duration {
+	return AliveInterval - time.Duration(randIntn(int(AliveInterval/10)))
+}
+
+// tick rescans the interfaces and announces the device periodically, until
+// the Server is closed.
+func (srv *Server) tick() {
+	rescan := time.NewTicker(RescanInterval)
+	defer rescan.Stop()
+
+	alive := time.NewTimer(aliveDelay())
+	defer alive.Stop()
+
 	for {
 		select {
+		case <-rescan.C:
+			srv.rescan()
+		case <-alive.C:
+			srv.announce(srv.served())
+			alive.Reset(aliveDelay())
 		case <-srv.done:
-			close(srv.done)
-			return nil
-		default:
-			n, raddr, err := srv.conn.ReadFromUDP(buf)
-			if err != nil {
-				if err, ok := err.(net.Error); ok && (err.Timeout() || err.Temporary()) {
-					continue
-				}
+			return
+		}
+	}
+}
 
-				return err
+// announce sends ssdp:alive on the interfaces, repeated AliveRepeat times
+// as the messages may be lost.
+func (srv *Server) announce(ifaces []*iface) {
+	for i := 0; i < AliveRepeat; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(aliveRepeatDelay):
+			case <-srv.done:
+				return
 			}
+		}
 
-			req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
-			if err != nil {
-				log.Println("failed to parse request:", err)
-				continue
+		for _, ifc := range ifaces {
+			if err := srv.notifyOn(ifc, "ssdp:alive"); err != nil {
+				log.Printf("SSDP: failed to announce on %s: %s\n", ifc.Name, err)
+			}
+		}
+	}
+}
+
+func (srv *Server) isClosed() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	return srv.closed
+}
+
+// serve handles requests received by the connection of the address family,
+// until the Server is closed.
+func (srv *Server) serve(f *family, conn packetConn) error {
+	buf := make([]byte, MTU)
+	for {
+		n, cm, src, err := conn.ReadFrom(buf)
+		if err != nil {
+			if srv.isClosed() {
+				return nil
 			}
 
-			err = srv.handleRequest(req, raddr)
-			if err != nil {
-				log.Println("failed to handle request:", err)
+			if err, ok := err.(net.Error); ok && (err.Timeout() || err.Temporary()) {
+				continue
 			}
+
+			return err
+		}
+
+		// The socket receives from all groups joined on the host, which
+		// may be on interfaces not served.
+		srv.mu.Lock()
+		_, served := srv.ifaces[cm.IfIndex]
+		srv.mu.Unlock()
+		if cm.IfIndex != 0 && !served {
+			continue
+		}
+
+		raddr, ok := src.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
+		if err != nil {
+			log.Println("failed to parse request:", err)
+			continue
+		}
+
+		err = srv.handleRequest(f, conn, cm, req, raddr)
+		if err != nil {
+			log.Println("failed to handle request:", err)
 		}
 	}
 }
 
 func (srv *Server) Close() error {
-	if srv.conn == nil {
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
 		return nil
 	}
+	srv.closed = true
+	close(srv.done)
+	srv.mu.Unlock()
 
-	if srv.alive != nil {
-		srv.alive.Stop()
+	for _, ifc := range srv.served() {
+		srv.notifyOn(ifc, "ssdp:byebye")
 	}
 
-	srv.conn.SetReadDeadline(time.Now().Add(1 * time.Second))
-
-	srv.done <- true
-	<-srv.done
+	var err error
+	for _, f := range srv.families {
+		for _, conn := range []packetConn{f.conn, f.search} {
+			if conn == nil {
+				continue
+			}
 
-	srv.sendNotification("ssdp:byebye")
+			if cerr := conn.Close(); cerr != nil {
+				err = cerr
+			}
+		}
+	}
 
-	return srv.conn.Close()
+	return err
 }
 
 func (srv *Server) capabilities() map[string]string {
@@ -132,51 +639,135 @@ func (srv *Server) capabilities() map[string]string {
 	return caps
 }
 
-func (srv *Server) commonHeader() http.Header {
-	return http.Header{
+// splitVersion splits the URN of a device or service type into the type
+// and version, or returns a version of 0 if it is not versioned.
+func splitVersion(urn string) (string, int) {
+	if !strings.HasPrefix(urn, "urn:") {
+		return urn, 0
+	}
+
+	i := strings.LastIndexByte(urn, ':')
+	ver, err := strconv.Atoi(urn[i+1:])
+	if err != nil || ver < 1 {
+		return urn, 0
+	}
+
+	return urn[:i], ver
+}
+
+// search returns the USNs of the capabilities matching the search target,
+// indexed by the ST to respond with. Device and service types match those
+// of the same or later versions, which are backward compatible, and the
+// requested versions are responded with.
+func (srv *Server) search(st string) map[string]string {
+	caps := srv.capabilities()
+	if st == "ssdp:all" {
+		return caps
+	}
+
+	if usn, ok := caps[st]; ok {
+		return map[string]string{st: usn}
+	}
+
+	typ, ver := splitVersion(st)
+	if ver == 0 {
+		return nil
+	}
+
+	for t := range caps {
+		if capType, capVer := splitVersion(t); capType == typ && capVer >= ver {
+			return map[string]string{st: srv.dev.UDN() + "::" + st}
+		}
+	}
+
+	return nil
+}
+
+// header returns the header fields common to discovery messages sent by
+// the address family, announcing the URL.
+func (srv *Server) header(f *family, loc *url.URL) http.Header {
+	h := http.Header{
 		"CACHE-CONTROL":     []string{CacheControlDirective},
-		"LOCATION":          []string{srv.loc.String()},
+		"LOCATION":          []string{loc.String()},
 		"SERVER":            []string{ServerName},
-		"BOOTID.UPNP.ORG":   []string{strconv.Itoa(int(time.Now().Unix()))},
-		"CONFIGID.UPNP.ORG": []string{"1"},
+		"BOOTID.UPNP.ORG":   []string{strconv.Itoa(srv.BootID())},
+		"CONFIGID.UPNP.ORG": []string{strconv.Itoa(srv.dev.ConfigID())},
+	}
+
+	if f.searchPort != 0 {
+		h["SEARCHPORT.UPNP.ORG"] = []string{strconv.Itoa(f.searchPort)}
 	}
+
+	return h
 }
 
-func (srv *Server) sendNotification(nts string) error {
+// notifyOn sends the notification to the multicast groups on the interface.
+func (srv *Server) notifyOn(ifc *iface, nts string) error {
 	switch nts {
-	case "ssdp:alive", "ssdp:byebye":
-	case "ssdp:update":
-		return fmt.Errorf("NTS %s not implemented", nts)
+	case "ssdp:alive", "ssdp:byebye", "ssdp:update":
 	default:
 		return fmt.Errorf("invalid NTS: %s", nts)
 	}
 
-	for t, usn := range srv.capabilities() {
-		req := &http.Request{
-			Method: "NOTIFY",
-			URL:    &url.URL{Opaque: "*"},
-			Host:   MulticastIPv4Addr,
-			Header: srv.commonHeader(),
+	for _, f := range srv.families {
+		loc := srv.locationOn(ifc, f.ipv6)
+		if f.conn == nil || loc == nil {
+			continue
 		}
 
-		req.Header.Set("NTS", nts)
+		h := srv.header(f, loc)
+		switch nts {
+		case "ssdp:byebye":
+			delete(h, "CACHE-CONTROL")
+			delete(h, "LOCATION")
+			delete(h, "SERVER")
+			delete(h, "SEARCHPORT.UPNP.ORG")
+		case "ssdp:update":
+			delete(h, "CACHE-CONTROL")
+			delete(h, "SERVER")
+			h["NEXTBOOTID.UPNP.ORG"] = []string{strconv.Itoa(srv.BootID() + 1)}
+		}
+		h["NTS"] = []string{nts}
+
+		for _, g := range f.groups {
+			for t, usn := range srv.capabilities() {
+				req := &http.Request{
+					Method: "NOTIFY",
+					URL:    &url.URL{Opaque: "*"},
+					Host:   g.String(),
+					Header: h,
+				}
 
-		req.Header.Set("NT", t)
-		req.Header.Set("USN", usn)
+				h["NT"] = []string{t}
+				h["USN"] = []string{usn}
 
-		buf := new(bytes.Buffer)
-		req.Write(buf)
+				buf := new(bytes.Buffer)
+				req.Write(buf)
 
-		_, err := srv.conn.WriteTo(buf.Bytes(), srv.addr)
-		if err != nil {
-			return err
+				_, err := f.conn.WriteTo(buf.Bytes(), ifc.Index, g)
+				if err != nil {
+					return err
+				}
+			}
 		}
 	}
 
 	return nil
 }
 
-func (srv *Server) handleRequest(req *http.Request, raddr *net.UDPAddr) error {
+// handleRequest responds to the M-SEARCH request received by the
+// connection of the address family.
+//
+// Multicast requests are responded after a random delay up to MX seconds,
+// so that control points are not flooded by responses, and are discarded
+// if MX is missing. Unicast requests are responded immediately.
+func (srv *Server) handleRequest(f *family, conn packetConn, cm controlMessage, req *http.Request, raddr *net.UDPAddr) error {
+	// Announcements of other devices, and looped back ones of the Server,
+	// are of no interest.
+	if req.Method == "NOTIFY" {
+		return nil
+	}
+
 	if req.Method != "M-SEARCH" {
 		return fmt.Errorf("unsupported method: %s", req.Method)
 	}
@@ -190,34 +781,79 @@ func (srv *Server) handleRequest(req *http.Request, raddr *net.UDPAddr) error {
 		return errors.New("ST is empty")
 	}
 
-	log.Printf("[DEBUG] %s %s from %s\n", req.Method, st, raddr)
+	mode := "unicast"
+	var delay time.Duration
+	if cm.isMulticast(conn == f.conn) {
+		mode = "multicast"
+		mx, err := strconv.Atoi(req.Header.Get("MX"))
+		if err != nil || mx < 1 {
+			return fmt.Errorf("invalid MX for multicast search: %q", req.Header.Get("MX"))
+		}
+		if mx > MaxMX {
+			mx = MaxMX
+		}
+
+		delay = time.Duration(randIntn(mx*1000)) * time.Millisecond
+	}
+
+	cp := raddr.String()
+	if cpfn := req.Header.Get("CPFN.UPNP.ORG"); cpfn != "" {
+		cp = cpfn + " (" + cp + ")"
+	}
+	log.Printf("[DEBUG] %s %s from %s\n", req.Method, st, cp)
+	searchRequests.Inc(mode)
+
+	targets := srv.search(st)
+	if len(targets) == 0 {
+		return nil
+	}
 
-	n := 0
-	for t, usn := range srv.capabilities() {
-		if st == t || st == "ssdp:all" {
+	loc := srv.locationFor(cm.IfIndex, raddr)
+	if loc == nil {
+		return fmt.Errorf("no address to announce to %s", raddr)
+	}
+
+	respond := func() {
+		for t, usn := range targets {
 			resp := &http.Response{
 				StatusCode:    http.StatusOK,
 				ProtoMajor:    1,
 				ProtoMinor:    1,
-				Header:        srv.commonHeader(),
+				Header:        srv.header(f, loc),
 				ContentLength: -1,
 				Uncompressed:  true,
 			}
 
-			resp.Header.Set("ST", t)
-			resp.Header.Set("USN", usn)
+			resp.Header["DATE"] = []string{time.Now().UTC().Format(http.TimeFormat)}
+			resp.Header["EXT"] = []string{""}
+			resp.Header["ST"] = []string{t}
+			resp.Header["USN"] = []string{usn}
 
 			buf := new(bytes.Buffer)
 			resp.Write(buf)
 
-			_, err := srv.conn.WriteTo(buf.Bytes(), raddr)
-			if err != nil {
-				return err
+			if _, err := conn.WriteTo(buf.Bytes(), cm.IfIndex, raddr); err != nil {
+				if !srv.isClosed() {
+					log.Println("failed to respond to search:", err)
+				}
+				return
 			}
-
-			n++
+			searchResponses.Inc()
 		}
 	}
 
+	if delay == 0 {
+		respond()
+		return nil
+	}
+
+	go func() {
+		select {
+		case <-time.After(delay):
+			respond()
+		case <-srv.done:
+		}
+	}()
+
 	return nil
 }
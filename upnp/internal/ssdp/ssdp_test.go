@@ -0,0 +1,459 @@
+package ssdp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+type testDevice struct{}
+
+func (testDevice) UDN() string   { return "uuid:00000000-0000-0000-0000-000000000000" }
+func (testDevice) URN() string   { return "urn:schemas-upnp-org:device:MediaRenderer:1" }
+func (testDevice) ConfigID() int { return 42 }
+
+func (testDevice) ServiceURNs() []string {
+	return []string{"urn:schemas-upnp-org:service:RenderingControl:2"}
+}
+
+func TestNewServer(t *testing.T) {
+	tests := []struct {
+		host   string
+		groups []string
+	}{
+		{"192.0.2.1:2278", []string{"239.255.255.250:1900"}},
+		{"[2001:db8::1]:2278", []string{"[ff02::c]:1900", "[ff05::c]:1900"}},
+		{"omnicast.local:2278", []string{"239.255.255.250:1900"}},
+		{":2278", []string{"239.255.255.250:1900", "[ff02::c]:1900", "[ff05::c]:1900"}},
+	}
+
+	for _, tc := range tests {
+		loc := &url.URL{Scheme: "http", Host: tc.host, Path: "/"}
+		srv, err := NewServer(testDevice{}, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var groups []string
+		for _, f := range srv.families {
+			for _, g := range f.groups {
+				if (g.IP.To4() == nil) != f.ipv6 {
+					t.Errorf("%s: group %s in wrong family", tc.host, g)
+				}
+				groups = append(groups, g.String())
+			}
+		}
+
+		if len(groups) != len(tc.groups) {
+			t.Errorf("%s: unexpected groups: %v", tc.host, groups)
+			continue
+		}
+		for i, g := range groups {
+			if g != tc.groups[i] {
+				t.Errorf("%s: got group %s; want %s", tc.host, g, tc.groups[i])
+			}
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	loc := &url.URL{Scheme: "http", Host: ":2278", Path: "/"}
+	srv := &Server{loc: loc}
+
+	if got := srv.withIP([]byte{192, 0, 2, 1}).String(); got != "http://192.0.2.1:2278/" {
+		t.Errorf("Unexpected IPv4 location: %s", got)
+	}
+
+	ifc := &iface{
+		Interface: &net.Interface{Index: 2, Name: "eth0"},
+		ipv4:      net.IPv4(192, 0, 2, 1),
+		ipv6:      net.ParseIP("2001:db8::1"),
+	}
+	if got := srv.locationOn(ifc, false).String(); got != "http://192.0.2.1:2278/" {
+		t.Errorf("Unexpected IPv4 location on %s: %s", ifc, got)
+	}
+	if got := srv.locationOn(ifc, true).String(); got != "http://[2001:db8::1]:2278/" {
+		t.Errorf("Unexpected IPv6 location on %s: %s", ifc, got)
+	}
+
+	// Requests are answered with the address of the receiving interface,
+	// or the one routing to the requester if unknown.
+	srv.ifaces = map[int]*iface{ifc.Index: ifc}
+	raddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1900}
+	if got := srv.locationFor(ifc.Index, raddr).String(); got != "http://192.0.2.1:2278/" {
+		t.Errorf("Unexpected location for %s on %s: %s", raddr, ifc, got)
+	}
+	if got := srv.locationFor(0, raddr).String(); got != "http://127.0.0.1:2278/" {
+		t.Errorf("Unexpected location for %s: %s", raddr, got)
+	}
+
+	fixed := &Server{loc: &url.URL{Scheme: "http", Host: "192.0.2.2:2278", Path: "/"}}
+	if got := fixed.locationOn(ifc, false).String(); got != "http://192.0.2.2:2278/" {
+		t.Errorf("Unexpected fixed location on %s: %s", ifc, got)
+	}
+}
+
+func TestSelected(t *testing.T) {
+	eth0 := &net.Interface{Name: "eth0", Flags: net.FlagUp | net.FlagMulticast}
+	eth1 := &net.Interface{Name: "eth1", Flags: net.FlagUp | net.FlagMulticast}
+	down := &net.Interface{Name: "eth2", Flags: net.FlagMulticast}
+	lo := &net.Interface{Name: "lo", Flags: net.FlagUp | net.FlagLoopback}
+
+	srv := &Server{}
+	for ifi, want := range map[*net.Interface]bool{eth0: true, eth1: true, down: false, lo: false} {
+		if got := srv.selected(ifi); got != want {
+			t.Errorf("all: %s selected: %v; want %v", ifi.Name, got, want)
+		}
+	}
+
+	srv.Interfaces = []string{"eth1", "lo", "eth2"}
+	for ifi, want := range map[*net.Interface]bool{eth0: false, eth1: true, down: false, lo: true} {
+		if got := srv.selected(ifi); got != want {
+			t.Errorf("explicit: %s selected: %v; want %v", ifi.Name, got, want)
+		}
+	}
+}
+
+func TestScanLoopback(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("no loopback interface:", err)
+	}
+
+	loc := &url.URL{Scheme: "http", Host: ":2278", Path: "/"}
+	srv, err := NewServer(testDevice{}, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Interfaces = []string{"lo"}
+
+	ifaces, err := srv.scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ifc, ok := ifaces[lo.Index]
+	if len(ifaces) != 1 || !ok {
+		t.Fatalf("Unexpected interfaces: %v", ifaces)
+	}
+	if !ifc.ipv4.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("Unexpected address of %s: %s", ifc.Name, ifc.ipv4)
+	}
+	if got := srv.locationOn(ifc, false).String(); got != "http://127.0.0.1:2278/" {
+		t.Errorf("Unexpected location on %s: %s", ifc, got)
+	}
+}
+
+func TestSplitVersion(t *testing.T) {
+	tests := []struct {
+		urn string
+		typ string
+		ver int
+	}{
+		{"urn:schemas-upnp-org:device:MediaRenderer:1", "urn:schemas-upnp-org:device:MediaRenderer", 1},
+		{"urn:schemas-upnp-org:service:RenderingControl:3", "urn:schemas-upnp-org:service:RenderingControl", 3},
+		{"urn:schemas-upnp-org:service:RenderingControl", "urn:schemas-upnp-org:service:RenderingControl", 0},
+		{"upnp:rootdevice", "upnp:rootdevice", 0},
+		{"uuid:00000000-0000-0000-0000-000000000000", "uuid:00000000-0000-0000-0000-000000000000", 0},
+	}
+
+	for _, tc := range tests {
+		if typ, ver := splitVersion(tc.urn); typ != tc.typ || ver != tc.ver {
+			t.Errorf("%s: got %s %d; want %s %d", tc.urn, typ, ver, tc.typ, tc.ver)
+		}
+	}
+}
+
+// startLoopback starts a Server on the loopback interface, returning it
+// once the interface is served.
+func startLoopback(t *testing.T) (*Server, *net.Interface) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("no loopback interface:", err)
+	}
+
+	loc := &url.URL{Scheme: "http", Host: ":2278", Path: "/"}
+	srv, err := NewServer(testDevice{}, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Interfaces = []string{lo.Name}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	for i := 0; len(srv.served()) == 0; i++ {
+		if i == 100 {
+			srv.Close()
+			t.Fatal("Loopback interface not served")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return srv, lo
+}
+
+// readMessages returns the messages of the test device received until
+// the timeout.
+func readMessages(t *testing.T, conn net.PacketConn, timeout time.Duration) []http.Header {
+	var msgs []http.Header
+
+	buf := make([]byte, MTU)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return msgs
+		}
+
+		r := bufio.NewReader(bytes.NewReader(buf[:n]))
+		var h http.Header
+		if bytes.HasPrefix(buf[:n], []byte("HTTP/")) {
+			resp, err := http.ReadResponse(r, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h = resp.Header
+		} else {
+			req, err := http.ReadRequest(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h = req.Header
+		}
+
+		if strings.HasPrefix(h.Get("USN"), testDevice{}.UDN()) {
+			msgs = append(msgs, h)
+		}
+	}
+}
+
+func sendSearch(t *testing.T, conn net.PacketConn, dst net.Addr, st, mx string) {
+	msg := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + dst.String() + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"ST: " + st + "\r\n" +
+		"CPFN.UPNP.ORG: ssdp test\r\n"
+	if mx != "" {
+		msg += "MX: " + mx + "\r\n"
+	}
+	msg += "\r\n"
+
+	if _, err := conn.WriteTo([]byte(msg), dst); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchLoopback(t *testing.T) {
+	srv, lo := startLoopback(t)
+	defer srv.Close()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := ipv4.NewPacketConn(conn).SetMulticastInterface(lo); err != nil {
+		t.Fatal(err)
+	}
+
+	group, _ := net.ResolveUDPAddr("udp4", MulticastIPv4Addr)
+	caps := srv.capabilities()
+
+	sendSearch(t, conn, group, "ssdp:all", "1")
+	msgs := readMessages(t, conn, 1500*time.Millisecond)
+	if len(msgs) != len(caps) {
+		t.Fatalf("Unexpected responses: %v", msgs)
+	}
+	for _, h := range msgs {
+		if usn, ok := caps[h.Get("ST")]; !ok || usn != h.Get("USN") {
+			t.Errorf("Unexpected ST and USN: %s %s", h.Get("ST"), h.Get("USN"))
+		}
+		if h.Get("LOCATION") != "http://127.0.0.1:2278/" {
+			t.Errorf("Unexpected LOCATION: %s", h.Get("LOCATION"))
+		}
+		if h.Get("BOOTID.UPNP.ORG") != strconv.Itoa(srv.BootID()) || h.Get("CONFIGID.UPNP.ORG") != "42" {
+			t.Errorf("Unexpected BOOTID and CONFIGID: %s %s", h.Get("BOOTID.UPNP.ORG"), h.Get("CONFIGID.UPNP.ORG"))
+		}
+		if _, ok := h["Ext"]; !ok || h.Get("DATE") == "" {
+			t.Errorf("Missing EXT or DATE: %v", h)
+		}
+	}
+
+	// Multicast requests without MX are discarded.
+	sendSearch(t, conn, group, "upnp:rootdevice", "")
+	if msgs := readMessages(t, conn, 1200*time.Millisecond); len(msgs) != 0 {
+		t.Errorf("Unexpected responses without MX: %v", msgs)
+	}
+
+	// Unicast requests to SEARCHPORT are responded immediately, without MX.
+	port, err := strconv.Atoi(searchDevice(t, conn, group).Get("SEARCHPORT.UPNP.ORG"))
+	if err != nil || port < searchPortMin || port > searchPortMax {
+		t.Fatalf("Unexpected SEARCHPORT: %d %v", port, err)
+	}
+	unicast := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+
+	st := "urn:schemas-upnp-org:service:RenderingControl:1"
+	sendSearch(t, conn, unicast, st, "")
+	msgs = readMessages(t, conn, 200*time.Millisecond)
+	if len(msgs) != 1 {
+		t.Fatalf("Unexpected unicast responses: %v", msgs)
+	}
+	if msgs[0].Get("ST") != st || msgs[0].Get("USN") != (testDevice{}).UDN()+"::"+st {
+		t.Errorf("Unexpected response to earlier version: %s %s", msgs[0].Get("ST"), msgs[0].Get("USN"))
+	}
+
+	sendSearch(t, conn, unicast, "urn:schemas-upnp-org:service:RenderingControl:3", "")
+	if msgs := readMessages(t, conn, 200*time.Millisecond); len(msgs) != 0 {
+		t.Errorf("Unexpected responses to later version: %v", msgs)
+	}
+}
+
+// searchDevice returns the first response to a multicast search for the device.
+func searchDevice(t *testing.T, conn net.PacketConn, group net.Addr) http.Header {
+	sendSearch(t, conn, group, testDevice{}.UDN(), "1")
+	msgs := readMessages(t, conn, 1500*time.Millisecond)
+	if len(msgs) != 1 {
+		t.Fatalf("Unexpected responses: %v", msgs)
+	}
+
+	return msgs[0]
+}
+
+func TestNotifyLoopback(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("no loopback interface:", err)
+	}
+
+	// The SSDP port is shared with the Server.
+	lc := &net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var err error
+			c.Control(func(fd uintptr) {
+				err = setReuseAddr(fd)
+			})
+
+			return err
+		},
+	}
+
+	group, _ := net.ResolveUDPAddr("udp4", MulticastIPv4Addr)
+	conn, err := lc.ListenPacket(context.Background(), "udp4", "0.0.0.0:"+strconv.Itoa(group.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := ipv4.NewPacketConn(conn).JoinGroup(lo, group); err != nil {
+		t.Skip("multicast unavailable on loopback:", err)
+	}
+
+	// notifications returns the notifications received until the timeout,
+	// grouped by NTS.
+	notifications := func(timeout time.Duration) map[string][]http.Header {
+		msgs := make(map[string][]http.Header)
+		for _, h := range readMessages(t, conn, timeout) {
+			msgs[h.Get("NTS")] = append(msgs[h.Get("NTS")], h)
+		}
+
+		return msgs
+	}
+
+	srv, _ := startLoopback(t)
+	caps := srv.capabilities()
+	bootID := strconv.Itoa(srv.BootID())
+
+	alive := notifications(time.Second)["ssdp:alive"]
+	if len(alive) != AliveRepeat*len(caps) {
+		t.Errorf("Unexpected alive messages: %d", len(alive))
+	}
+	for _, h := range alive {
+		if h.Get("LOCATION") != "http://127.0.0.1:2278/" || h.Get("BOOTID.UPNP.ORG") != bootID || h.Get("SEARCHPORT.UPNP.ORG") == "" {
+			t.Errorf("Unexpected alive message: %v", h)
+		}
+	}
+
+	// The device is updated with a new BOOTID when the address changes.
+	srv.mu.Lock()
+	changed := *srv.ifaces[lo.Index]
+	changed.ipv4 = net.IPv4(127, 0, 0, 2)
+	srv.ifaces[lo.Index] = &changed
+	srv.mu.Unlock()
+	srv.rescan()
+
+	nextBootID := strconv.Itoa(srv.BootID())
+	if nextBootID == bootID {
+		t.Fatal("BOOTID not increased")
+	}
+
+	msgs := notifications(time.Second)
+	if len(msgs["ssdp:update"]) != len(caps) {
+		t.Errorf("Unexpected update messages: %d", len(msgs["ssdp:update"]))
+	}
+	for _, h := range msgs["ssdp:update"] {
+		if h.Get("BOOTID.UPNP.ORG") != bootID || h.Get("NEXTBOOTID.UPNP.ORG") != nextBootID || h.Get("LOCATION") != "http://127.0.0.1:2278/" {
+			t.Errorf("Unexpected update message: %v", h)
+		}
+	}
+	if len(msgs["ssdp:alive"]) != AliveRepeat*len(caps) {
+		t.Errorf("Unexpected alive messages after update: %d", len(msgs["ssdp:alive"]))
+	}
+	for _, h := range msgs["ssdp:alive"] {
+		if h.Get("BOOTID.UPNP.ORG") != nextBootID {
+			t.Errorf("Unexpected alive message after update: %v", h)
+		}
+	}
+
+	srv.Close()
+	byebye := notifications(500 * time.Millisecond)["ssdp:byebye"]
+	if len(byebye) != len(caps) {
+		t.Errorf("Unexpected byebye messages: %d", len(byebye))
+	}
+	for _, h := range byebye {
+		if h.Get("LOCATION") != "" || h.Get("BOOTID.UPNP.ORG") != nextBootID {
+			t.Errorf("Unexpected byebye message: %v", h)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	srv, lo := startLoopback(t)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+
+	st := "urn:schemas-upnp-org:device:MediaRenderer:1"
+	results, err := Search(ctx, st, 1, lo.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, r := range results {
+		if r.USN != (testDevice{}).UDN()+"::"+st {
+			continue
+		}
+
+		found = true
+		if r.ST != st || r.Location.String() != "http://127.0.0.1:2278/" || r.Server != ServerName {
+			t.Errorf("Unexpected result: %+v", r)
+		}
+	}
+	if !found {
+		t.Errorf("Device not found: %v", results)
+	}
+}
@@ -3,11 +3,19 @@ package types
 import (
 	"encoding/xml"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/ericyan/omnicast"
 	"github.com/ericyan/omnicast/upnp/internal/didl"
 )
 
 // Metadata implements the omnicast.MediaMetadata interface.
+//
+// Keys are the local names of DIDL-Lite elements, e.g. "title" for the
+// dc:title element. Elements with a role attribute are keyed by their
+// name and role separated by "@", e.g. "artist@AlbumArtist".
 type Metadata map[string]string
 
 // Title returns the descriptive title of the content.
@@ -17,7 +25,11 @@ func (m Metadata) Title() string {
 
 // Subtitle returns the descriptive subtitle of the content.
 func (m Metadata) Subtitle() string {
-	return m["dc:creator"]
+	if creator := m["creator"]; creator != "" {
+		return creator
+	}
+
+	return m["artist"]
 }
 
 // ImageURL returns the URL of the image.
@@ -35,6 +47,135 @@ func (m Metadata) ImageURL() *url.URL {
 	return u
 }
 
+// mediaType returns the media type corresponding to the upnp:class.
+func (m Metadata) mediaType() omnicast.MediaType {
+	class := m["class"]
+	isEpisode := m["seriesTitle"] != "" || m["episodeNumber"] != ""
+
+	switch {
+	case strings.HasPrefix(class, "object.item.audioItem.musicTrack"):
+		return omnicast.MusicTrack
+	case strings.HasPrefix(class, "object.item.imageItem"):
+		return omnicast.Photo
+	case strings.HasPrefix(class, "object.item.epgItem.videoProgram"),
+		strings.HasPrefix(class, "object.item.videoItem.videoBroadcast"):
+		return omnicast.TVShow
+	case strings.HasPrefix(class, "object.item.videoItem") && isEpisode:
+		return omnicast.TVShow
+	case strings.HasPrefix(class, "object.item.videoItem.movie"):
+		return omnicast.Movie
+	default:
+		return omnicast.GenericMedia
+	}
+}
+
+func (m Metadata) int(key string) int {
+	i, _ := strconv.Atoi(m[key])
+	return i
+}
+
+// MediaDetails implements the omnicast.MediaDetailer interface.
+func (m Metadata) MediaDetails() *omnicast.MediaDetails {
+	d := &omnicast.MediaDetails{
+		Type:  m.mediaType(),
+		Title: m.Title(),
+	}
+
+	if u := m.ImageURL(); u != nil {
+		d.Images = []*url.URL{u}
+	}
+
+	switch d.Type {
+	case omnicast.Movie:
+		d.Subtitle = m.Subtitle()
+		d.Studio = m["publisher"]
+		d.ReleaseDate = m["date"]
+	case omnicast.TVShow:
+		d.Subtitle = m["programTitle"]
+		d.SeriesTitle = m["seriesTitle"]
+		d.Season = m.int("episodeSeason")
+		d.Episode = m.int("episodeNumber")
+		d.OriginalAirdate = m["date"]
+	case omnicast.MusicTrack:
+		d.Artist = m.Subtitle()
+		d.AlbumName = m["album"]
+		d.AlbumArtist = m["artist@AlbumArtist"]
+		d.Composer = m["author@Composer"]
+		d.TrackNumber = m.int("originalTrackNumber")
+		d.DiscNumber = m.int("originalDiscNumber")
+		d.ReleaseDate = m["date"]
+	case omnicast.Photo:
+		d.Artist = m.Subtitle()
+		d.CreationDateTime = m["date"]
+	default:
+		d.Subtitle = m.Subtitle()
+		d.ReleaseDate = m["date"]
+	}
+
+	return d
+}
+
+// NewMetadata returns the DIDL-Lite metadata for the given details.
+func NewMetadata(d *omnicast.MediaDetails) Metadata {
+	m := make(Metadata)
+	if d == nil {
+		return m
+	}
+
+	set := func(key, value string) {
+		if value != "" {
+			m[key] = value
+		}
+	}
+	setInt := func(key string, value int) {
+		if value != 0 {
+			m[key] = strconv.Itoa(value)
+		}
+	}
+
+	set("title", d.Title)
+	if len(d.Images) > 0 {
+		set("albumArtURI", d.Images[0].String())
+	}
+
+	switch d.Type {
+	case omnicast.Movie:
+		set("class", "object.item.videoItem.movie")
+		set("creator", d.Subtitle)
+		set("publisher", d.Studio)
+		set("date", d.ReleaseDate)
+	case omnicast.TVShow:
+		// A class of its own, so that shows without the series title or
+		// episode number are still recognized.
+		set("class", "object.item.videoItem.videoBroadcast")
+		set("programTitle", d.Subtitle)
+		set("seriesTitle", d.SeriesTitle)
+		setInt("episodeSeason", d.Season)
+		setInt("episodeNumber", d.Episode)
+		set("date", d.OriginalAirdate)
+	case omnicast.MusicTrack:
+		set("class", "object.item.audioItem.musicTrack")
+		set("creator", d.Artist)
+		set("artist", d.Artist)
+		set("album", d.AlbumName)
+		set("artist@AlbumArtist", d.AlbumArtist)
+		set("author@Composer", d.Composer)
+		setInt("originalTrackNumber", d.TrackNumber)
+		setInt("originalDiscNumber", d.DiscNumber)
+		set("date", d.ReleaseDate)
+	case omnicast.Photo:
+		set("class", "object.item.imageItem.photo")
+		set("creator", d.Artist)
+		set("date", d.CreationDateTime)
+	default:
+		set("class", "object.item")
+		set("creator", d.Subtitle)
+		set("date", d.ReleaseDate)
+	}
+
+	return m
+}
+
 // UnmarshalText fills the map with media metadata contained in the
 // DIDL-Lite XML fragment.
 func (m Metadata) UnmarshalText(data []byte) error {
@@ -45,9 +186,67 @@ func (m Metadata) UnmarshalText(data []byte) error {
 
 	if i := len(doc.Items); i > 0 {
 		for _, v := range doc.Items[i-1].Values {
-			m[v.Type()] = v.String()
+			key := v.Type()
+			if v.Role != "" {
+				if _, ok := m[key]; !ok {
+					m[key] = v.String()
+				}
+
+				key += "@" + v.Role
+			}
+
+			m[key] = v.String()
 		}
 	}
 
 	return nil
 }
+
+// didlNamespaces maps element names to their namespace prefixes. Names
+// not listed here are in the upnp namespace.
+var didlNamespaces = map[string]string{
+	"title":       "dc:",
+	"creator":     "dc:",
+	"date":        "dc:",
+	"publisher":   "dc:",
+	"description": "dc:",
+	"res":         "",
+}
+
+// MarshalText encodes the metadata as a DIDL-Lite XML fragment with a
+// single item.
+func (m Metadata) MarshalText() ([]byte, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := new(strings.Builder)
+	b.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">`)
+	b.WriteString(`<item id="0" parentID="-1" restricted="1">`)
+	for _, k := range keys {
+		name, role := k, ""
+		if i := strings.Index(k, "@"); i >= 0 {
+			name, role = k[:i], k[i+1:]
+		}
+
+		prefix, ok := didlNamespaces[name]
+		if !ok {
+			prefix = "upnp:"
+		}
+
+		b.WriteString("<" + prefix + name)
+		if role != "" {
+			b.WriteString(` role="`)
+			xml.EscapeText(b, []byte(role))
+			b.WriteString(`"`)
+		}
+		b.WriteString(">")
+		xml.EscapeText(b, []byte(m[k]))
+		b.WriteString("</" + prefix + name + ">")
+	}
+	b.WriteString(`</item></DIDL-Lite>`)
+
+	return []byte(b.String()), nil
+}
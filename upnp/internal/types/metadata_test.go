@@ -1,6 +1,11 @@
 package types
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ericyan/omnicast"
+)
 
 const metadataTestCase = `<?xml version="1.0" encoding="UTF-8"?>
 <DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">
@@ -23,3 +28,72 @@ func TestMetadata(t *testing.T) {
 		t.Errorf("Unexpected title: '%s'", m.Title())
 	}
 }
+
+const musicTrackTestCase = `<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">
+  <item id="2" parentID="-1" restricted="1">
+    <dc:title>Define Dancing</dc:title>
+    <dc:creator>Thomas Newman</dc:creator>
+    <dc:date>2008-06-24</dc:date>
+    <upnp:class>object.item.audioItem.musicTrack</upnp:class>
+    <upnp:artist>Thomas Newman</upnp:artist>
+    <upnp:artist role="AlbumArtist">Various Artists</upnp:artist>
+    <upnp:album>WALL-E</upnp:album>
+    <upnp:originalTrackNumber>7</upnp:originalTrackNumber>
+    <upnp:albumArtURI>http://example.com/wall-e.jpg</upnp:albumArtURI>
+  </item>
+</DIDL-Lite>`
+
+func TestMetadataDetails(t *testing.T) {
+	m := make(Metadata)
+	if err := m.UnmarshalText([]byte(musicTrackTestCase)); err != nil {
+		t.Fatal(err)
+	}
+
+	d := m.MediaDetails()
+	if d.Type != omnicast.MusicTrack {
+		t.Errorf("Unexpected type: %s", d.Type)
+	}
+	if d.Artist != "Thomas Newman" || d.AlbumArtist != "Various Artists" {
+		t.Errorf("Unexpected artists: '%s', '%s'", d.Artist, d.AlbumArtist)
+	}
+	if d.AlbumName != "WALL-E" || d.TrackNumber != 7 || d.ReleaseDate != "2008-06-24" {
+		t.Errorf("Unexpected details: %+v", d)
+	}
+	if len(d.Images) != 1 || d.Images[0].String() != "http://example.com/wall-e.jpg" {
+		t.Errorf("Unexpected images: %v", d.Images)
+	}
+
+	data, err := NewMetadata(d).MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m2 := make(Metadata)
+	if err := m2.UnmarshalText(data); err != nil {
+		t.Fatal(err)
+	}
+	if d2 := m2.MediaDetails(); !reflect.DeepEqual(d, d2) {
+		t.Errorf("Round trip: got %+v; want %+v", d2, d)
+	}
+}
+
+func TestMetadataTVShow(t *testing.T) {
+	for _, d := range []*omnicast.MediaDetails{
+		{Type: omnicast.TVShow, Title: "Pilot", Subtitle: "Pilot", SeriesTitle: "Firefly", Season: 1, Episode: 1, OriginalAirdate: "2002-12-20"},
+		{Type: omnicast.TVShow, Title: "Untitled", Season: 2},
+		{Type: omnicast.TVShow, Title: "Special"},
+	} {
+		data, err := NewMetadata(d).MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := make(Metadata)
+		if err := m.UnmarshalText(data); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.MediaDetails(); !reflect.DeepEqual(got, d) {
+			t.Errorf("Round trip: got %+v; want %+v", got, d)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package upnp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ericyan/omnicast/upnp/internal/soap"
+)
+
+// An SCPD is a service description, which lists the actions and state
+// variables of a service.
+type SCPD struct {
+	XMLName        xml.Name         `xml:"urn:schemas-upnp-org:service-1-0 scpd"`
+	SpecVersion    SpecVersion      `xml:"specVersion"`
+	Actions        []*SCPDAction    `xml:"actionList>action"`
+	StateVariables []*StateVariable `xml:"serviceStateTable>stateVariable"`
+}
+
+// SpecVersion is the UPnP version of a description.
+type SpecVersion struct {
+	Major int `xml:"major"`
+	Minor int `xml:"minor"`
+}
+
+// An SCPDAction describes an action and its arguments.
+type SCPDAction struct {
+	Name      string          `xml:"name"`
+	Arguments []*SCPDArgument `xml:"argumentList>argument"`
+}
+
+// An SCPDArgument describes an argument of an action, whose type is that
+// of the related state variable.
+type SCPDArgument struct {
+	Name                 string `xml:"name"`
+	Direction            string `xml:"direction"`
+	RelatedStateVariable string `xml:"relatedStateVariable"`
+}
+
+// A StateVariable describes a state variable of a service.
+type StateVariable struct {
+	Name              string             `xml:"name"`
+	SendEvents        string             `xml:"sendEvents,attr,omitempty"`
+	DataType          string             `xml:"dataType"`
+	DefaultValue      string             `xml:"defaultValue,omitempty"`
+	AllowedValues     []string           `xml:"allowedValueList>allowedValue,omitempty"`
+	AllowedValueRange *AllowedValueRange `xml:"allowedValueRange,omitempty"`
+}
+
+// An AllowedValueRange restricts the values of a numeric state variable.
+type AllowedValueRange struct {
+	Minimum string `xml:"minimum"`
+	Maximum string `xml:"maximum"`
+	Step    string `xml:"step,omitempty"`
+}
+
+// ParseSCPD reads a service description.
+func ParseSCPD(r io.Reader) (*SCPD, error) {
+	scpd := new(SCPD)
+	if err := xml.NewDecoder(r).Decode(scpd); err != nil {
+		return nil, err
+	}
+
+	return scpd, nil
+}
+
+// Action returns the action of the name, or nil if not found.
+func (scpd *SCPD) Action(name string) *SCPDAction {
+	for _, a := range scpd.Actions {
+		if a.Name == name {
+			return a
+		}
+	}
+
+	return nil
+}
+
+// StateVariable returns the state variable of the name, or nil if not
+// found.
+func (scpd *SCPD) StateVariable(name string) *StateVariable {
+	for _, v := range scpd.StateVariables {
+		if v.Name == name {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// validate checks the input arguments of the action against their related
+// state variables, and returns their typed values. Missing arguments and
+// values of the wrong type result in soap.ErrInvalidArgs, values not in
+// the allowed value list in soap.ErrArgValueInvalid, and values not in
+// the allowed value range in soap.ErrArgValueOutOfRange.
+func (scpd *SCPD) validate(action *SCPDAction, args map[string]string) (map[string]interface{}, *soap.Error) {
+	values := make(map[string]interface{}, len(args))
+	for _, arg := range action.Arguments {
+		if arg.Direction != "in" {
+			continue
+		}
+
+		s, ok := args[arg.Name]
+		if !ok {
+			return nil, soap.ErrInvalidArgs
+		}
+
+		v := scpd.StateVariable(arg.RelatedStateVariable)
+		if v == nil {
+			values[arg.Name] = s
+			continue
+		}
+
+		value, err := v.parse(s)
+		if err != nil {
+			return nil, err
+		}
+		values[arg.Name] = value
+	}
+
+	return values, nil
+}
+
+// parse converts the string into a value of the data type, and checks it
+// against the allowed values.
+func (v *StateVariable) parse(s string) (interface{}, *soap.Error) {
+	value, err := parseValue(v.DataType, s)
+	if err != nil {
+		return nil, soap.ErrInvalidArgs
+	}
+
+	if len(v.AllowedValues) > 0 {
+		allowed := false
+		for _, av := range v.AllowedValues {
+			if s == av {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, soap.ErrArgValueInvalid
+		}
+	}
+
+	if r := v.AllowedValueRange; r != nil {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, soap.ErrInvalidArgs
+		}
+
+		if min, err := strconv.ParseFloat(r.Minimum, 64); err == nil && f < min {
+			return nil, soap.ErrArgValueOutOfRange
+		}
+		if max, err := strconv.ParseFloat(r.Maximum, 64); err == nil && f > max {
+			return nil, soap.ErrArgValueOutOfRange
+		}
+	}
+
+	return value, nil
+}
+
+// parseValue converts the string into the Go value of the UPnP data type.
+// Integers and floats are of the same size as the data type, booleans are
+// bool, and binaries are []byte. Other data types remain strings.
+func parseValue(dataType, s string) (interface{}, error) {
+	switch dataType {
+	case "ui1", "ui2", "ui4", "ui8":
+		bits, _ := strconv.Atoi(dataType[2:])
+		u, err := strconv.ParseUint(s, 10, bits*8)
+		if err != nil {
+			return nil, err
+		}
+
+		switch bits {
+		case 1:
+			return uint8(u), nil
+		case 2:
+			return uint16(u), nil
+		case 4:
+			return uint32(u), nil
+		default:
+			return u, nil
+		}
+	case "i1", "i2", "i4", "i8", "int":
+		// int is a synonym of i4.
+		bits := 4
+		if dataType != "int" {
+			bits, _ = strconv.Atoi(dataType[1:])
+		}
+		i, err := strconv.ParseInt(s, 10, bits*8)
+		if err != nil {
+			return nil, err
+		}
+
+		switch bits {
+		case 1:
+			return int8(i), nil
+		case 2:
+			return int16(i), nil
+		case 4:
+			return int32(i), nil
+		default:
+			return i, nil
+		}
+	case "r4":
+		f, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		return float32(f), nil
+	case "r8", "number", "float", "fixed.14.4":
+		return strconv.ParseFloat(s, 64)
+	case "boolean":
+		return soap.ParseBool(s)
+	case "char":
+		if len([]rune(s)) != 1 {
+			return nil, fmt.Errorf("invalid char %q", s)
+		}
+
+		return s, nil
+	case "bin.base64":
+		return base64.StdEncoding.DecodeString(s)
+	case "bin.hex":
+		return hex.DecodeString(s)
+	default:
+		return s, nil
+	}
+}
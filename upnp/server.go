@@ -10,6 +10,10 @@ import (
 )
 
 type Server struct {
+	// Interfaces are the names of the network interfaces to be discovered
+	// on. If empty, all multicast-capable interfaces will be used.
+	Interfaces []string
+
 	ss *ssdp.Server
 	hs *http.Server
 }
@@ -26,12 +30,13 @@ func NewServer(dev *Device, addr string) (*Server, error) {
 		Handler: dev,
 	}
 
-	return &Server{ss, hs}, nil
+	return &Server{ss: ss, hs: hs}, nil
 }
 
 func (srv *Server) ListenAndServe() error {
 	var g errgroup.Group
 
+	srv.ss.Interfaces = srv.Interfaces
 	g.Go(srv.ss.ListenAndServe)
 	g.Go(func() error {
 		err := srv.hs.ListenAndServe()
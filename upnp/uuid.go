@@ -0,0 +1,37 @@
+package upnp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/google/uuid"
+)
+
+// LoadUUID reads the UUID persisted in the file. If the file does not
+// exist, a random UUID is generated and persisted in it, so that the
+// device keeps its identity across restarts.
+func LoadUUID(filename string) (uuid.UUID, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err == nil {
+		return uuid.ParseBytes(bytes.TrimSpace(data))
+	}
+	if !os.IsNotExist(err) {
+		return uuid.Nil, err
+	}
+
+	id := uuid.New()
+	if err := ioutil.WriteFile(filename, []byte(id.String()+"\n"), 0644); err != nil {
+		return uuid.Nil, err
+	}
+
+	return id, nil
+}
+
+// DeriveUUID returns the UUID derived from the one of the bridged device
+// and the device type, e.g. a MediaRenderer for a Google Cast device. It
+// is stable as long as the bridged device is, yet not the same, so that
+// both can be on the network.
+func DeriveUUID(bridged uuid.UUID, deviceType string) uuid.UUID {
+	return uuid.NewSHA1(bridged, []byte(deviceType))
+}
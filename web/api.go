@@ -0,0 +1,280 @@
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// API is the JSON API controlling the players, for scripts that do not
+// speak SOAP. It serves the following paths relative to where it is
+// mounted, which are described in OpenAPI at /openapi.json:
+//
+//	GET  /players                  status of all players
+//	GET  /players/{id}             status of the player
+//	POST /players/{id}/{action}    command with arguments in JSON
+//	GET  /events                   status of all players as events
+//	GET  /players/{id}/events      status of the player as events
+//
+// Like Dashboard, it should be used with http.StripPrefix.
+type API struct {
+	Players *Players
+}
+
+// NewAPI returns the API of the players.
+func NewAPI(players *Players) *API {
+	return &API{players}
+}
+
+func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "openapi.json":
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAPI)
+	case len(parts) == 1 && parts[0] == "events":
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		serveEvents(w, r, api.Players, "")
+	case len(parts) == 1 && parts[0] == "players":
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		statuses := []*Status{}
+		for _, id := range api.Players.IDs() {
+			statuses = append(statuses, StatusOf(id, api.Players.Get(id)))
+		}
+
+		writeJSON(w, http.StatusOK, statuses)
+	case len(parts) >= 2 && len(parts) <= 3 && parts[0] == "players":
+		id := parts[1]
+		player := api.Players.Get(id)
+		if player == nil {
+			writeError(w, http.StatusNotFound, "player not found")
+			return
+		}
+
+		if len(parts) == 2 {
+			if !allowMethod(w, r, http.MethodGet) {
+				return
+			}
+
+			writeJSON(w, http.StatusOK, StatusOf(id, player))
+			return
+		}
+
+		if parts[2] == "events" {
+			if !allowMethod(w, r, http.MethodGet) {
+				return
+			}
+
+			serveEvents(w, r, api.Players, id)
+			return
+		}
+
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+
+		// Browsers send simple requests of other media types to other
+		// origins without preflight, which must not control the players.
+		if !isSameOrigin(r) {
+			writeError(w, http.StatusForbidden, "cross-origin request")
+			return
+		}
+		if !isJSON(r) {
+			writeError(w, http.StatusUnsupportedMediaType, "body must be JSON")
+			return
+		}
+
+		cmd := new(Command)
+		if err := json.NewDecoder(r.Body).Decode(cmd); err != nil && err != io.EOF {
+			writeError(w, http.StatusBadRequest, "malformed JSON: "+err.Error())
+			return
+		}
+		cmd.Action = parts[2]
+
+		log.Printf("[DEBUG] %s %s from %s\n", cmd.Action, id, r.RemoteAddr)
+		if err := cmd.Do(r.Context(), player); err != nil {
+			writeError(w, statusCode(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, StatusOf(id, player))
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// allowMethod reports whether the request method is the one allowed, and
+// responds with 405 Method Not Allowed if not.
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+// writeError writes the error message in JSON with the status code.
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+// openAPI is the OpenAPI description of the API. The server URL is
+// relative, so that it works wherever the API is mounted.
+const openAPI = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Omnicast",
+    "description": "Control of the media players bridged by Omnicast.",
+    "version": "1.0.0"
+  },
+  "servers": [{"url": "."}],
+  "paths": {
+    "/players": {
+      "get": {
+        "summary": "List the players",
+        "operationId": "listPlayers",
+        "responses": {
+          "200": {
+            "description": "Status of all players",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Status"}}}}
+          }
+        }
+      }
+    },
+    "/players/{id}": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "get": {
+        "summary": "Get the status of the player",
+        "operationId": "getPlayer",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Status"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/players/{id}/{action}": {
+      "parameters": [
+        {"$ref": "#/components/parameters/id"},
+        {
+          "name": "action",
+          "in": "path",
+          "required": true,
+          "schema": {"type": "string", "enum": ["load", "play", "pause", "stop", "seek", "volume", "mute", "unmute"]}
+        }
+      ],
+      "post": {
+        "summary": "Control the player",
+        "description": "Load takes the url and an optional title, seek takes the position, and volume takes the level. Other actions take no arguments.",
+        "operationId": "controlPlayer",
+        "requestBody": {
+          "required": false,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Command"}}}
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Status"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "501": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/events": {
+      "get": {
+        "summary": "Stream the status of all players",
+        "operationId": "streamEvents",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Events"}
+        }
+      }
+    },
+    "/players/{id}/events": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "get": {
+        "summary": "Stream the status of the player",
+        "operationId": "streamPlayerEvents",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Events"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "id": {"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}
+    },
+    "responses": {
+      "Status": {
+        "description": "Status of the player",
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Status"}}}
+      },
+      "Error": {
+        "description": "Error",
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+      },
+      "Events": {
+        "description": "Server-sent events of the status type, whose data is the status of a player in JSON, sent initially and whenever it changes",
+        "content": {"text/event-stream": {"schema": {"type": "string"}}}
+      }
+    },
+    "schemas": {
+      "Status": {
+        "type": "object",
+        "required": ["id", "name", "state", "duration", "position", "volume_level", "muted", "capabilities"],
+        "properties": {
+          "id": {"type": "string"},
+          "name": {"type": "string"},
+          "state": {"type": "string", "enum": ["idle", "playing", "paused", "buffering"]},
+          "media_url": {"type": "string", "format": "uri"},
+          "title": {"type": "string"},
+          "subtitle": {"type": "string"},
+          "image_url": {"type": "string", "format": "uri"},
+          "duration": {"type": "number", "description": "Duration of the media in seconds"},
+          "position": {"type": "number", "description": "Playback position in seconds"},
+          "volume_level": {"type": "number", "minimum": 0, "maximum": 1},
+          "muted": {"type": "boolean"},
+          "capabilities": {
+            "type": "array",
+            "items": {"type": "string", "enum": ["pause", "seek", "set_rate", "queue", "go_next", "go_previous", "set_volume", "mute"]}
+          }
+        }
+      },
+      "Command": {
+        "type": "object",
+        "properties": {
+          "url": {"type": "string", "format": "uri", "description": "Media URL to load"},
+          "title": {"type": "string", "description": "Title of the media to load"},
+          "position": {"type": "number", "minimum": 0, "description": "Position to seek to in seconds"},
+          "level": {"type": "number", "minimum": 0, "maximum": 1, "description": "Volume level to set"}
+        }
+      },
+      "Error": {
+        "type": "object",
+        "required": ["error"],
+        "properties": {
+          "error": {"type": "string"}
+        }
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,225 @@
+package web_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericyan/omnicast/omnicasttest"
+	"github.com/ericyan/omnicast/web"
+)
+
+func newAPI() (*httptest.Server, *omnicasttest.Player) {
+	player := omnicasttest.NewPlayer("Kitchen")
+	player.SetMediaDuration(3 * time.Minute)
+
+	players := new(web.Players)
+	players.Add("k1", player)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", web.NewAPI(players)))
+
+	return httptest.NewServer(mux), player
+}
+
+// call sends the request to the API, and decodes the JSON response into v
+// if not nil.
+func call(t *testing.T, method, url, body string, v interface{}) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: unexpected content type %s", method, url, ct)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return resp
+}
+
+func TestAPI(t *testing.T) {
+	srv, player := newAPI()
+	defer srv.Close()
+
+	var list []*web.Status
+	call(t, http.MethodGet, srv.URL+"/api/players", "", &list)
+	if len(list) != 1 || list[0].ID != "k1" || list[0].Name != "Kitchen" || list[0].State != "idle" {
+		t.Errorf("Unexpected players: %+v", list)
+	}
+	if len(list) > 0 && len(list[0].Capabilities) != 8 {
+		t.Errorf("Unexpected capabilities: %v", list[0].Capabilities)
+	}
+
+	tests := []struct {
+		action string
+		body   string
+		code   int
+		check  func(s *web.Status) bool
+	}{
+		{"play", "", http.StatusConflict, nil},
+		{"load", `{"url": "song.mp3"}`, http.StatusBadRequest, nil},
+		{"load", `{"url": "http://example.com/song.mp3", "title": "Song"}`, http.StatusOK, func(s *web.Status) bool {
+			return s.State == "playing" && s.MediaURL == "http://example.com/song.mp3" && s.Title == "Song"
+		}},
+		{"pause", "", http.StatusOK, func(s *web.Status) bool { return s.State == "paused" }},
+		{"play", "{}", http.StatusOK, func(s *web.Status) bool { return s.State == "playing" }},
+		{"seek", `{"position": 42.5}`, http.StatusOK, func(s *web.Status) bool { return s.Position == 42.5 }},
+		{"seek", `{"position": -1}`, http.StatusBadRequest, nil},
+		{"volume", `{"level": 0.4}`, http.StatusOK, func(s *web.Status) bool { return s.VolumeLevel == 0.4 }},
+		{"volume", `{"level": "loud"}`, http.StatusBadRequest, nil},
+		{"mute", "", http.StatusOK, func(s *web.Status) bool { return s.Muted }},
+		{"stop", "", http.StatusOK, func(s *web.Status) bool { return s.State == "idle" }},
+		{"rewind", "", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		var s web.Status
+		resp := call(t, http.MethodPost, srv.URL+"/api/players/k1/"+tt.action, tt.body, &s)
+		if resp.StatusCode != tt.code {
+			t.Errorf("%s %s: got %s, want %d", tt.action, tt.body, resp.Status, tt.code)
+			continue
+		}
+		if tt.check != nil && !tt.check(&s) {
+			t.Errorf("%s %s: unexpected status %+v", tt.action, tt.body, s)
+		}
+	}
+
+	var s web.Status
+	call(t, http.MethodGet, srv.URL+"/api/players/k1", "", &s)
+	if player.MediaURL() != nil || s.MediaURL != "" || !s.Muted || s.VolumeLevel != 0.4 {
+		t.Errorf("Unexpected status: %+v", s)
+	}
+
+	var e struct{ Error string }
+	if resp := call(t, http.MethodGet, srv.URL+"/api/players/k2", "", &e); resp.StatusCode != http.StatusNotFound || e.Error == "" {
+		t.Errorf("Unknown player: %s %q", resp.Status, e.Error)
+	}
+	if resp := call(t, http.MethodPost, srv.URL+"/api/players", "", nil); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /players: %s", resp.Status)
+	}
+}
+
+func TestAPICrossOrigin(t *testing.T) {
+	srv, player := newAPI()
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		header, value string
+		contentType   string
+		code          int
+	}{
+		{"Origin", "http://evil.example.com", "application/json", http.StatusForbidden},
+		{"Origin", "null", "application/json", http.StatusForbidden},
+		{"Referer", "http://evil.example.com/page", "application/json", http.StatusForbidden},
+		{"Origin", "http://evil.example.com", "text/plain", http.StatusForbidden},
+		{"", "", "text/plain", http.StatusUnsupportedMediaType},
+		{"", "", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"Origin", srv.URL, "application/json; charset=utf-8", http.StatusOK},
+		{"", "", "application/json", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/players/k1/volume", strings.NewReader(`{"level": 0.1}`))
+		req.Header.Set("Content-Type", tc.contentType)
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tc.code {
+			t.Errorf("%s %q (%s): got %s, want %d", tc.header, tc.value, tc.contentType, resp.Status, tc.code)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/players/k1/volume", strings.NewReader(`{"level": 0.9}`))
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if player.VolumeLevel() == 0.9 {
+		t.Error("Volume changed by a text/plain request")
+	}
+}
+
+func TestAPIOpenAPI(t *testing.T) {
+	srv, _ := newAPI()
+	defer srv.Close()
+
+	var doc struct {
+		OpenAPI string                 `json:"openapi"`
+		Paths   map[string]interface{} `json:"paths"`
+	}
+	call(t, http.MethodGet, srv.URL+"/api/openapi.json", "", &doc)
+
+	if doc.OpenAPI == "" {
+		t.Error("Missing OpenAPI version")
+	}
+	for _, path := range []string{"/players", "/players/{id}", "/players/{id}/{action}", "/events", "/players/{id}/events"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("Missing path %s", path)
+		}
+	}
+}
+
+func TestAPIEvents(t *testing.T) {
+	srv, _ := newAPI()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/players/k1/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	r := bufio.NewReader(resp.Body)
+	next := func() *web.Status {
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+
+			s := new(web.Status)
+			if err := json.Unmarshal([]byte(line[len("data: "):]), s); err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}
+	}
+
+	if s := next(); s.ID != "k1" || s.State != "idle" {
+		t.Errorf("Unexpected initial status: %+v", s)
+	}
+
+	call(t, http.MethodPost, srv.URL+"/api/players/k1/load", `{"url": "http://example.com/song.mp3"}`, nil)
+	for s := next(); s.State != "playing"; s = next() {
+		if s.MediaURL != "http://example.com/song.mp3" {
+			t.Errorf("Unexpected status: %+v", s)
+		}
+	}
+}
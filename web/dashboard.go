@@ -0,0 +1,288 @@
+package web
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Dashboard is the web interface showing the players with what they are
+// playing, with transport controls and a form to cast a URL. The status
+// is updated live via server-sent events.
+//
+// It serves paths relative to where it is mounted, so it should be used
+// with http.StripPrefix, e.g. at the presentation URL of the device:
+//
+//	dev.Handle("/ui/", http.StripPrefix("/ui", web.NewDashboard(players)))
+type Dashboard struct {
+	Players *Players
+}
+
+// NewDashboard returns the dashboard of the players.
+func NewDashboard(players *Players) *Dashboard {
+	return &Dashboard{players}
+}
+
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+
+	switch {
+	case path == "":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		d.servePage(w, r)
+	case path == "events":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		serveEvents(w, r, d.Players, "")
+	case strings.HasPrefix(path, "players/"):
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !isSameOrigin(r) {
+			http.Error(w, "cross-origin request", http.StatusForbidden)
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(path, "players/"), "/")
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+
+		d.serveCommand(w, r, parts[0], parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (d *Dashboard) servePage(w http.ResponseWriter, r *http.Request) {
+	var statuses []*Status
+	for _, id := range d.Players.IDs() {
+		statuses = append(statuses, StatusOf(id, d.Players.Get(id)))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTpl.Execute(w, statuses); err != nil {
+		log.Println(err)
+	}
+}
+
+// serveCommand does the action with the arguments in the form. Scripts
+// accepting JSON get the status of the player, and browsers submitting
+// the form are redirected back to the dashboard.
+func (d *Dashboard) serveCommand(w http.ResponseWriter, r *http.Request, id, action string) {
+	player := d.Players.Get(id)
+	if player == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	cmd, err := parseForm(r, action)
+	if err == nil {
+		log.Printf("[DEBUG] %s %s from %s\n", action, id, r.RemoteAddr)
+
+		err = cmd.Do(r.Context(), player)
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		if err != nil {
+			writeError(w, statusCode(err), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, StatusOf(id, player))
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), statusCode(err))
+		return
+	}
+
+	// The location is relative to the request URL, which is unknown here
+	// as the prefix of the dashboard has been stripped.
+	w.Header().Set("Location", "../../")
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+// parseForm returns the command of the action with the arguments in the
+// form of the request.
+func parseForm(r *http.Request, action string) (*Command, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, ErrInvalidArgument
+	}
+
+	cmd := &Command{
+		Action: action,
+		URL:    r.PostForm.Get("url"),
+		Title:  r.PostForm.Get("title"),
+	}
+
+	for name, f := range map[string]*float64{"position": &cmd.Position, "level": &cmd.Level} {
+		v := r.PostForm.Get(name)
+		if v == "" {
+			continue
+		}
+
+		x, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, ErrInvalidArgument
+		}
+		*f = x
+	}
+
+	return cmd, nil
+}
+
+// writeJSON writes v in JSON with the status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println(err)
+	}
+}
+
+const dashboardTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Omnicast</title>
+<style>
+body { font-family: sans-serif; margin: 0 auto; max-width: 40em; padding: 1em; }
+.player { border: 1px solid #ccc; border-radius: 4px; margin: 1em 0; padding: 1em; overflow: hidden; }
+.player h2 { margin: 0 0 .5em; }
+.player img { float: left; max-width: 96px; max-height: 96px; margin: 0 1em 1em 0; }
+.player img[src=""] { display: none; }
+.player form { display: inline; }
+.player .media { min-height: 3em; }
+.player .state { color: #666; font-size: small; text-transform: uppercase; }
+.player .title { font-weight: bold; }
+.player label { display: block; clear: both; }
+.player input[type=range] { width: 100%; }
+.player input[type=url] { width: 60%; }
+</style>
+</head>
+<body>
+<h1>Omnicast</h1>
+{{range .}}
+<section class="player" id="player-{{.ID}}">
+  <h2>{{.Name}}</h2>
+  <img class="art" src="{{.ImageURL}}" alt="">
+  <div class="media">
+    <div class="state">{{.State}}</div>
+    <div class="title">{{.Title}}</div>
+    <div class="subtitle">{{.Subtitle}}</div>
+  </div>
+  <label>
+    <span class="position"></span> / <span class="duration"></span>
+    <input class="seek" type="range" min="0" max="{{.Duration}}" step="1" value="{{.Position}}" data-action="seek" data-name="position">
+  </label>
+  <form method="post" action="players/{{.ID}}/play"><button>Play</button></form>
+  <form method="post" action="players/{{.ID}}/pause"><button>Pause</button></form>
+  <form method="post" action="players/{{.ID}}/stop"><button>Stop</button></form>
+  <form method="post" action="players/{{.ID}}/{{if .Muted}}unmute{{else}}mute{{end}}"><button class="mute">{{if .Muted}}Unmute{{else}}Mute{{end}}</button></form>
+  <label>
+    Volume
+    <input class="volume" type="range" min="0" max="1" step="0.01" value="{{.VolumeLevel}}" data-action="volume" data-name="level">
+  </label>
+  <form class="cast" method="post" action="players/{{.ID}}/load">
+    <input type="url" name="url" placeholder="Media URL" required>
+    <input type="text" name="title" placeholder="Title">
+    <button>Cast</button>
+  </form>
+</section>
+{{else}}
+<p>No players.</p>
+{{end}}
+<script>
+(function() {
+  function clock(s) {
+    s = Math.floor(s);
+    var m = Math.floor(s / 60), h = Math.floor(m / 60);
+    var pad = function(n) { return (n < 10 ? "0" : "") + n; };
+    return (h > 0 ? h + ":" + pad(m % 60) : m) + ":" + pad(s % 60);
+  }
+
+  function post(el, action, body) {
+    return fetch("players/" + encodeURIComponent(el.id.slice("player-".length)) + "/" + action, {
+      method: "POST",
+      headers: {"Accept": "application/json"},
+      body: body
+    }).then(function(resp) {
+      return resp.json().then(function(v) {
+        if (!resp.ok) throw new Error(v.error);
+        update(v);
+      });
+    }).catch(function(err) { alert(err.message); });
+  }
+
+  function update(s) {
+    var el = document.getElementById("player-" + s.id);
+    if (!el) {
+      location.reload();
+      return;
+    }
+
+    var art = el.querySelector(".art");
+    if (art.getAttribute("src") !== s.image_url) art.setAttribute("src", s.image_url || "");
+    el.querySelector(".state").textContent = s.state;
+    el.querySelector(".title").textContent = s.title || "";
+    el.querySelector(".subtitle").textContent = s.subtitle || "";
+    el.querySelector(".position").textContent = clock(s.position);
+    el.querySelector(".duration").textContent = clock(s.duration);
+
+    var seek = el.querySelector(".seek");
+    seek.max = s.duration;
+    if (document.activeElement !== seek) seek.value = s.position;
+    var volume = el.querySelector(".volume");
+    if (document.activeElement !== volume) volume.value = s.volume_level;
+
+    var mute = el.querySelector(".mute");
+    mute.textContent = s.muted ? "Unmute" : "Mute";
+    mute.form.setAttribute("action", "players/" + s.id + "/" + (s.muted ? "unmute" : "mute"));
+  }
+
+  document.querySelectorAll(".player").forEach(function(el) {
+    el.querySelectorAll("form").forEach(function(form) {
+      form.addEventListener("submit", function(e) {
+        e.preventDefault();
+        var action = form.getAttribute("action").split("/").pop();
+        post(el, action, new URLSearchParams(new FormData(form))).then(function() {
+          if (form.classList.contains("cast")) form.reset();
+        });
+      });
+    });
+
+    el.querySelectorAll("input[type=range]").forEach(function(input) {
+      input.addEventListener("change", function() {
+        var body = new URLSearchParams();
+        body.set(input.dataset.name, input.value);
+        post(el, input.dataset.action, body);
+      });
+    });
+  });
+
+  new EventSource("events").addEventListener("status", function(e) {
+    update(JSON.parse(e.data));
+  });
+})();
+</script>
+</body>
+</html>
+`
+
+var dashboardTpl = template.Must(template.New("dashboard").Parse(dashboardTemplate))
@@ -0,0 +1,218 @@
+package web_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericyan/omnicast"
+	"github.com/ericyan/omnicast/omnicasttest"
+	"github.com/ericyan/omnicast/web"
+)
+
+func newDashboard() (*httptest.Server, *omnicasttest.Player) {
+	player := omnicasttest.NewPlayer("Living Room")
+	player.SetMediaDuration(3 * time.Minute)
+
+	players := new(web.Players)
+	players.Add("p1", player)
+
+	mux := http.NewServeMux()
+	mux.Handle("/ui/", http.StripPrefix("/ui", web.NewDashboard(players)))
+
+	return httptest.NewServer(mux), player
+}
+
+func TestDashboard(t *testing.T) {
+	srv, _ := newDashboard()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/ui/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status: %s", resp.Status)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	for _, s := range []string{"Living Room", `id="player-p1"`, `action="players/p1/load"`} {
+		if !strings.Contains(string(body), s) {
+			t.Errorf("Page missing %q", s)
+		}
+	}
+}
+
+func TestDashboardCommands(t *testing.T) {
+	srv, player := newDashboard()
+	defer srv.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.PostForm(srv.URL+"/ui/players/p1/load", url.Values{
+		"url":   {"http://example.com/song.mp3"},
+		"title": {"Song"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "../../" {
+		t.Errorf("Unexpected response: %s to %q", resp.Status, resp.Header.Get("Location"))
+	}
+	if !player.IsPlaying() || player.MediaMetadata().Title() != "Song" {
+		t.Errorf("Media not loaded: %v %v", player.MediaURL(), player.State())
+	}
+
+	post := func(action string, form url.Values) (*web.Status, int) {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/ui/players/p1/"+action, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		status := new(web.Status)
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return status, resp.StatusCode
+	}
+
+	if s, code := post("pause", nil); code != http.StatusOK || s.State != "paused" {
+		t.Errorf("pause: %d %+v", code, s)
+	}
+	if s, code := post("seek", url.Values{"position": {"30"}}); code != http.StatusOK || s.Position != 30 {
+		t.Errorf("seek: %d %+v", code, s)
+	}
+	if s, code := post("volume", url.Values{"level": {"0.25"}}); code != http.StatusOK || s.VolumeLevel != 0.25 {
+		t.Errorf("volume: %d %+v", code, s)
+	}
+	if _, code := post("volume", url.Values{"level": {"2"}}); code != http.StatusBadRequest {
+		t.Errorf("volume out of range: %d", code)
+	}
+	if _, code := post("rewind", nil); code != http.StatusNotFound {
+		t.Errorf("unknown action: %d", code)
+	}
+
+	player.SetCapabilities(omnicast.AllCapabilities &^ omnicast.CanSeek)
+	if _, code := post("seek", url.Values{"position": {"10"}}); code != http.StatusNotImplemented {
+		t.Errorf("unsupported seek: %d", code)
+	}
+
+	resp, err = http.PostForm(srv.URL+"/ui/players/p2/play", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Unknown player: %s", resp.Status)
+	}
+}
+
+func TestDashboardCrossOrigin(t *testing.T) {
+	srv, player := newDashboard()
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		header, value string
+		code          int
+	}{
+		{"Origin", "http://evil.example.com", http.StatusForbidden},
+		{"Origin", "null", http.StatusForbidden},
+		{"Referer", "http://evil.example.com/page", http.StatusForbidden},
+		{"Origin", srv.URL, http.StatusOK},
+		{"Referer", srv.URL + "/ui/", http.StatusOK},
+		{"", "", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/ui/players/p1/mute", nil)
+		req.Header.Set("Accept", "application/json")
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tc.code {
+			t.Errorf("%s %q: got %s, want %d", tc.header, tc.value, resp.Status, tc.code)
+		}
+	}
+
+	player.Unmute(context.Background())
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/ui/players/p1/mute", nil)
+	req.Header.Set("Origin", "http://evil.example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if player.IsMuted() {
+		t.Error("Player muted by a cross-origin request")
+	}
+}
+
+func TestDashboardEvents(t *testing.T) {
+	srv, player := newDashboard()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/ui/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Unexpected content type: %s", ct)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	next := func() *web.Status {
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+
+			s := new(web.Status)
+			if err := json.Unmarshal([]byte(line[len("data: "):]), s); err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}
+	}
+
+	if s := next(); s.ID != "p1" || s.Name != "Living Room" || s.State != "idle" {
+		t.Errorf("Unexpected initial status: %+v", s)
+	}
+
+	player.SetState(omnicast.StatePaused)
+	if s := next(); s.State != "paused" {
+		t.Errorf("Unexpected status: %+v", s)
+	}
+}
@@ -0,0 +1,111 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ericyan/omnicast"
+)
+
+// PollInterval is how often the status of the players is checked for the
+// event stream, since the playback position changes without events, and
+// not every player is an event source.
+var PollInterval = time.Second
+
+// serveEvents streams the status of the players as server-sent events of
+// the "status" type, initially and whenever it changes, until the client
+// goes away. If id is not empty, only the player with the ID is streamed.
+func serveEvents(w http.ResponseWriter, r *http.Request, players *Players, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ids := func() []string {
+		if id != "" {
+			return []string{id}
+		}
+
+		return players.IDs()
+	}
+
+	ctx := r.Context()
+	changed := make(chan string, 1)
+	for _, id := range ids() {
+		src, ok := players.Get(id).(omnicast.EventSource)
+		if !ok {
+			continue
+		}
+
+		events, err := src.Subscribe(ctx)
+		if err != nil {
+			continue
+		}
+
+		go func(id string) {
+			for range events {
+				select {
+				case changed <- id:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(id)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	last := make(map[string][]byte)
+	send := func(id string) error {
+		player := players.Get(id)
+		if player == nil {
+			return nil
+		}
+
+		data, err := json.Marshal(StatusOf(id, player))
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(data, last[id]) {
+			return nil
+		}
+		last[id] = data
+
+		_, err = fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+		return err
+	}
+
+	for _, id := range ids() {
+		if err := send(id); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-changed:
+			if err := send(id); err != nil {
+				return
+			}
+		case <-ticker.C:
+			for _, id := range ids() {
+				if err := send(id); err != nil {
+					return
+				}
+			}
+		}
+		flusher.Flush()
+	}
+}
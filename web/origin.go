@@ -0,0 +1,39 @@
+package web
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// isSameOrigin returns false if the request is sent by a browser from a
+// page of another origin, which is told by the Origin header, or else the
+// Referer header. Requests with neither, e.g. from scripts, are allowed.
+func isSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return u.Host == r.Host
+}
+
+// isJSON returns true if the body of the request is in JSON, or empty
+// without a media type.
+func isJSON(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return r.ContentLength == 0
+	}
+
+	mt, _, err := mime.ParseMediaType(ct)
+	return err == nil && mt == "application/json"
+}
@@ -0,0 +1,177 @@
+// Package web provides web interfaces to the players, i.e. a dashboard
+// for humans, and a JSON API for scripts.
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ericyan/omnicast"
+)
+
+// Errors returned for invalid commands.
+var (
+	ErrUnknownAction   = errors.New("unknown action")
+	ErrInvalidArgument = errors.New("invalid argument")
+)
+
+// Players is a set of players, identified by IDs which are used in URLs.
+// The zero value is an empty set ready to use.
+type Players struct {
+	mu      sync.RWMutex
+	ids     []string
+	players map[string]omnicast.MediaPlayerV2
+}
+
+// Add adds the player with the ID, replacing the one with the same ID.
+func (ps *Players) Add(id string, player omnicast.MediaPlayerV2) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.players == nil {
+		ps.players = make(map[string]omnicast.MediaPlayerV2)
+	}
+	if _, ok := ps.players[id]; !ok {
+		ps.ids = append(ps.ids, id)
+	}
+	ps.players[id] = player
+}
+
+// Get returns the player with the ID, or nil if not found.
+func (ps *Players) Get(id string) omnicast.MediaPlayerV2 {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	return ps.players[id]
+}
+
+// IDs returns the IDs of the players, in the order they were added.
+func (ps *Players) IDs() []string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	return append([]string(nil), ps.ids...)
+}
+
+// Status is a snapshot of a player. Durations are in seconds, and the
+// volume level is between 0.0 and 1.0.
+type Status struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	State        string   `json:"state"`
+	MediaURL     string   `json:"media_url,omitempty"`
+	Title        string   `json:"title,omitempty"`
+	Subtitle     string   `json:"subtitle,omitempty"`
+	ImageURL     string   `json:"image_url,omitempty"`
+	Duration     float64  `json:"duration"`
+	Position     float64  `json:"position"`
+	VolumeLevel  float64  `json:"volume_level"`
+	Muted        bool     `json:"muted"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// StatusOf returns the status of the player.
+func StatusOf(id string, player omnicast.MediaPlayerV2) *Status {
+	s := &Status{
+		ID:           id,
+		Name:         player.Name(),
+		State:        omnicast.StateOf(player).String(),
+		Duration:     player.MediaDuration().Seconds(),
+		Position:     player.PlaybackPosition().Seconds(),
+		VolumeLevel:  player.VolumeLevel(),
+		Muted:        player.IsMuted(),
+		Capabilities: []string{},
+	}
+
+	if u := player.MediaURL(); u != nil {
+		s.MediaURL = u.String()
+	}
+	if md := player.MediaMetadata(); md != nil {
+		s.Title = md.Title()
+		s.Subtitle = md.Subtitle()
+		if u := md.ImageURL(); u != nil {
+			s.ImageURL = u.String()
+		}
+	}
+	if caps := omnicast.CapabilitiesOf(player); caps != 0 {
+		s.Capabilities = strings.Split(caps.String(), "|")
+	}
+
+	return s
+}
+
+// A Command is an action to be done by a player, with the arguments it
+// takes. Positions are in seconds, and levels are between 0.0 and 1.0.
+type Command struct {
+	Action   string  `json:"action"`
+	URL      string  `json:"url,omitempty"`
+	Title    string  `json:"title,omitempty"`
+	Position float64 `json:"position,omitempty"`
+	Level    float64 `json:"level,omitempty"`
+}
+
+// Do calls the player method of the action, which is one of load, play,
+// pause, stop, seek, volume, mute and unmute.
+func (c *Command) Do(ctx context.Context, player omnicast.MediaPlayerV2) error {
+	switch c.Action {
+	case "load":
+		u, err := url.Parse(c.URL)
+		if err != nil || !u.IsAbs() {
+			return ErrInvalidArgument
+		}
+
+		var md omnicast.MediaMetadata
+		if c.Title != "" {
+			md = (&omnicast.MediaDetails{Title: c.Title}).Metadata()
+		}
+
+		return player.Load(ctx, u, md)
+	case "play":
+		return player.Play(ctx)
+	case "pause":
+		return player.Pause(ctx)
+	case "stop":
+		return player.Stop(ctx)
+	case "seek":
+		if c.Position < 0 {
+			return ErrInvalidArgument
+		}
+
+		return player.SeekTo(ctx, time.Duration(c.Position*float64(time.Second)))
+	case "volume":
+		if c.Level < 0 || c.Level > 1 {
+			return ErrInvalidArgument
+		}
+
+		return player.SetVolumeLevel(ctx, c.Level)
+	case "mute":
+		return player.Mute(ctx)
+	case "unmute":
+		return player.Unmute(ctx)
+	default:
+		return ErrUnknownAction
+	}
+}
+
+// statusCode returns the HTTP status code for the error of a command.
+func statusCode(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrUnknownAction):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidArgument), errors.Is(err, omnicast.ErrInvalidMedia):
+		return http.StatusBadRequest
+	case errors.Is(err, omnicast.ErrNoMedia):
+		return http.StatusConflict
+	case errors.Is(err, omnicast.ErrNotSupported):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusBadGateway
+	}
+}